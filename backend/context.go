@@ -6,9 +6,17 @@ import (
 )
 
 const (
-	CTX_KEY_CONVERTER = "CONVERTER"
+	CTX_KEY_CONVERTER  = "CONVERTER"
+	CTX_KEY_FOUND_ROWS = "FOUND_ROWS" // 客户端是否设置了CLIENT_FOUND_ROWS
+	CTX_KEY_POOL       = "POOL"       // 不在事务中执行时的连接池
 )
 
+// WithFoundRows 记录客户端是否设置了CLIENT_FOUND_ROWS，没有设置时update和on duplicate key update
+// 只计入值改变的行
+func WithFoundRows(ctx context.Context, foundRows bool) context.Context {
+	return context.WithValue(ctx, CTX_KEY_FOUND_ROWS, foundRows)
+}
+
 type IContext interface {
 	// 设置业务上下文
 	WithContext(context.Context)
@@ -17,59 +17,296 @@ package backend
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"sqlproxy/core/golog"
 	"sqlproxy/sqlparser"
+	"strings"
 )
 
 type convertSQLPlugin struct {
 	Context
 	db        dbQuerierWithCtx
+	alias     string
 	converter sqlparser.SQLConverter
 }
 
 var _ SQLPlugin = new(convertSQLPlugin)
 
+// Prepare 预处理语句执行时不经过转换插件，DDL修改的表的元数据不记录
 func (d *convertSQLPlugin) Prepare(query string) (*sql.Stmt, error) {
-	convertSQL, _, err := d.converter.Convert(query)
+	unit, _, err := d.convertSingle("Prepare", query)
 	if err != nil {
-		golog.Warn("convertSQLPlugin", "Prepare", err.Error(), 0)
-		convertSQL = query
+		return nil, err
 	}
-	stmt, err := d.db.Prepare(convertSQL)
+	stmt, err := d.db.Prepare(unit.SQL)
 	return stmt, err
 }
 
 func (d *convertSQLPlugin) Exec(query string, args ...interface{}) (sql.Result, error) {
-	convertSQL, newArgs, err := d.converter.Convert(query, args...)
+	return d.ExecContext(context.Background(), query, args...)
+}
+
+// ExecContext 转换并执行语句，转换为多条语句时影响行数是各条语句按倍数计入之和，例如replace
+// 转换的delete和insert。不在事务中时多条语句在连接池的同一个连接上执行，例如insert之后查询
+// scope_identity()，计入影响行数的语句多于一条时在一个事务中执行。全部执行成功之后才记录DDL
+// 修改的表的元数据
+func (d *convertSQLPlugin) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	unit, meta, err := d.convertUnit(ctx, query, args...)
+	if err != nil || len(unit) == 0 {
+		d.convertFailed("Exec", err)
+		if !canFallback(err) {
+			return nil, err
+		}
+		unit = []sqlparser.ConvertedStmt{{SQL: query, Args: args, RowsFactor: 1}}
+	}
+	result, err := d.execUnit(ctx, unit)
+	if err == nil && meta != nil {
+		meta.Apply()
+	}
+	return result, err
+}
+
+func (d *convertSQLPlugin) execUnit(ctx context.Context, unit []sqlparser.ConvertedStmt) (sql.Result, error) {
+	pool, _ := ctx.Value(CTX_KEY_POOL).(*sql.DB)
+	if len(unit) == 1 || pool == nil {
+		return execStmts(d.db, unit)
+	}
+	if countedStmts(unit) > 1 {
+		tx, err := pool.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		result, err := execStmts(wrapQueryLog(&PoolWrapper{dbQuerier: tx}, d.alias), unit)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	conn, err := pool.Conn(ctx)
 	if err != nil {
-		golog.Warn("convertSQLPlugin", "Prepare", err.Error(), 0)
-		convertSQL = query
+		return nil, err
 	}
-	res, err := d.db.Exec(convertSQL, newArgs...)
-	return res, err
+	defer conn.Close()
+	return execStmts(wrapQueryLog(&PoolWrapper{dbQuerier: &connQuerier{ctx: ctx, conn: conn}}, d.alias), unit)
+}
+
+// convertUnit 按ctx中客户端的CLIENT_FOUND_ROWS转换，没有记录时与Convert一样计入匹配的行数
+func (d *convertSQLPlugin) convertUnit(ctx context.Context, query string, args ...interface{}) ([]sqlparser.ConvertedStmt, sqlparser.MetaChange, error) {
+	foundRows, ok := ctx.Value(CTX_KEY_FOUND_ROWS).(bool)
+	if !ok {
+		foundRows = true
+	}
+	if converter, ok := d.converter.(sqlparser.UnitConverter); ok {
+		return converter.ConvertUnit(query, foundRows, args...)
+	}
+	convertSQLs, newArgs, err := d.converter.Convert(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	unit := make([]sqlparser.ConvertedStmt, 0, len(convertSQLs))
+	for _, convertSQL := range convertSQLs {
+		unit = append(unit, sqlparser.ConvertedStmt{SQL: convertSQL, Args: newArgs, RowsFactor: 1})
+	}
+	return unit, nil, nil
+}
+
+// countedStmts 返回计入影响行数的语句数，set identity_insert和查询insert id的语句不计入
+func countedStmts(unit []sqlparser.ConvertedStmt) int {
+	n := 0
+	for _, s := range unit {
+		if s.RowsFactor > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// execStmts 依次执行转换成的语句，各条语句使用自己的参数
+func execStmts(db dbQuerier, unit []sqlparser.ConvertedStmt) (sql.Result, error) {
+	result := &unitResult{}
+	for _, s := range unit {
+		if len(unit) > 1 && sqlparser.Preview(s.SQL) == sqlparser.StmtSelect {
+			if err := queryResult(db, result, s.SQL, s.Args...); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		res, err := db.Exec(s.SQL, s.Args...)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			result.rowsAffected += n * s.RowsFactor
+		}
+	}
+	return result, nil
+}
+
+// queryResult 执行转换时附加的查询，查询到的scope_identity()作为生成的自增ID，affected_rows__计入影响行数
+func queryResult(db dbQuerier, result *unitResult, query string, args ...interface{}) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil || len(columns) != 1 {
+		return err
+	}
+	var value sql.NullInt64
+	for rows.Next() {
+		if err = rows.Scan(&value); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil || !value.Valid {
+		return err
+	}
+	switch {
+	case strings.EqualFold(columns[0], sqlparser.InsertIdColumn):
+		result.insertId = value.Int64
+	case strings.EqualFold(columns[0], sqlparser.AffectedRowsColumn):
+		result.rowsAffected += value.Int64
+	}
+	return nil
+}
+
+// connQuerier 在连接池的一个连接上执行语句，不开启事务
+type connQuerier struct {
+	ctx  context.Context
+	conn *sql.Conn
+}
+
+func (q *connQuerier) Prepare(query string) (*sql.Stmt, error) {
+	return q.conn.PrepareContext(q.ctx, query)
+}
+
+func (q *connQuerier) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return q.conn.ExecContext(q.ctx, query, args...)
+}
+
+func (q *connQuerier) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return q.conn.QueryContext(q.ctx, query, args...)
+}
+
+func (q *connQuerier) QueryRow(query string, args ...interface{}) *sql.Row {
+	return q.conn.QueryRowContext(q.ctx, query, args...)
 }
 
 func (d *convertSQLPlugin) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	convertSQL, _, err := d.converter.Convert(query)
+	unit, meta, err := d.convertSingle("Query", query, args...)
 	if err != nil {
-		golog.Warn("convertSQLPlugin", "Prepare", err.Error(), 0)
-		convertSQL = query
+		return nil, err
+	}
+	res, err := d.db.Query(unit.SQL, unit.Args...)
+	if err == nil && meta != nil {
+		meta.Apply()
 	}
-	res, err := d.db.Query(convertSQL, args...)
 	return res, err
 }
 
+// QueryRow 转换失败且不能按原语句执行时，与database/sql一样在Scan时返回错误
 func (d *convertSQLPlugin) QueryRow(query string, args ...interface{}) *sql.Row {
-	convertSQL, _, err := d.converter.Convert(query)
+	unit, meta, err := d.convertSingle("QueryRow", query, args...)
 	if err != nil {
-		golog.Warn("convertSQLPlugin", "Prepare", err.Error(), 0)
-		convertSQL = query
+		return errorRow(err)
+	}
+	res := d.db.QueryRow(unit.SQL, unit.Args...)
+	if res.Err() == nil && meta != nil {
+		meta.Apply()
 	}
-	res := d.db.QueryRow(convertSQL, args...)
 	return res
 }
 
+// errorRow 返回Scan时报告err的*sql.Row，database/sql只能在查询时构造*sql.Row
+func errorRow(err error) *sql.Row {
+	db := sql.OpenDB(errorConnector{err: err})
+	defer db.Close()
+	return db.QueryRow("")
+}
+
+// errorConnector 连接时返回err
+type errorConnector struct {
+	err error
+}
+
+func (c errorConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, c.err
+}
+
+func (c errorConnector) Driver() driver.Driver {
+	return nil
+}
+
+// ErrMultiStmtUnit is returned by Query, QueryRow and Prepare for a statement
+// converted into more than one statement, which is only executed by Exec.
+var ErrMultiStmtUnit = errors.New("statement converted into more than one statement can only be executed by Exec")
+
+// convertSingle 转换只能执行一条语句的Query、QueryRow和Prepare的SQL，转换为多条语句时返回
+// ErrMultiStmtUnit，不执行其中的一部分
+func (d *convertSQLPlugin) convertSingle(method, query string, args ...interface{}) (sqlparser.ConvertedStmt, sqlparser.MetaChange, error) {
+	unit, meta, err := d.convertUnit(context.Background(), query, args...)
+	if err == nil && len(unit) > 1 {
+		err = fmt.Errorf("%w: %s", ErrMultiStmtUnit, query)
+	}
+	if err != nil || len(unit) == 0 {
+		d.convertFailed(method, err)
+		if !canFallback(err) {
+			return sqlparser.ConvertedStmt{}, nil, err
+		}
+		return sqlparser.ConvertedStmt{SQL: query, Args: args, RowsFactor: 1}, nil, nil
+	}
+	return unit[0], meta, nil
+}
+
+// unitResult 是一条语句转换成的多条语句的执行结果，驱动返回的LastInsertId不一定是自增列的值，
+// 自增ID只取查询到的scope_identity()，没有生成自增ID时为0
+type unitResult struct {
+	rowsAffected int64
+	insertId     int64
+}
+
+func (r *unitResult) LastInsertId() (int64, error) {
+	return r.insertId, nil
+}
+
+func (r *unitResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+// noFallbackErrs 按原语句执行会改变语义或者目标库一定报错的转换错误
+var noFallbackErrs = []error{
+	sqlparser.ErrNoUniqueKey,
+	sqlparser.ErrDuplicateKeyRows,
+	sqlparser.ErrValuesNotInserted,
+	sqlparser.ErrMultiTargetUpdate,
+	sqlparser.ErrMultiTargetDelete,
+	sqlparser.ErrUpdateLimit,
+	ErrMultiStmtUnit,
+}
+
+// canFallback 判断转换失败的语句能否按原SQL执行
+func canFallback(err error) bool {
+	for _, e := range noFallbackErrs {
+		if errors.Is(err, e) {
+			return false
+		}
+	}
+	return true
+}
+
+// convertFailed 记录转换失败，失败后按原SQL执行
+func (d *convertSQLPlugin) convertFailed(method string, err error) {
+	convertFailureTotal.WithLabelValues(d.alias).Inc()
+	golog.Warn("convertSQLPlugin", method, fmt.Sprint(err), 0, "alias", d.alias)
+}
+
 func (d *convertSQLPlugin) Begin() (*sql.Tx, error) {
 	return d.db.(txer).Begin()
 }
@@ -82,17 +319,18 @@ func (d *convertSQLPlugin) Rollback() error {
 	return d.db.(txEnder).Rollback()
 }
 
-func wrapConverter(db dbQuerierWithCtx, alias, driverName string, converterName string) (dbQuerierWithCtx, error) {
+func wrapConverter(db dbQuerierWithCtx, alias, driverName string, converterName string, pagination string) (dbQuerierWithCtx, error) {
 	value := db.GetContext().Value(CTX_KEY_CONVERTER)
 	if value != nil && value.(sqlparser.SQLConverter) != nil {
 		golog.Info("convertSQLPlugin", "wrapConverter", "reuse sql converter from context", 0, "alias", alias)
 		return &convertSQLPlugin{
 			db:        db,
+			alias:     alias,
 			converter: value.(sqlparser.SQLConverter),
 		}, nil
 	}
 
-	converter, err := getConverter(db, alias, driverName, converterName)
+	converter, err := getConverter(db, alias, driverName, converterName, pagination)
 	if converter == nil {
 		golog.Warn("convertSQLPlugin", "wrapConverter", "Unsupported converterName:"+converterName, 0, err)
 		return db, nil
@@ -100,13 +338,14 @@ func wrapConverter(db dbQuerierWithCtx, alias, driverName string, converterName
 
 	d := new(convertSQLPlugin)
 	d.db = db
+	d.alias = alias
 	d.converter = converter
 	d.WithContext(context.WithValue(db.GetContext(), CTX_KEY_CONVERTER, converter))
 	return d, nil
 
 }
 
-func getConverter(db dbQuerier, alias, driverName, converterName string) (sqlparser.SQLConverter, error) {
+func getConverter(db dbQuerier, alias, driverName, converterName, pagination string) (sqlparser.SQLConverter, error) {
 	//支持达梦DB，查询表唯一索引和主键，用于 (on duplicate key update)  ->  (merge into ... using dual on ... when matched then update ... when not matched then insert)
 	tableUniqueIndexs := map[string]map[string][]string{}
 	incrementColumns := map[string]map[string]int{}
@@ -125,36 +364,114 @@ func getConverter(db dbQuerier, alias, driverName, converterName string) (sqlpar
 
 	}
 
-	golog.Info("convertSQLPlugin", "wrapConverter", fmt.Sprintf("alias: %s, converterName: %s", alias, converterName), 0)
-	converter := sqlparser.GetSQLConverter(converterName, tableUniqueIndexs, tableColumns, incrementColumns)
+	golog.Info("convertSQLPlugin", "wrapConverter", fmt.Sprintf("alias: %s, converterName: %s, pagination: %s", alias, converterName, pagination), 0)
+	converter := sqlparser.GetSQLConverter(converterName, pagination, tableUniqueIndexs, tableColumns, incrementColumns)
+	if enumConverter, ok := converter.(sqlparser.EnumConverter); ok && driverName == "dm" {
+		if err = loadEnumColumns(db, alias, enumConverter); err != nil {
+			return nil, err
+		}
+	}
 
 	return converter, nil
 }
 
+// loadEnumColumns 从转换时生成的check约束中恢复由enum和set转换的列，约束名以_enum或_set结尾
+func loadEnumColumns(db dbQuerier, alias string, converter sqlparser.EnumConverter) error {
+	rows, err := db.Query(fmt.Sprintf(`select cc.table_name, cc.column_name, c.constraint_name from dba_constraints c, dba_cons_columns cc where c.constraint_name = cc.constraint_name and c.owner = '%s' and c.constraint_type = 'C'`, alias))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			tableName  string
+			columnName string
+			checkName  string
+		)
+		if err := rows.Scan(&tableName, &columnName, &checkName); err != nil {
+			return err
+		}
+		for _, typ := range []string{"enum", "set"} {
+			if strings.HasSuffix(checkName, "_"+typ) {
+				converter.SetEnumColumn(tableName, columnName, sqlparser.EnumColumn{Type: typ, Check: checkName})
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// getTableUniqueIndexs 查询表的主键、唯一约束和唯一索引，主键按sqlparser.PrimaryIndexName记录，
+// create unique index创建的索引没有约束，从dba_indexes中查询，与约束的列相同的索引不重复记录
 func getTableUniqueIndexs(db dbQuerier, alias string) (map[string]map[string][]string, error) {
-	rows, err := db.Query(fmt.Sprintf(`select cc.table_name, cc.constraint_name, cc.column_name from dba_constraints c, dba_cons_columns cc where c.constraint_name = cc.constraint_name and c.owner = '%s' and (c.constraint_type='U' or c.constraint_type='P')`, alias))
+	constraints := make(map[string]map[string][]string)
+	err := scanIndexColumns(db, fmt.Sprintf(`select cc.table_name, cc.constraint_name, c.constraint_type, cc.column_name from dba_constraints c, dba_cons_columns cc where c.constraint_name = cc.constraint_name and c.owner = '%s' and (c.constraint_type='U' or c.constraint_type='P') order by cc.position`, alias), constraints)
 	if err != nil {
 		return nil, err
 	}
-	constraints := make(map[string]map[string][]string)
+	indexs := make(map[string]map[string][]string)
+	err = scanIndexColumns(db, fmt.Sprintf(`select ic.table_name, ic.index_name, 'U', ic.column_name from dba_indexes i, dba_ind_columns ic where i.index_name = ic.index_name and i.owner = ic.index_owner and i.owner = '%s' and i.uniqueness = 'UNIQUE' order by ic.column_position`, alias), indexs)
+	if err != nil {
+		return nil, err
+	}
+	for tableName, tableIndexs := range indexs {
+		for indexName, columns := range tableIndexs {
+			if !hasIndexColumns(constraints[tableName], columns) {
+				if constraints[tableName] == nil {
+					constraints[tableName] = make(map[string][]string)
+				}
+				constraints[tableName][indexName] = columns
+			}
+		}
+	}
+	return constraints, nil
+}
+
+// scanIndexColumns 按表名、索引名、类型和列名查询索引的列，主键的索引名为sqlparser.PrimaryIndexName
+func scanIndexColumns(db dbQuerier, query string, indexs map[string]map[string][]string) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 	for rows.Next() {
 		var (
 			tableName  string
 			indexName  string
+			indexType  string
 			columnName string
 		)
-		if err1 := rows.Scan(&tableName, &indexName, &columnName); err1 != nil {
-			return nil, err
+		if err := rows.Scan(&tableName, &indexName, &indexType, &columnName); err != nil {
+			return err
 		}
-		if constraints[tableName] == nil {
-			constraints[tableName] = make(map[string][]string)
+		if indexType == "P" {
+			indexName = sqlparser.PrimaryIndexName
 		}
-		if constraints[tableName][indexName] == nil {
-			constraints[tableName][indexName] = []string{}
+		if indexs[tableName] == nil {
+			indexs[tableName] = make(map[string][]string)
 		}
-		constraints[tableName][indexName] = append(constraints[tableName][indexName], columnName)
+		indexs[tableName][indexName] = append(indexs[tableName][indexName], columnName)
 	}
-	return constraints, nil
+	return rows.Err()
+}
+
+// hasIndexColumns 判断是否已经有相同的列的索引
+func hasIndexColumns(indexs map[string][]string, columns []string) bool {
+	for _, cols := range indexs {
+		if len(cols) != len(columns) {
+			continue
+		}
+		same := true
+		for _, col := range columns {
+			if !sqlparser.StringIn(col, cols...) {
+				same = false
+				break
+			}
+		}
+		if same {
+			return true
+		}
+	}
+	return false
 }
 
 func getTableColumns(db dbQuerier, alias string) (map[string][]string, map[string]map[string]int, error) {
@@ -0,0 +1,60 @@
+package backend
+
+import (
+	"database/sql"
+
+	"sqlproxy/mysql"
+)
+
+// Cursor 持有后端查询打开的*sql.Rows，按需逐行读取，
+// 用于COM_STMT_FETCH服务端游标，调用方负责Close
+type Cursor struct {
+	driverName  string
+	rows        *sql.Rows
+	columnTypes []*sql.ColumnType
+}
+
+func (n *BackendProxy) OpenCursor(query string, args ...interface{}) (*Cursor, error) {
+	if n.db == nil {
+		return nil, ErrDbNullPointer
+	}
+
+	rows, err := n.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+
+	return &Cursor{
+		driverName:  n.cfg.DriverName,
+		rows:        rows,
+		columnTypes: columnTypes,
+	}, nil
+}
+
+func (c *Cursor) ColumnTypes() []*sql.ColumnType {
+	return c.columnTypes
+}
+
+// Fields 按驱动的类型映射构造Mysql列定义
+func (c *Cursor) Fields() ([]*mysql.Field, map[string]int) {
+	return mysql.BuildFields(c.driverName, c.columnTypes)
+}
+
+// Next 读取下一行，没有更多数据时返回nil, nil；
+// 返回的数据只在下一次调用Next之前有效
+func (c *Cursor) Next() ([]sql.RawBytes, error) {
+	if !c.rows.Next() {
+		return nil, c.rows.Err()
+	}
+	return readRow(c.driverName, c.columnTypes, c.rows)
+}
+
+func (c *Cursor) Close() error {
+	return c.rows.Close()
+}
@@ -0,0 +1,14 @@
+package backend
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var convertFailureTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "sqlproxy_convert_failures_total",
+	Help: "SQL statements the converter failed to convert, they are sent to the backend unchanged.",
+}, []string{"node"})
+
+func init() {
+	prometheus.MustRegister(convertFailureTotal)
+}
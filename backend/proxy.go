@@ -1,8 +1,10 @@
 package backend
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"sqlproxy/config"
 	"sqlproxy/core/golog"
 	"sqlproxy/mysql"
@@ -20,6 +22,7 @@ type BackendProxy struct {
 	cfg  config.NodeConfig
 	isTx bool             // 是否在事务中
 	db   dbQuerierWithCtx // 实现了sql.DB接口的对象，可以是sql.DB，也可以是其它包装后的对象
+	pool *sql.DB          // 连接池，用于统计连接数
 
 }
 
@@ -56,6 +59,7 @@ func (n *BackendProxy) InitConnectionPool() error {
 		return err
 	}
 	n.db = db
+	n.pool = pool
 
 	err = n.checkAvailable()
 	if err != nil {
@@ -66,6 +70,46 @@ func (n *BackendProxy) InitConnectionPool() error {
 	return nil
 }
 
+// Stats 返回连接池的统计信息，连接池未初始化时返回零值
+func (n *BackendProxy) Stats() sql.DBStats {
+	if n.pool == nil {
+		return sql.DBStats{}
+	}
+	return n.pool.Stats()
+}
+
+// SetRewriteRules 替换节点SQL转换的自定义规则，事务中的连接共用同一个转换器，不需要转换的节点忽略
+func (n *BackendProxy) SetRewriteRules(rules *sqlparser.RewriteRules) {
+	if n.db == nil {
+		return
+	}
+	if converter, ok := n.db.GetContext().Value(CTX_KEY_CONVERTER).(sqlparser.RuleConverter); ok {
+		converter.SetRewriteRules(rules)
+	}
+}
+
+// LookupEnumColumn 返回由enum或set转换的列的原始类型，用于结果集的列信息
+func (n *BackendProxy) LookupEnumColumn(table, column string) (sqlparser.EnumColumn, bool) {
+	if n.db == nil {
+		return sqlparser.EnumColumn{}, false
+	}
+	if converter, ok := n.db.GetContext().Value(CTX_KEY_CONVERTER).(sqlparser.EnumConverter); ok {
+		return converter.LookupEnumColumn(table, column)
+	}
+	return sqlparser.EnumColumn{}, false
+}
+
+// LookupKeyColumn 返回列是否属于主键，以及是否单独有唯一索引，用于结果集的列信息
+func (n *BackendProxy) LookupKeyColumn(table, column string) (primary, unique bool) {
+	if n.db == nil {
+		return false, false
+	}
+	if converter, ok := n.db.GetContext().Value(CTX_KEY_CONVERTER).(sqlparser.KeyConverter); ok {
+		return converter.LookupKeyColumn(table, column)
+	}
+	return false, false
+}
+
 func (n *BackendProxy) checkAvailable() error {
 	if n.db == nil {
 		return ErrDbNullPointer
@@ -82,11 +126,27 @@ func (n *BackendProxy) checkAvailable() error {
 }
 
 func (n *BackendProxy) Exec(query string, args ...interface{}) (*mysql.Result, error) {
+	return n.ExecContext(context.Background(), query, args...)
+}
+
+// ExecContext 执行语句，ctx中记录客户端的CLIENT_FOUND_ROWS，参见WithFoundRows
+func (n *BackendProxy) ExecContext(ctx context.Context, query string, args ...interface{}) (*mysql.Result, error) {
 	if n.db == nil {
 		return nil, ErrDbNullPointer
 	}
-
-	rs, err := n.db.Exec(query, args...)
+	var (
+		rs  sql.Result
+		err error
+	)
+	if db, ok := n.db.(ctxExecer); ok {
+		// 转换成的多条语句不在事务中时由转换插件从连接池取一个连接执行
+		if !n.isTx {
+			ctx = context.WithValue(ctx, CTX_KEY_POOL, n.pool)
+		}
+		rs, err = db.ExecContext(ctx, query, args...)
+	} else {
+		rs, err = n.db.Exec(query, args...)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -108,22 +168,15 @@ func (n *BackendProxy) Exec(query string, args ...interface{}) (*mysql.Result, e
 }
 
 func (n *BackendProxy) query(query string, args ...interface{}) ([][]sql.RawBytes, []*sql.ColumnType, error) {
-	if n.db == nil {
-		return nil, nil, ErrDbNullPointer
-	}
-
-	cursor, err := n.db.Query(query, args...)
+	cursor, err := n.OpenCursor(query, args...)
 	if err != nil {
 		return nil, nil, err
 	}
 	defer cursor.Close()
 	golog.Debug("BackendProxy", "query", "db...", 0)
 
-	columnTypes, err := cursor.ColumnTypes()
-	if err != nil {
-		return nil, nil, err
-	}
-	columnTypeNames := make([]string, len(columnTypes))
+	columnTypes := cursor.ColumnTypes()
+	columnTypeNames := make([]string, 0, len(columnTypes))
 	for _, column := range columnTypes {
 		columnTypeNames = append(columnTypeNames, column.Name())
 	}
@@ -131,11 +184,20 @@ func (n *BackendProxy) query(query string, args ...interface{}) ([][]sql.RawByte
 	golog.Debug("BackendProxy", "query", "", 0, "columnTypes", columnTypeNames)
 
 	rows := make([][]sql.RawBytes, 0)
-	for cursor.Next() {
-		values, err := readRow(n.cfg.DriverName, columnTypes, cursor)
+	for {
+		values, err := cursor.Next()
 		if err != nil {
 			return nil, nil, err
 		}
+		if values == nil {
+			break
+		}
+		// RawBytes可能引用驱动的缓冲区，缓存整个结果集前需要复制
+		for i, v := range values {
+			if v != nil {
+				values[i] = append(sql.RawBytes{}, v...)
+			}
+		}
 		rows = append(rows, values)
 	}
 	golog.Debug("BackendProxy", "query", "rows size", 0, len(rows), time.Now().UnixNano())
@@ -149,7 +211,7 @@ func (n *BackendProxy) Query(query string, args ...interface{}) (*mysql.Result,
 		return nil, err
 	}
 
-	rs, err := mysql.BuildResultset(rows, columnTypes, false)
+	rs, err := mysql.BuildResultset(n.cfg.DriverName, rows, columnTypes, false)
 	if err != nil {
 		return nil, err
 	}
@@ -168,7 +230,7 @@ func (n *BackendProxy) StmtQuery(query string, args ...interface{}) (*mysql.Resu
 		return nil, err
 	}
 
-	rs, err := mysql.BuildResultset(rows, columns, true)
+	rs, err := mysql.BuildResultset(n.cfg.DriverName, rows, columns, true)
 	if err != nil {
 		return nil, err
 	}
@@ -241,8 +303,35 @@ func wrapFunctions(db dbQuerierWithCtx, cfg config.NodeConfig) (dbQuerierWithCtx
 	db = wrapQueryLog(db, cfg.Name)
 	switch cfg.DriverName {
 	case "oci8", "dm":
-		return wrapConverter(db, cfg.Name, cfg.DriverName, sqlparser.MYSQL_TO_ORACLE)
+		pagination, err := paginationOf(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if db, err = wrapConverter(db, cfg.Name, cfg.DriverName, sqlparser.MYSQL_TO_ORACLE, pagination); err != nil {
+			return nil, err
+		}
+		if converter, ok := db.GetContext().Value(CTX_KEY_CONVERTER).(sqlparser.OnUpdateConverter); ok {
+			for table, columns := range cfg.OnUpdateColumns {
+				converter.SetOnUpdateColumns(table, columns)
+			}
+		}
+		return db, nil
 	default:
 		return db, nil
 	}
 }
+
+// paginationOf 返回节点limit转换的分页方式，未配置时达梦使用offset ... fetch，Oracle使用rownum
+func paginationOf(cfg config.NodeConfig) (string, error) {
+	switch cfg.Pagination {
+	case sqlparser.PAGINATION_OFFSET, sqlparser.PAGINATION_ROWNUM:
+		return cfg.Pagination, nil
+	case "":
+		if cfg.DriverName == "oci8" {
+			return sqlparser.PAGINATION_ROWNUM, nil
+		}
+		return sqlparser.PAGINATION_OFFSET, nil
+	default:
+		return "", fmt.Errorf("node %s: unknown pagination %s", cfg.Name, cfg.Pagination)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/golfxiao/dm"
 	"io"
 	"sqlproxy/core/golog"
+	"sqlproxy/mysql"
 	"strings"
 	"time"
 )
@@ -31,13 +32,7 @@ func readRow(driverName string, columnTypes []*sql.ColumnType, cursor *sql.Rows)
 			switch (*col.(*interface{})).(type) {
 			case time.Time:
 				v := (*col.(*interface{})).(time.Time)
-				tv := ""
-				switch columnTypes[i].DatabaseTypeName() {
-				case "DATE":
-					tv = v.Format("2006-01-02")
-				case "TIMESTAMP":
-					tv = v.Format("2006-01-02 15:04:05")
-				}
+				tv := formatTime(driverName, columnTypes[i], v)
 				values[i] = sql.RawBytes(strings.ReplaceAll(tv, "0001-01-01", "0000-00-00"))
 			default:
 				values[i] = nil
@@ -80,7 +75,7 @@ func readDmClob(dmClob *dm.DmClob) (sql.RawBytes, error) {
 func initializeColValue(driverName string, columnType *sql.ColumnType) interface{} {
 	scanType := driverName + "." + strings.ToUpper(columnType.DatabaseTypeName())
 	switch scanType {
-	case "dm.DATE", "dm.TIMESTAMP":
+	case "dm.DATE", "dm.TIME", "dm.DATETIME", "dm.TIMESTAMP", "oci8.DATE", "oci8.TIMESTAMP":
 		return new(interface{})
 	case "dm.CLOB", "dm.TEXT", "dm.LONGTEXT":
 		golog.Debug("BackendProxy", "initializeColValue", "DmClob", 0, "scanType", scanType)
@@ -90,3 +85,17 @@ func initializeColValue(driverName string, columnType *sql.ColumnType) interface
 	}
 
 }
+
+// formatTime 按列对应的Mysql类型格式化时间，与返回给客户端的列定义保持一致
+func formatTime(driverName string, columnType *sql.ColumnType, v time.Time) string {
+	fieldType, _ := mysql.LookupFieldType(driverName, columnType.DatabaseTypeName())
+	switch fieldType.Type {
+	case mysql.MYSQL_TYPE_DATE:
+		return v.Format("2006-01-02")
+	case mysql.MYSQL_TYPE_TIME:
+		return v.Format("15:04:05")
+	case mysql.MYSQL_TYPE_DATETIME, mysql.MYSQL_TYPE_TIMESTAMP:
+		return v.Format(mysql.TimeFormat)
+	}
+	return ""
+}
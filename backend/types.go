@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"context"
 	"database/sql"
 )
 
@@ -17,6 +18,11 @@ type dbQuerierWithCtx interface {
 	dbQuerier
 }
 
+// ctxExecer 执行语句时需要上下文，例如转换插件按客户端的CLIENT_FOUND_ROWS转换
+type ctxExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
 // transaction beginner
 type txer interface {
 	Begin() (*sql.Tx, error)
@@ -15,7 +15,10 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -31,7 +34,7 @@ type Config struct {
 
 	WebAddr     string `yaml:"web_addr"`
 	WebUser     string `yaml:"web_user"`
-	WebPassword string `yaml:"web_password"`
+	WebPassword string `yaml:"web_password" json:"-"`
 
 	LogPath     string       `yaml:"log_path"`
 	LogLevel    string       `yaml:"log_level"`
@@ -39,16 +42,27 @@ type Config struct {
 	SlowLogTime int          `yaml:"slow_log_time"`
 	AllowIps    string       `yaml:"allow_ips"`
 	BlsFile     string       `yaml:"blacklist_sql_file"`
+	RulesFile   string       `yaml:"rewrite_rules_file"` // 自定义SQL转换规则，可以通过api重新加载
 	Charset     string       `yaml:"proxy_charset"`
 	Nodes       []NodeConfig `yaml:"nodes"`
 
+	TLSCert                string `yaml:"tls_cert"`      // 证书文件，与tls_key同时配置时开启客户端TLS连接
+	TLSKey                 string `yaml:"tls_key"`       // 证书私钥文件
+	TLSClientCA            string `yaml:"tls_client_ca"` // 可选，配置后要求客户端提供该CA签发的证书
+	RequireSecureTransport bool   `yaml:"require_secure_transport"`
+
+	DefaultAuthPlugin string `yaml:"default_auth_plugin,omitempty"` // 握手时默认的认证插件，默认为mysql_native_password
+
 	SchemaList []SchemaConfig `yaml:"schema_list"`
 }
 
 // user_list对应的配置
 type UserConfig struct {
-	User     string `yaml:"user"`
-	Password string `yaml:"password"`
+	User         string `yaml:"user"`
+	Password     string `yaml:"password,omitempty" json:"-"`
+	PasswordHash string `yaml:"password_hash,omitempty" json:"-"` // MySQL PASSWORD()格式的SHA1(SHA1(pwd))，与password二选一，可用sqlproxy passwd生成
+	AllowIps     string `yaml:"allow_ips,omitempty"`              // 该用户允许登录的ip或ip段，为空则只受全局allow_ips限制
+	AuthPlugin   string `yaml:"auth_plugin,omitempty"`            // mysql_native_password或caching_sha2_password，为空则使用default_auth_plugin
 }
 
 // node节点对应的配置
@@ -59,6 +73,41 @@ type NodeConfig struct {
 	MaxOpenConns int    `yaml:"max_conns_limit"`
 	MaxLifeTime  int    `yaml:"max_life_time"`
 	TestSQL      string `yaml:"test_sql"`
+	Pagination   string `yaml:"pagination,omitempty"` // limit转换的分页方式offset或rownum，为空时达梦为offset，Oracle为rownum
+	// 表名 -> on update current_timestamp的列，用于没有触发器的表，update时设置为当前时间
+	OnUpdateColumns map[string][]string `yaml:"on_update_columns,omitempty"`
+}
+
+// String隐藏datasource中的密码，用于日志输出
+func (n NodeConfig) String() string {
+	return fmt.Sprintf("{Name:%s DriverName:%s Datasource:%s MaxOpenConns:%d MaxLifeTime:%d TestSQL:%s Pagination:%s}",
+		n.Name, n.DriverName, MaskDatasource(n.Datasource), n.MaxOpenConns, n.MaxLifeTime, n.TestSQL, n.Pagination)
+}
+
+// MarshalJSON隐藏datasource中的密码，用于api输出
+func (n NodeConfig) MarshalJSON() ([]byte, error) {
+	type nodeConfig NodeConfig
+	masked := nodeConfig(n)
+	masked.Datasource = MaskDatasource(n.Datasource)
+	return json.Marshal(masked)
+}
+
+// MaskDatasource将datasource中user:password@的密码替换为***，
+// 支持dm://user:pwd@host:port和user:pwd@tcp(host:port)/db两种格式
+func MaskDatasource(datasource string) string {
+	at := strings.LastIndex(datasource, "@")
+	if at < 0 {
+		return datasource
+	}
+	start := 0
+	if i := strings.Index(datasource[:at], "://"); i >= 0 {
+		start = i + 3
+	}
+	colon := strings.Index(datasource[start:at], ":")
+	if colon < 0 {
+		return datasource
+	}
+	return datasource[:start+colon+1] + "***" + datasource[at:]
 }
 
 // schema对应的结构体
@@ -71,6 +71,7 @@ var (
 	ErrBlackSqlNotExist = errors.New("black sql has not exist")
 	ErrInsertTooComplex = errors.New("insert is too complex")
 	ErrSQLNULL          = errors.New("sql is null")
+	ErrNoRulesFile      = errors.New("rewrite rules file is not set")
 
 	ErrInternalServer   = errors.New("internal server error")
 )
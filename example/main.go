@@ -26,7 +26,7 @@ func readSqlFile(filePath string) ([]byte, error) {
 
 func parserContent(content []byte) {
 	sqls := strings.Split(string(content), ";")
-	converter := sqlparser.GetSQLConverter(sqlparser.MYSQL_TO_ORACLE, nil, nil, nil)
+	converter := sqlparser.GetSQLConverter(sqlparser.MYSQL_TO_ORACLE, "", nil, nil, nil)
 
 	for _, sql := range sqls {
 		sql = strings.TrimSpace(sql)
@@ -47,7 +47,7 @@ func parserContent(content []byte) {
 				if v[0] == 47 {
 					continue
 				}
-				_, res, _, err := converter.Convert(sql)
+				res, _, err := converter.Convert(sql)
 				if err != nil {
 					fmt.Println(sql)
 					panic(err)
@@ -55,7 +55,7 @@ func parserContent(content []byte) {
 				fmt.Println(res[0])
 			}
 		default:
-			_, res, _, err := converter.Convert(sql)
+			res, _, err := converter.Convert(sql)
 			if err != nil {
 				panic(err)
 			}
@@ -15,8 +15,10 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path"
@@ -27,6 +29,7 @@ import (
 	"sqlproxy/config"
 
 	"sqlproxy/core/golog"
+	"sqlproxy/mysql"
 
 	"sqlproxy/server"
 
@@ -58,6 +61,10 @@ const banner string = `
 `
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "passwd" {
+		os.Exit(passwd(os.Args[2:]))
+	}
+
 	fmt.Print(banner)
 	runtime.GOMAXPROCS(runtime.NumCPU())
 	flag.Parse()
@@ -158,6 +165,29 @@ func main() {
 	svr.Run()
 }
 
+// passwd prints the password_hash of user_list for the password given as
+// argument or read from stdin: sqlproxy passwd [password]
+func passwd(args []string) int {
+	var password string
+	if len(args) > 0 {
+		password = args[0]
+	} else {
+		fmt.Fprint(os.Stderr, "Enter password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			fmt.Fprintf(os.Stderr, "read password error:%v\n", err.Error())
+			return 1
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if len(password) == 0 {
+		fmt.Fprintln(os.Stderr, "password is empty")
+		return 1
+	}
+	fmt.Println(mysql.EncodePassword(password))
+	return 0
+}
+
 func setLogLevel(level string) {
 	switch strings.ToLower(level) {
 	case "debug":
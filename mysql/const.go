@@ -14,6 +14,8 @@
 
 package mysql
 
+import "math"
+
 const (
 	MinProtocolVersion byte   = 10
 	MaxPayloadLen      int    = 1<<24 - 1
@@ -44,6 +46,14 @@ const (
 	SERVER_PS_OUT_PARAMS               uint16 = 0x1000
 )
 
+// flags of COM_STMT_EXECUTE
+const (
+	CURSOR_TYPE_NO_CURSOR  byte = 0x00
+	CURSOR_TYPE_READ_ONLY  byte = 0x01
+	CURSOR_TYPE_FOR_UPDATE byte = 0x02
+	CURSOR_TYPE_SCROLLABLE byte = 0x04
+)
+
 const (
 	COM_SLEEP byte = iota
 	COM_QUIT
@@ -158,6 +168,19 @@ const (
 
 const (
 	AUTH_NAME = "mysql_native_password"
+
+	AUTH_NATIVE_PASSWORD       = "mysql_native_password"
+	AUTH_CACHING_SHA2_PASSWORD = "caching_sha2_password"
+)
+
+// auth switch and caching_sha2_password packets
+const (
+	AUTH_MORE_DATA_HEADER byte = 0x01
+	AUTH_SWITCH_HEADER    byte = 0xfe
+
+	CACHING_SHA2_REQUEST_PUBLIC_KEY byte = 0x02
+	CACHING_SHA2_FAST_AUTH_SUCCESS  byte = 0x03
+	CACHING_SHA2_PERFORM_FULL_AUTH  byte = 0x04
 )
 
 var (
@@ -266,14 +289,81 @@ var (
 		COM_RESET_CONNECTION:    "COM_RESET_CONNECTION",
 	}
 
-	FIELD_TYPE_MAP = map[string]byte{
-		"VARCHAR":   MYSQL_TYPE_VAR_STRING,
-		"INT":       MYSQL_TYPE_LONG,
-		"DECIMAL":   MYSQL_TYPE_DECIMAL,
-		"BIGINT":    MYSQL_TYPE_LONGLONG,
-		"TINYINT":   MYSQL_TYPE_TINY,
-		"SMALLINT":  MYSQL_TYPE_SHORT,
-		"TIMESTAMP": MYSQL_TYPE_TIMESTAMP,
-		//"DATE":      MYSQL_TYPE_DATE,
+	// 达梦类型到Mysql列类型的映射，也是未注册类型表的驱动的默认映射
+	FIELD_TYPE_MAP = map[string]FieldType{
+		"CHAR":        {Type: MYSQL_TYPE_STRING},
+		"CHARACTER":   {Type: MYSQL_TYPE_STRING},
+		"VARCHAR":     {Type: MYSQL_TYPE_VAR_STRING},
+		"VARCHAR2":    {Type: MYSQL_TYPE_VAR_STRING},
+		"ROWID":       {Type: MYSQL_TYPE_VAR_STRING, Length: 18 * defaultCharsetMaxLen},
+		"TEXT":        {Type: MYSQL_TYPE_BLOB, Flag: BLOB_FLAG, Length: math.MaxUint32},
+		"LONGVARCHAR": {Type: MYSQL_TYPE_BLOB, Flag: BLOB_FLAG, Length: math.MaxUint32},
+		"LONGTEXT":    {Type: MYSQL_TYPE_BLOB, Flag: BLOB_FLAG, Length: math.MaxUint32},
+		"CLOB":        {Type: MYSQL_TYPE_BLOB, Flag: BLOB_FLAG, Length: math.MaxUint32},
+
+		"BINARY":        {Type: MYSQL_TYPE_STRING, Flag: BINARY_FLAG},
+		"VARBINARY":     {Type: MYSQL_TYPE_VAR_STRING, Flag: BINARY_FLAG},
+		"RAW":           {Type: MYSQL_TYPE_VAR_STRING, Flag: BINARY_FLAG},
+		"BLOB":          {Type: MYSQL_TYPE_BLOB, Flag: BLOB_FLAG | BINARY_FLAG, Length: math.MaxUint32},
+		"IMAGE":         {Type: MYSQL_TYPE_BLOB, Flag: BLOB_FLAG | BINARY_FLAG, Length: math.MaxUint32},
+		"LONGVARBINARY": {Type: MYSQL_TYPE_BLOB, Flag: BLOB_FLAG | BINARY_FLAG, Length: math.MaxUint32},
+
+		//达梦的BIT只有0和1，对应Mysql的tinyint(1)
+		"BIT":              {Type: MYSQL_TYPE_TINY, Flag: NUM_FLAG, Length: 1},
+		"BOOLEAN":          {Type: MYSQL_TYPE_TINY, Flag: NUM_FLAG, Length: 1},
+		"BYTE":             {Type: MYSQL_TYPE_TINY, Flag: NUM_FLAG, Length: 4},
+		"TINYINT":          {Type: MYSQL_TYPE_TINY, Flag: NUM_FLAG, Length: 4},
+		"SMALLINT":         {Type: MYSQL_TYPE_SHORT, Flag: NUM_FLAG, Length: 6},
+		"INT":              {Type: MYSQL_TYPE_LONG, Flag: NUM_FLAG, Length: 11},
+		"INTEGER":          {Type: MYSQL_TYPE_LONG, Flag: NUM_FLAG, Length: 11},
+		"PLS_INTEGER":      {Type: MYSQL_TYPE_LONG, Flag: NUM_FLAG, Length: 11},
+		"BIGINT":           {Type: MYSQL_TYPE_LONGLONG, Flag: NUM_FLAG, Length: 20},
+		"DECIMAL":          {Type: MYSQL_TYPE_NEWDECIMAL, Flag: NUM_FLAG, Length: 40},
+		"DEC":              {Type: MYSQL_TYPE_NEWDECIMAL, Flag: NUM_FLAG, Length: 40},
+		"NUMERIC":          {Type: MYSQL_TYPE_NEWDECIMAL, Flag: NUM_FLAG, Length: 40},
+		"NUMBER":           {Type: MYSQL_TYPE_NEWDECIMAL, Flag: NUM_FLAG, Length: 40},
+		"REAL":             {Type: MYSQL_TYPE_FLOAT, Flag: NUM_FLAG, Length: 12, Decimal: NOT_FIXED_DEC},
+		"FLOAT":            {Type: MYSQL_TYPE_DOUBLE, Flag: NUM_FLAG, Length: 22, Decimal: NOT_FIXED_DEC},
+		"DOUBLE":           {Type: MYSQL_TYPE_DOUBLE, Flag: NUM_FLAG, Length: 22, Decimal: NOT_FIXED_DEC},
+		"DOUBLE PRECISION": {Type: MYSQL_TYPE_DOUBLE, Flag: NUM_FLAG, Length: 22, Decimal: NOT_FIXED_DEC},
+
+		"DATE":      {Type: MYSQL_TYPE_DATE, Flag: BINARY_FLAG, Length: 10},
+		"TIME":      {Type: MYSQL_TYPE_TIME, Flag: BINARY_FLAG, Length: 10},
+		"DATETIME":  {Type: MYSQL_TYPE_DATETIME, Flag: BINARY_FLAG, Length: 19},
+		"TIMESTAMP": {Type: MYSQL_TYPE_DATETIME, Flag: BINARY_FLAG, Length: 19},
+		//带时区的时间Mysql中没有对应类型，按字符串返回
+		"TIME WITH TIME ZONE":            {Type: MYSQL_TYPE_VAR_STRING},
+		"TIMESTAMP WITH TIME ZONE":       {Type: MYSQL_TYPE_VAR_STRING},
+		"TIMESTAMP WITH LOCAL TIME ZONE": {Type: MYSQL_TYPE_VAR_STRING},
+		"DATETIME WITH TIME ZONE":        {Type: MYSQL_TYPE_VAR_STRING},
+	}
+
+	// Oracle类型到Mysql列类型的映射
+	ORACLE_FIELD_TYPE_MAP = map[string]FieldType{
+		"CHAR":      {Type: MYSQL_TYPE_STRING},
+		"NCHAR":     {Type: MYSQL_TYPE_STRING},
+		"VARCHAR":   {Type: MYSQL_TYPE_VAR_STRING},
+		"VARCHAR2":  {Type: MYSQL_TYPE_VAR_STRING},
+		"NVARCHAR2": {Type: MYSQL_TYPE_VAR_STRING},
+		"ROWID":     {Type: MYSQL_TYPE_VAR_STRING, Length: 18 * defaultCharsetMaxLen},
+		"UROWID":    {Type: MYSQL_TYPE_VAR_STRING},
+		"LONG":      {Type: MYSQL_TYPE_BLOB, Flag: BLOB_FLAG, Length: math.MaxUint32},
+		"CLOB":      {Type: MYSQL_TYPE_BLOB, Flag: BLOB_FLAG, Length: math.MaxUint32},
+		"NCLOB":     {Type: MYSQL_TYPE_BLOB, Flag: BLOB_FLAG, Length: math.MaxUint32},
+
+		"RAW":      {Type: MYSQL_TYPE_VAR_STRING, Flag: BINARY_FLAG},
+		"LONG RAW": {Type: MYSQL_TYPE_BLOB, Flag: BLOB_FLAG | BINARY_FLAG, Length: math.MaxUint32},
+		"BLOB":     {Type: MYSQL_TYPE_BLOB, Flag: BLOB_FLAG | BINARY_FLAG, Length: math.MaxUint32},
+
+		"NUMBER":        {Type: MYSQL_TYPE_NEWDECIMAL, Flag: NUM_FLAG, Length: 40},
+		"FLOAT":         {Type: MYSQL_TYPE_DOUBLE, Flag: NUM_FLAG, Length: 22, Decimal: NOT_FIXED_DEC},
+		"BINARY_FLOAT":  {Type: MYSQL_TYPE_FLOAT, Flag: NUM_FLAG, Length: 12, Decimal: NOT_FIXED_DEC},
+		"BINARY_DOUBLE": {Type: MYSQL_TYPE_DOUBLE, Flag: NUM_FLAG, Length: 22, Decimal: NOT_FIXED_DEC},
+
+		//Oracle的DATE包含时分秒
+		"DATE":                           {Type: MYSQL_TYPE_DATETIME, Flag: BINARY_FLAG, Length: 19},
+		"TIMESTAMP":                      {Type: MYSQL_TYPE_DATETIME, Flag: BINARY_FLAG, Length: 19},
+		"TIMESTAMP WITH TIME ZONE":       {Type: MYSQL_TYPE_VAR_STRING},
+		"TIMESTAMP WITH LOCAL TIME ZONE": {Type: MYSQL_TYPE_VAR_STRING},
 	}
 )
@@ -882,3 +882,8 @@ const (
 	ER_ROW_IN_WRONG_PARTITION                                                  = 1863
 	ER_ERROR_LAST                                                              = 1863
 )
+
+// error codes added after MySQL 5.6
+const (
+	ER_SECURE_TRANSPORT_REQUIRED = 3159
+)
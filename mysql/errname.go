@@ -436,7 +436,7 @@ var MySQLErrName = map[uint16]string{
 	ER_BINLOG_UNSAFE_ROUTINE:                         "This function has none of DETERMINISTIC, NO SQL, or READS SQL DATA in its declaration and binary logging is enabled (you *might* want to use the less safe log_bin_trust_function_creators variable)",
 	ER_BINLOG_CREATE_ROUTINE_NEED_SUPER:              "You do not have the SUPER privilege and binary logging is enabled (you *might* want to use the less safe log_bin_trust_function_creators variable)",
 	ER_EXEC_STMT_WITH_OPEN_CURSOR:                    "You can't execute a prepared statement which has an open cursor associated with it. Reset the statement to re-execute it.",
-	ER_STMT_HAS_NO_OPEN_CURSOR:                       "The statement (%lu) has no open cursor.",
+	ER_STMT_HAS_NO_OPEN_CURSOR:                       "The statement (%d) has no open cursor.",
 	ER_COMMIT_NOT_ALLOWED_IN_SF_OR_TRG:               "Explicit or implicit commit is not allowed in stored function or trigger.",
 	ER_NO_DEFAULT_FOR_VIEW_FIELD:                     "Field of view '%-.192s.%-.192s' underlying table doesn't have a default value",
 	ER_SP_NO_RECURSION:                               "Recursive stored functions and triggers are not allowed.",
@@ -879,4 +879,5 @@ var MySQLErrName = map[uint16]string{
 	ER_ALTER_OPERATION_NOT_SUPPORTED_REASON_NOT_NULL:                    "cannot silently convert NULL values, as required in this SQL_MODE",
 	ER_MUST_CHANGE_PASSWORD_LOGIN:                                       "Your password has expired. To log in you must change it using a client that supports expired passwords.",
 	ER_ROW_IN_WRONG_PARTITION:                                           "Found a row in wrong partition %s",
+	ER_SECURE_TRANSPORT_REQUIRED:                                        "Connections using insecure transport are prohibited while --require_secure_transport=ON.",
 }
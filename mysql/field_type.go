@@ -0,0 +1,148 @@
+package mysql
+
+import (
+	"database/sql"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FieldType 后端数据库类型对应的Mysql列类型，
+// Length和Decimal是驱动没有返回长度和精度时使用的默认值
+type FieldType struct {
+	Type    uint8
+	Flag    uint16
+	Length  uint32
+	Decimal uint8
+}
+
+// 浮点数没有固定精度时Decimal的取值
+const NOT_FIXED_DEC = 31
+
+// 字符集utf8每个字符最多占用的字节数，字符串类型的列长度按字节计算
+const defaultCharsetMaxLen = 3
+
+var fieldTypes = struct {
+	sync.RWMutex
+	m map[string]map[string]FieldType
+}{m: map[string]map[string]FieldType{
+	"dm":   FIELD_TYPE_MAP,
+	"oci8": ORACLE_FIELD_TYPE_MAP,
+}}
+
+// RegisterFieldTypes 为驱动注册或覆盖类型映射，typeName为驱动返回的DatabaseTypeName，
+// 没有注册过类型的驱动使用达梦的类型表FIELD_TYPE_MAP
+func RegisterFieldTypes(driverName string, types map[string]FieldType) {
+	fieldTypes.Lock()
+	defer fieldTypes.Unlock()
+
+	m, ok := fieldTypes.m[driverName]
+	if !ok {
+		m = make(map[string]FieldType, len(types))
+		fieldTypes.m[driverName] = m
+	}
+	for typeName, t := range types {
+		m[strings.ToUpper(typeName)] = t
+	}
+}
+
+// LookupFieldType 查找驱动的类型映射
+func LookupFieldType(driverName string, typeName string) (FieldType, bool) {
+	fieldTypes.RLock()
+	defer fieldTypes.RUnlock()
+
+	m, ok := fieldTypes.m[driverName]
+	if !ok {
+		m = FIELD_TYPE_MAP
+	}
+	t, ok := m[strings.ToUpper(typeName)]
+	return t, ok
+}
+
+// scanFieldType 类型表中没有的类型，根据驱动的ScanType推断
+func scanFieldType(scanType reflect.Type) FieldType {
+	if scanType == nil {
+		return FieldType{Type: MYSQL_TYPE_VAR_STRING}
+	}
+	if scanType.Kind() == reflect.Ptr {
+		scanType = scanType.Elem()
+	}
+	switch scanType.Kind() {
+	case reflect.Bool:
+		return FieldType{Type: MYSQL_TYPE_TINY, Flag: NUM_FLAG, Length: 1}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		return FieldType{Type: MYSQL_TYPE_LONGLONG, Flag: NUM_FLAG, Length: 20}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		return FieldType{Type: MYSQL_TYPE_LONGLONG, Flag: NUM_FLAG | UNSIGNED_FLAG, Length: 20}
+	case reflect.Float32:
+		return FieldType{Type: MYSQL_TYPE_FLOAT, Flag: NUM_FLAG, Length: 12, Decimal: NOT_FIXED_DEC}
+	case reflect.Float64:
+		return FieldType{Type: MYSQL_TYPE_DOUBLE, Flag: NUM_FLAG, Length: 22, Decimal: NOT_FIXED_DEC}
+	}
+	if scanType == reflect.TypeOf(time.Time{}) {
+		return FieldType{Type: MYSQL_TYPE_DATETIME, Flag: BINARY_FLAG, Length: 19}
+	}
+	return FieldType{Type: MYSQL_TYPE_VAR_STRING}
+}
+
+func isBinaryFieldType(t FieldType) bool {
+	return t.Flag&BINARY_FLAG != 0
+}
+
+// BuildField 根据database/sql返回的列信息构造Mysql列定义，
+// database/sql没有提供列所属的表和主键信息，这些由server的setFieldsTable按查询的表
+// 和转换器记录的主键、唯一索引补充
+func BuildField(driverName string, column *sql.ColumnType) *Field {
+	t, ok := LookupFieldType(driverName, column.DatabaseTypeName())
+	if !ok {
+		t = scanFieldType(column.ScanType())
+	}
+
+	field := &Field{
+		Name:         []byte(column.Name()),
+		OrgName:      []byte(column.Name()),
+		Charset:      uint16(DEFAULT_COLLATION_ID),
+		Type:         t.Type,
+		Flag:         t.Flag,
+		ColumnLength: t.Length,
+		Decimal:      t.Decimal,
+	}
+	if isBinaryFieldType(t) || t.Flag&NUM_FLAG != 0 {
+		field.Charset = uint16(CollationNames["binary"])
+	}
+
+	if nullable, ok := column.Nullable(); ok && !nullable {
+		field.Flag |= NOT_NULL_FLAG
+	}
+
+	switch t.Type {
+	case MYSQL_TYPE_DECIMAL, MYSQL_TYPE_NEWDECIMAL:
+		if precision, scale, ok := column.DecimalSize(); ok && precision > 0 {
+			//符号位和小数点
+			length := precision + 1
+			if scale > 0 {
+				length++
+			}
+			field.ColumnLength = uint32(length)
+			field.Decimal = uint8(scale)
+		}
+	case MYSQL_TYPE_FLOAT, MYSQL_TYPE_DOUBLE:
+		if _, scale, ok := column.DecimalSize(); ok && scale > 0 && scale < NOT_FIXED_DEC {
+			field.Decimal = uint8(scale)
+		}
+	case MYSQL_TYPE_VARCHAR, MYSQL_TYPE_VAR_STRING, MYSQL_TYPE_STRING,
+		MYSQL_TYPE_TINY_BLOB, MYSQL_TYPE_BLOB, MYSQL_TYPE_MEDIUM_BLOB, MYSQL_TYPE_LONG_BLOB:
+		if length, ok := column.Length(); ok && length > 0 {
+			if !isBinaryFieldType(t) {
+				length *= defaultCharsetMaxLen
+			}
+			if length > math.MaxUint32 || length < 0 {
+				length = math.MaxUint32
+			}
+			field.ColumnLength = uint32(length)
+		}
+	}
+	return field
+}
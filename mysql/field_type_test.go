@@ -0,0 +1,35 @@
+package mysql
+
+import (
+	"testing"
+)
+
+func TestLookupFieldType(t *testing.T) {
+	tests := []struct {
+		driverName string
+		typeName   string
+		typ        uint8
+		ok         bool
+	}{
+		{"dm", "varchar2", MYSQL_TYPE_VAR_STRING, true},
+		{"dm", "DATE", MYSQL_TYPE_DATE, true},
+		{"oci8", "DATE", MYSQL_TYPE_DATETIME, true},
+		//未注册类型表的驱动使用达梦的类型表
+		{"mysql", "BIGINT", MYSQL_TYPE_LONGLONG, true},
+		{"dm", "INTERVAL DAY", 0, false},
+	}
+	for _, tt := range tests {
+		ft, ok := LookupFieldType(tt.driverName, tt.typeName)
+		if ok != tt.ok || ft.Type != tt.typ {
+			t.Errorf("%s %s: got %v %v", tt.driverName, tt.typeName, ft, ok)
+		}
+	}
+
+	RegisterFieldTypes("testdb", map[string]FieldType{"money": {Type: MYSQL_TYPE_NEWDECIMAL, Flag: NUM_FLAG}})
+	if ft, ok := LookupFieldType("testdb", "MONEY"); !ok || ft.Type != MYSQL_TYPE_NEWDECIMAL {
+		t.Errorf("registered type: got %v %v", ft, ok)
+	}
+	if _, ok := LookupFieldType("testdb", "VARCHAR"); ok {
+		t.Error("registered driver should not fall back to the dm types")
+	}
+}
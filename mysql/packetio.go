@@ -16,6 +16,7 @@ package mysql
 
 import (
 	"bufio"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
@@ -43,6 +44,32 @@ func NewPacketIO(conn net.Conn) *PacketIO {
 	return p
 }
 
+// bufferedConn reads through the reader of PacketIO, so the bytes of the TLS
+// handshake that were already buffered from the raw connection are not lost
+type bufferedConn struct {
+	net.Conn
+	rb *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.rb.Read(b)
+}
+
+// UpgradeTLS runs the server side TLS handshake on conn after an SSLRequest
+// packet, then switches the PacketIO to the TLS connection. The sequence
+// number is kept, the handshake response continues from it.
+func (p *PacketIO) UpgradeTLS(conn net.Conn, config *tls.Config) (*tls.Conn, error) {
+	tlsConn := tls.Server(&bufferedConn{Conn: conn, rb: p.rb}, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+
+	p.rb = bufio.NewReaderSize(tlsConn, defaultReaderSize)
+	p.wb = tlsConn
+
+	return tlsConn, nil
+}
+
 func (p *PacketIO) ReadPacket() ([]byte, error) {
 	header := []byte{0, 0, 0, 0}
 
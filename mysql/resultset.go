@@ -19,6 +19,7 @@ import (
 	"database/sql"
 	"encoding/binary"
 	"fmt"
+	"math"
 	"strconv"
 
 	"sqlproxy/core/hack"
@@ -115,7 +116,7 @@ func (p RowData) ParseBinary(f []*Field) ([]interface{}, error) {
 			if isUnsigned {
 				data[i] = uint64(p[pos])
 			} else {
-				data[i] = int64(p[pos])
+				data[i] = int64(int8(p[pos]))
 			}
 			pos++
 			continue
@@ -461,9 +462,9 @@ func (r *Resultset) GetStringByName(row int, name string) (string, error) {
 }
 
 // Add: 将database/sql返回的标准数据重新封装成Mysql结果集
-func BuildResultset(rows [][]sql.RawBytes, columnTypes []*sql.ColumnType, binary bool) (*Resultset, error) {
+func BuildResultset(driverName string, rows [][]sql.RawBytes, columnTypes []*sql.ColumnType, binary bool) (*Resultset, error) {
 
-	fields, fieldNames := buildFields(columnTypes, binary)
+	fields, fieldNames := BuildFields(driverName, columnTypes)
 	r := &Resultset{
 		Fields:     fields,
 		FieldNames: fieldNames,
@@ -472,7 +473,7 @@ func BuildResultset(rows [][]sql.RawBytes, columnTypes []*sql.ColumnType, binary
 	}
 
 	for i, row := range rows {
-		rowData, err := r.packetRowData(row, binary)
+		rowData, err := PacketRowData(r.Fields, row, binary)
 		if err != nil {
 			return nil, err
 		}
@@ -485,31 +486,22 @@ func BuildResultset(rows [][]sql.RawBytes, columnTypes []*sql.ColumnType, binary
 	}
 	return r, nil
 }
-func buildFields(columns []*sql.ColumnType, binary bool) ([]*Field, map[string]int) {
+
+// BuildFields 根据database/sql返回的列信息构造Mysql列定义
+func BuildFields(driverName string, columns []*sql.ColumnType) ([]*Field, map[string]int) {
 	fields := make([]*Field, len(columns))
 	fieldNames := make(map[string]int, len(columns))
 	for i, column := range columns {
-		field := &Field{
-			Name: []byte(column.Name()),
-			//Charset: 63,
-			Flag: BINARY_FLAG,
-			Type: MYSQL_TYPE_VAR_STRING,
-		}
-		if !binary {
-			fieldTypeName := column.DatabaseTypeName()
-			if fieldType, ok := FIELD_TYPE_MAP[fieldTypeName]; ok {
-				field.Type = fieldType
-			}
-		}
-		fields[i] = field
+		fields[i] = BuildField(driverName, column)
 		fieldNames[column.Name()] = i
 	}
 	return fields, fieldNames
 }
 
-func (r *Resultset) packetRowData(row []sql.RawBytes, binary bool) (RowData, error) {
+// PacketRowData 将一行数据按文本协议或二进制协议编码
+func PacketRowData(fields []*Field, row []sql.RawBytes, binary bool) (RowData, error) {
 	if binary {
-		return packetBinaryRowData(r.Fields, row)
+		return packetBinaryRowData(fields, row)
 	} else {
 		return packetTextRowData(row)
 	}
@@ -543,42 +535,109 @@ func packetTextRowData(row []sql.RawBytes) (RowData, error) {
 	return RowData(data), nil
 }
 
-// 转换成二进制协议的结果集
-// 由于database/sql这个标准接口层已经丢失了字段的具体数据类型，这里只能暂且都按照字符串类型来构造
+// 转换成二进制协议的结果集，按列类型将文本值编码为二进制格式
 func packetBinaryRowData(fields []*Field, row []sql.RawBytes) (RowData, error) {
-	length := 0
 	nullBitMapLen := (len(fields) + 7 + 2) / 8
+	length := 1 + nullBitMapLen
 	for _, val := range row {
 		if val != nil {
-			l := len(val)
-			length += LenEncIntSize(uint64(l)) + l
+			length += 9 + len(val)
 		}
 	}
 
-	length += nullBitMapLen + 1
-
-	data := make([]byte, 0, length)
-	pos := 0
-
-	data = append(data, 0x00)
-
-	for i := 0; i < nullBitMapLen; i++ {
-		data = append(data, 0x00)
-	}
+	data := make([]byte, 1+nullBitMapLen, length)
+	data[0] = OK_HEADER
 
+	var err error
 	for i, val := range row {
 		if val == nil {
 			bytePos := (i+2)/8 + 1
 			bitPos := (i + 2) % 8
 			data[bytePos] |= 1 << uint(bitPos)
-		} else {
-			data = append(data, PutLengthEncodedString(val)...)
+			continue
+		}
+		if data, err = appendBinaryValue(data, fields[i], val); err != nil {
+			return nil, err
 		}
 	}
 
-	if len(data) != length {
-		return nil, fmt.Errorf("internal error packet row: got %v bytes but expected %v", pos, length)
+	return data, nil
+}
+
+func appendBinaryValue(data []byte, f *Field, val []byte) ([]byte, error) {
+	switch f.Type {
+	case MYSQL_TYPE_TINY, MYSQL_TYPE_SHORT, MYSQL_TYPE_YEAR, MYSQL_TYPE_INT24,
+		MYSQL_TYPE_LONG, MYSQL_TYPE_LONGLONG:
+		n, err := parseBinaryInt(f, val)
+		if err != nil {
+			return nil, err
+		}
+		switch f.Type {
+		case MYSQL_TYPE_TINY:
+			return append(data, byte(n)), nil
+		case MYSQL_TYPE_SHORT, MYSQL_TYPE_YEAR:
+			return append(data, Uint16ToBytes(uint16(n))...), nil
+		case MYSQL_TYPE_INT24, MYSQL_TYPE_LONG:
+			return append(data, Uint32ToBytes(uint32(n))...), nil
+		default:
+			return append(data, Uint64ToBytes(n)...), nil
+		}
+
+	case MYSQL_TYPE_FLOAT:
+		v, err := strconv.ParseFloat(string(val), 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float value %q of column %s", val, f.Name)
+		}
+		return append(data, Uint32ToBytes(math.Float32bits(float32(v)))...), nil
+
+	case MYSQL_TYPE_DOUBLE:
+		v, err := strconv.ParseFloat(string(val), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid double value %q of column %s", val, f.Name)
+		}
+		return append(data, Uint64ToBytes(math.Float64bits(v))...), nil
+
+	case MYSQL_TYPE_DATE, MYSQL_TYPE_NEWDATE, MYSQL_TYPE_DATETIME, MYSQL_TYPE_TIMESTAMP:
+		v, err := PutBinaryDateTime(val)
+		if err != nil {
+			return nil, err
+		}
+		return append(data, v...), nil
+
+	case MYSQL_TYPE_TIME:
+		v, err := PutBinaryTime(val)
+		if err != nil {
+			return nil, err
+		}
+		return append(data, v...), nil
+
+	default:
+		//DECIMAL和字符串、二进制类型都按长度编码的字符串传输
+		return append(data, PutLengthEncodedString(val)...), nil
 	}
+}
 
-	return data, nil
+// parseBinaryInt 解析整数的文本值，返回补码形式，
+// database/sql将驱动返回的bool转为RawBytes时是true/false
+func parseBinaryInt(f *Field, val []byte) (uint64, error) {
+	s := string(val)
+	switch s {
+	case "true":
+		return 1, nil
+	case "false":
+		return 0, nil
+	}
+
+	if f.Flag&UNSIGNED_FLAG != 0 {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid integer value %q of column %s", val, f.Name)
+		}
+		return n, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer value %q of column %s", val, f.Name)
+	}
+	return uint64(n), nil
 }
@@ -15,12 +15,17 @@
 package mysql
 
 import (
+	"bytes"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"math/rand"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 	"unicode/utf8"
 )
@@ -60,6 +65,113 @@ func CalcPassword(scramble, password []byte) []byte {
 	return scramble
 }
 
+// CalcPasswordHash returns SHA1(SHA1(password)), the hash mysql_native_password
+// needs to verify a scramble, nil if the password is empty.
+func CalcPasswordHash(password []byte) []byte {
+	if len(password) == 0 {
+		return nil
+	}
+	stage1 := sha1.Sum(password)
+	stage2 := sha1.Sum(stage1[:])
+	return stage2[:]
+}
+
+// EncodePassword returns the password hash in the format of MySQL PASSWORD(),
+// '*' followed by 40 upper case hex digits, "" if the password is empty.
+func EncodePassword(password string) string {
+	hash := CalcPasswordHash([]byte(password))
+	if hash == nil {
+		return ""
+	}
+	return "*" + strings.ToUpper(hex.EncodeToString(hash))
+}
+
+// DecodePassword parses a hash produced by EncodePassword, the leading '*'
+// is optional.
+func DecodePassword(hash string) ([]byte, error) {
+	hash = strings.TrimPrefix(hash, "*")
+	if len(hash) != sha1.Size*2 {
+		return nil, fmt.Errorf("password hash should be %d hex digits", sha1.Size*2)
+	}
+	return hex.DecodeString(hash)
+}
+
+// CheckPassword verifies a mysql_native_password scramble against the
+// SHA1(SHA1(password)) hash.
+func CheckPassword(scramble, auth, hash []byte) bool {
+	if len(hash) == 0 {
+		return len(auth) == 0
+	}
+	if len(auth) != sha1.Size {
+		return false
+	}
+
+	// stage1Hash = auth XOR SHA1(scramble + hash)
+	crypt := sha1.New()
+	crypt.Write(scramble)
+	crypt.Write(hash)
+	stage1 := crypt.Sum(nil)
+	for i := range stage1 {
+		stage1[i] ^= auth[i]
+	}
+	stage2 := sha1.Sum(stage1)
+	return bytes.Equal(stage2[:], hash)
+}
+
+// CalcCachingSha2Password computes the caching_sha2_password scramble
+// XOR(SHA256(password), SHA256(SHA256(SHA256(password)), scramble))
+func CalcCachingSha2Password(scramble, password []byte) []byte {
+	if len(password) == 0 {
+		return nil
+	}
+
+	crypt := sha256.New()
+	crypt.Write(password)
+	stage1 := crypt.Sum(nil)
+
+	crypt.Reset()
+	crypt.Write(stage1)
+	stage2 := crypt.Sum(nil)
+
+	crypt.Reset()
+	crypt.Write(stage2)
+	crypt.Write(scramble)
+	token := crypt.Sum(nil)
+
+	for i := range token {
+		token[i] ^= stage1[i]
+	}
+	return token
+}
+
+// CalcCachingSha2Digest returns SHA256(SHA256(password)), the value the
+// server keeps in its cache to verify fast auth scrambles.
+func CalcCachingSha2Digest(password []byte) []byte {
+	stage1 := sha256.Sum256(password)
+	stage2 := sha256.Sum256(stage1[:])
+	return stage2[:]
+}
+
+// CheckCachingSha2Password verifies a caching_sha2_password scramble against
+// the cached SHA256(SHA256(password)) digest.
+func CheckCachingSha2Password(scramble, auth, digest []byte) bool {
+	if len(auth) != sha256.Size || len(digest) != sha256.Size {
+		return false
+	}
+
+	crypt := sha256.New()
+	crypt.Write(digest)
+	crypt.Write(scramble)
+	stage1 := crypt.Sum(nil)
+
+	// stage1 = auth XOR SHA256(digest, scramble)
+	for i := range stage1 {
+		stage1[i] ^= auth[i]
+	}
+	stage2 := sha256.Sum256(stage1)
+	return bytes.Equal(stage2[:], digest)
+}
+
 // seed must be in the range of ascii
 func RandomBuf(size int) ([]byte, error) {
 	buf := make([]byte, size)
@@ -300,28 +412,28 @@ func FormatBinaryDateTime(n int, data []byte) ([]byte, error) {
 
 func FormatBinaryTime(n int, data []byte) ([]byte, error) {
 	if n == 0 {
-		return []byte("0000-00-00"), nil
+		return []byte("00:00:00"), nil
 	}
 
-	var sign byte
+	var sign string
 	if data[0] == 1 {
-		sign = byte('-')
+		sign = "-"
 	}
 
 	switch n {
 	case 8:
 		return []byte(fmt.Sprintf(
-			"%c%02d:%02d:%02d",
+			"%s%02d:%02d:%02d",
 			sign,
-			uint16(data[1])*24+uint16(data[5]),
+			binary.LittleEndian.Uint32(data[1:5])*24+uint32(data[5]),
 			data[6],
 			data[7],
 		)), nil
 	case 12:
 		return []byte(fmt.Sprintf(
-			"%c%02d:%02d:%02d.%06d",
+			"%s%02d:%02d:%02d.%06d",
 			sign,
-			uint16(data[1])*24+uint16(data[5]),
+			binary.LittleEndian.Uint32(data[1:5])*24+uint32(data[5]),
 			data[6],
 			data[7],
 			binary.LittleEndian.Uint32(data[8:12]),
@@ -331,6 +443,105 @@ func FormatBinaryTime(n int, data []byte) ([]byte, error) {
 	}
 }
 
+// PutBinaryDateTime 将文本格式的日期或日期时间编码为二进制协议格式(含长度字节)，
+// 是FormatBinaryDate和FormatBinaryDateTime的逆过程
+func PutBinaryDateTime(value []byte) ([]byte, error) {
+	var year, month, day, hour, minute, second, micro int
+	datePart, timePart := string(value), ""
+	if i := strings.IndexByte(datePart, ' '); i >= 0 {
+		datePart, timePart = datePart[:i], datePart[i+1:]
+	}
+	var err error
+	if year, month, day, err = splitInts(datePart, '-'); err != nil {
+		return nil, fmt.Errorf("invalid datetime %q", value)
+	}
+	if timePart != "" {
+		if hour, minute, second, micro, err = parseClock(timePart); err != nil {
+			return nil, fmt.Errorf("invalid datetime %q", value)
+		}
+	}
+
+	data := make([]byte, 1, 12)
+	data = append(data, Uint16ToBytes(uint16(year))...)
+	data = append(data, byte(month), byte(day), byte(hour), byte(minute), byte(second))
+	data = append(data, Uint32ToBytes(uint32(micro))...)
+
+	switch {
+	case year == 0 && month == 0 && day == 0 && hour == 0 && minute == 0 && second == 0 && micro == 0:
+		data = data[:1]
+	case hour == 0 && minute == 0 && second == 0 && micro == 0:
+		data = data[:5]
+	case micro == 0:
+		data = data[:8]
+	}
+	data[0] = byte(len(data) - 1)
+	return data, nil
+}
+
+// PutBinaryTime 将文本格式的时间编码为二进制协议格式(含长度字节)，是FormatBinaryTime的逆过程
+func PutBinaryTime(value []byte) ([]byte, error) {
+	s := string(value)
+	var negative byte
+	if strings.HasPrefix(s, "-") {
+		negative = 1
+		s = s[1:]
+	}
+	hour, minute, second, micro, err := parseClock(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q", value)
+	}
+
+	data := make([]byte, 1, 13)
+	data = append(data, negative)
+	data = append(data, Uint32ToBytes(uint32(hour/24))...)
+	data = append(data, byte(hour%24), byte(minute), byte(second))
+	data = append(data, Uint32ToBytes(uint32(micro))...)
+
+	switch {
+	case hour == 0 && minute == 0 && second == 0 && micro == 0:
+		data = data[:1]
+	case micro == 0:
+		data = data[:9]
+	}
+	data[0] = byte(len(data) - 1)
+	return data, nil
+}
+
+// splitInts 解析sep分隔的三个整数，如2006-01-02和15:04:05
+func splitInts(s string, sep byte) (a, b, c int, err error) {
+	parts := strings.Split(s, string(sep))
+	if len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("invalid value %q", s)
+	}
+	if a, err = strconv.Atoi(parts[0]); err != nil {
+		return
+	}
+	if b, err = strconv.Atoi(parts[1]); err != nil {
+		return
+	}
+	c, err = strconv.Atoi(parts[2])
+	return
+}
+
+// parseClock 解析hh:mm:ss[.ffffff]，小时可以超过24
+func parseClock(s string) (hour, minute, second, micro int, err error) {
+	fraction := ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s, fraction = s[:i], s[i+1:]
+	}
+	if hour, minute, second, err = splitInts(s, ':'); err != nil {
+		return
+	}
+	if fraction != "" {
+		if len(fraction) > 6 {
+			fraction = fraction[:6]
+		}
+		fraction += strings.Repeat("0", 6-len(fraction))
+		micro, err = strconv.Atoi(fraction)
+	}
+	return
+}
+
 var (
 	DONTESCAPE = byte(255)
 
@@ -16,6 +16,7 @@ package mysql
 
 import (
 	"encoding/hex"
+	"strings"
 	"testing"
 
 	"sqlproxy/core/hack"
@@ -46,3 +47,96 @@ func TestCalcPassword(t *testing.T) {
 	hex_scramble := hex.EncodeToString(scramble)
 	t.Logf("scramble: %s equal %s, pass: %v", "fbc71db5ac3d7b51048d1a1d88c1677f34bcca11", hex_scramble, "fbc71db5ac3d7b51048d1a1d88c1677f34bcca11" == hex_scramble)
 }
+
+func TestCalcCachingSha2Password(t *testing.T) {
+	scramble := []byte{10, 47, 74, 111, 75, 73, 34, 48, 88, 76, 114, 74, 37, 13, 3, 80, 82, 2, 23, 21}
+	vectors := []struct {
+		pass string
+		out  string
+	}{
+		{"secret", "f490e76f66d9d86665ce54d98c78d0acfe2fb0b08b423da807144873d30b312c"},
+		{"secret2", "abc3934a012cf342e876071c8ee202de51785b430258a7a0138bc79c4d800bc6"},
+	}
+	for _, v := range vectors {
+		auth := CalcCachingSha2Password(scramble, []byte(v.pass))
+		if hex.EncodeToString(auth) != v.out {
+			t.Errorf("caching_sha2 scramble of %q: %x", v.pass, auth)
+		}
+		if !CheckCachingSha2Password(scramble, auth, CalcCachingSha2Digest([]byte(v.pass))) {
+			t.Errorf("check caching_sha2 scramble of %q failed", v.pass)
+		}
+		if CheckCachingSha2Password(scramble, auth, CalcCachingSha2Digest([]byte("wrong"))) {
+			t.Errorf("caching_sha2 scramble of %q matches a wrong password", v.pass)
+		}
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	// SELECT PASSWORD('password')
+	if hash := EncodePassword("password"); hash != "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19" {
+		t.Fatalf("bad hash %s", hash)
+	}
+	decoded, err := DecodePassword(EncodePassword("kingshard"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodePassword("*1234"); err == nil {
+		t.Fatal("want error for short hash")
+	}
+
+	seed := hack.Slice("@jx=d_3z42;sS$YrS)p|")
+	if !CheckPassword(seed, CalcPassword(seed, hack.Slice("kingshard")), decoded) {
+		t.Fatal("check password failed")
+	}
+	if CheckPassword(seed, CalcPassword(seed, hack.Slice("wrong")), decoded) {
+		t.Fatal("wrong password matched")
+	}
+	if !CheckPassword(seed, nil, CalcPasswordHash(nil)) {
+		t.Fatal("empty password should match empty auth")
+	}
+}
+
+func TestPutBinaryDateTime(t *testing.T) {
+	tests := []struct {
+		value  string
+		length int
+		format func(int, []byte) ([]byte, error)
+		want   string
+	}{
+		{"2020-01-02", 4, FormatBinaryDate, "2020-01-02"},
+		{"0000-00-00", 0, FormatBinaryDate, "0000-00-00"},
+		{"2020-01-02 03:04:05", 7, FormatBinaryDateTime, "2020-01-02 03:04:05"},
+		{"2020-01-02 00:00:00", 4, FormatBinaryDateTime, "2020-01-02 00:00:00"},
+		{"2020-01-02 03:04:05.12", 11, FormatBinaryDateTime, "2020-01-02 03:04:05.120000"},
+		{"0000-00-00 00:00:00", 0, FormatBinaryDateTime, "0000-00-00 00:00:00"},
+		{"03:04:05", 8, FormatBinaryTime, "03:04:05"},
+		{"-838:59:59", 8, FormatBinaryTime, "-838:59:59"},
+		{"03:04:05.000001", 12, FormatBinaryTime, "03:04:05.000001"},
+		{"00:00:00", 0, FormatBinaryTime, "00:00:00"},
+	}
+	for _, tt := range tests {
+		put := PutBinaryDateTime
+		if strings.Count(tt.value, "-") != 2 {
+			put = PutBinaryTime
+		}
+		data, err := put([]byte(tt.value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int(data[0]) != tt.length || len(data) != tt.length+1 {
+			t.Errorf("%s: got length %d, data %v", tt.value, data[0], data)
+			continue
+		}
+		got, err := tt.format(int(data[0]), data[1:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.value, got, tt.want)
+		}
+	}
+
+	if _, err := PutBinaryDateTime([]byte("2020-01-02T03:04:05Z")); err == nil {
+		t.Error("want error for RFC3339 value")
+	}
+}
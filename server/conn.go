@@ -16,10 +16,12 @@ package server
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/binary"
 	"fmt"
 	"net"
 	"runtime"
+	"strings"
 	"sync"
 
 	"sqlproxy/backend"
@@ -67,10 +69,30 @@ type ClientConn struct {
 
 var DEFAULT_CAPABILITY uint32 = mysql.CLIENT_LONG_PASSWORD | mysql.CLIENT_LONG_FLAG |
 	mysql.CLIENT_CONNECT_WITH_DB | mysql.CLIENT_PROTOCOL_41 |
-	mysql.CLIENT_TRANSACTIONS | mysql.CLIENT_SECURE_CONNECTION
+	mysql.CLIENT_TRANSACTIONS | mysql.CLIENT_SECURE_CONNECTION | mysql.CLIENT_FOUND_ROWS
 
 var baseConnId uint32 = 10000
 
+// the SSLRequest packet is a handshake response truncated after the reserved
+// bytes: capability(4) + max packet size(4) + charset(1) + reserved(23)
+const sslRequestLen = 32
+
+// serverCapability returns the capability flags announced in the initial
+// handshake, CLIENT_SSL is only set if the server has a certificate.
+func (c *ClientConn) serverCapability() uint32 {
+	capability := DEFAULT_CAPABILITY | mysql.CLIENT_PLUGIN_AUTH
+	if c.proxy.tlsConfig != nil {
+		capability |= mysql.CLIENT_SSL
+	}
+	return capability
+}
+
+// isSecureTransport reports whether the client connection is upgraded to TLS.
+func (c *ClientConn) isSecureTransport() bool {
+	_, ok := c.c.(*tls.Conn)
+	return ok
+}
+
 func (c *ClientConn) CanAccess(db string) bool {
 	nodes, _ := c.proxy.schemas[c.user]
 	if len(nodes) == 0 {
@@ -79,46 +101,73 @@ func (c *ClientConn) CanAccess(db string) bool {
 	return StrInSlice(db, nodes)
 }
 
-// GetBackendDB returns the backend database of the ClientConn.
-//
-// It checks if the transaction connection (txConn) is not nil and returns it.
-// If the transaction connection is nil, it checks if the backend schema for the user exists and returns it.
-// If the backend schema does not exist, it checks if the backend node for the database exists and returns it.
-// If neither the backend schema nor the backend node exists, it returns nil.
+// GetBackendDB returns the backend node serving the current session.
 //
-// Returns a pointer to backend.BackendProxy.
+// A running transaction stays on the node it was started on, even if the
+// client switches database with USE or COM_INIT_DB in the middle of it.
+// Otherwise the node is resolved from the current database, falling back to
+// the user's default node in schema_list. It returns nil if no node can be
+// resolved, callers should answer ER_NO_DB_ERROR in that case.
 func (c *ClientConn) GetBackendDB() *backend.BackendProxy {
 	if c.txConn != nil {
 		return c.txConn
 	}
-	if backend := c.proxy.GetNode("TEST"); backend != nil {
-		return backend
+	nodeName := c.getNodeName()
+	if nodeName == "" {
+		return nil
 	}
-	return nil
+	return c.proxy.GetNode(nodeName)
 }
 
+// getNodeName returns the node name for the current database, or the first
+// node configured for the user in schema_list if no database is selected.
+func (c *ClientConn) getNodeName() string {
+	if c.db != "" {
+		return c.db
+	}
+	if nodes := c.proxy.schemas[c.user]; len(nodes) != 0 {
+		return nodes[0]
+	}
+	return ""
+}
+
+// clientIP returns the remote ip of the client, the zone of an ipv6
+// link-local address is dropped so that it can be matched against allow_ips.
+func (c *ClientConn) clientIP() net.IP {
+	clientHost, _, err := net.SplitHostPort(c.c.RemoteAddr().String())
+	if err != nil {
+		golog.Warn("ClientConn", "clientIP", err.Error(), c.connectionId,
+			"remoteAddr", c.c.RemoteAddr().String())
+		return nil
+	}
+	if i := strings.IndexByte(clientHost, '%'); i != -1 {
+		clientHost = clientHost[:i]
+	}
+	return net.ParseIP(clientHost)
+}
+
+// IsAllowConnect checks the client ip against the global allow_ips list.
 func (c *ClientConn) IsAllowConnect() bool {
-	//clientHost, _, err := net.SplitHostPort(c.c.RemoteAddr().String())
-	//if err != nil {
-	//	fmt.Println(err)
-	//}
-	//clientIP := net.ParseIP(clientHost)
-	//
-	//current, _, _ := c.proxy.allowipsIndex.Get()
-	//ipVec := c.proxy.allowips[current]
-	//if ipVecLen := len(ipVec); ipVecLen == 0 {
-	//	return true
-	//}
-	//for _, ip := range ipVec {
-	//	if ip.Match(clientIP) {
-	//		return true
-	//	}
-	//}
-	//
-	//golog.Error("server", "IsAllowConnect", "error", mysql.ER_ACCESS_DENIED_ERROR,
-	//	"ip address", c.c.RemoteAddr().String(), " access denied by kindshard.")
-	//return false
-	return true
+	current, _, _ := c.proxy.allowipsIndex.Get()
+	if matchAllowIps(c.proxy.allowips[current], c.clientIP()) {
+		return true
+	}
+
+	golog.Error("server", "IsAllowConnect", "error", mysql.ER_ACCESS_DENIED_ERROR,
+		"ip address", c.c.RemoteAddr().String(), " access denied by sqlproxy.")
+	return false
+}
+
+// IsAllowUserConnect checks the client ip against the allow_ips of the user.
+func (c *ClientConn) IsAllowUserConnect() bool {
+	if matchAllowIps(c.proxy.userAllowips[c.user], c.clientIP()) {
+		return true
+	}
+
+	golog.Error("server", "IsAllowUserConnect", "error", mysql.ER_ACCESS_DENIED_ERROR,
+		"user", c.user,
+		"ip address", c.c.RemoteAddr().String(), " access denied by sqlproxy.")
+	return false
 }
 
 func (c *ClientConn) Handshake() error {
@@ -178,8 +227,9 @@ func (c *ClientConn) writeInitialHandshake() error {
 	//filter [00]
 	data = append(data, 0)
 
-	//capability flag lower 2 bytes, using default capability here
-	data = append(data, byte(DEFAULT_CAPABILITY), byte(DEFAULT_CAPABILITY>>8))
+	//capability flag lower 2 bytes
+	capability := c.serverCapability()
+	data = append(data, byte(capability), byte(capability>>8))
 
 	//charset, utf-8 default
 	data = append(data, uint8(mysql.DEFAULT_COLLATION_ID))
@@ -188,8 +238,8 @@ func (c *ClientConn) writeInitialHandshake() error {
 	data = append(data, byte(c.status), byte(c.status>>8))
 
 	//below 13 byte may not be used
-	//capability flag upper 2 bytes, using default capability here
-	data = append(data, byte(DEFAULT_CAPABILITY>>16), byte(DEFAULT_CAPABILITY>>24))
+	//capability flag upper 2 bytes
+	data = append(data, byte(capability>>16), byte(capability>>24))
 
 	//filter [0x15], for wireshark dump, value is 0x15
 	data = append(data, 0x15)
@@ -203,6 +253,10 @@ func (c *ClientConn) writeInitialHandshake() error {
 	//filter [00]
 	data = append(data, 0)
 
+	//auth-plugin name
+	data = append(data, c.proxy.defaultAuthPlugin...)
+	data = append(data, 0)
+
 	return c.writePacket(data)
 }
 
@@ -218,6 +272,21 @@ func (c *ClientConn) writePacketBatch(total, data []byte, direct bool) ([]byte,
 	return c.pkg.WritePacketBatch(total, data, direct)
 }
 
+// upgradeToTLS switches the client connection to TLS after an SSLRequest.
+func (c *ClientConn) upgradeToTLS() error {
+	if c.proxy.tlsConfig == nil {
+		return mysql.NewError(mysql.ER_HANDSHAKE_ERROR, "ssl is not configured on sqlproxy")
+	}
+	tlsConn, err := c.pkg.UpgradeTLS(c.c, c.proxy.tlsConfig)
+	if err != nil {
+		return err
+	}
+	c.c = tlsConn
+	golog.Debug("ClientConn", "upgradeToTLS", "tls handshake ok", c.connectionId,
+		"version", tlsConn.ConnectionState().Version)
+	return nil
+}
+
 func (c *ClientConn) readHandshakeResponse() error {
 	data, err := c.readPacket()
 
@@ -225,6 +294,22 @@ func (c *ClientConn) readHandshakeResponse() error {
 		return err
 	}
 
+	//ssl request, the real handshake response follows on the tls connection
+	if len(data) == sslRequestLen && binary.LittleEndian.Uint32(data[:4])&mysql.CLIENT_SSL > 0 {
+		if err = c.upgradeToTLS(); err != nil {
+			return err
+		}
+		if data, err = c.readPacket(); err != nil {
+			return err
+		}
+	}
+
+	if c.proxy.cfg.RequireSecureTransport && !c.isSecureTransport() {
+		golog.Error("ClientConn", "readHandshakeResponse", "insecure transport", c.connectionId,
+			"remoteAddr", c.c.RemoteAddr().String())
+		return mysql.NewDefaultError(mysql.ER_SECURE_TRANSPORT_REQUIRED)
+	}
+
 	pos := 0
 
 	//capability
@@ -247,47 +332,60 @@ func (c *ClientConn) readHandshakeResponse() error {
 	pos += len(c.user) + 1
 
 	//auth length and auth
-	authLen := int(data[pos])
-	pos++
+	var authLen int
+	if c.capability&mysql.CLIENT_PLUGIN_AUTH_LENENC_CLIENT_DATA > 0 {
+		num, _, n := mysql.LengthEncodedInt(data[pos:])
+		authLen = int(num)
+		pos += n
+	} else {
+		authLen = int(data[pos])
+		pos++
+	}
 	auth := data[pos : pos+authLen]
+	pos += authLen
+
+	var db string
+	if c.capability&mysql.CLIENT_CONNECT_WITH_DB > 0 && pos < len(data) {
+		db = string(data[pos : pos+bytes.IndexByte(data[pos:], 0)])
+		pos += len(db) + 1
+	}
+
+	//auth plugin name, clients without CLIENT_PLUGIN_AUTH use mysql_native_password
+	authPlugin := mysql.AUTH_NATIVE_PASSWORD
+	if c.capability&mysql.CLIENT_PLUGIN_AUTH > 0 && pos < len(data) {
+		if end := bytes.IndexByte(data[pos:], 0); end != -1 {
+			authPlugin = string(data[pos : pos+end])
+		} else {
+			authPlugin = string(data[pos:])
+		}
+	}
 
 	//check user
 	if _, ok := c.proxy.users[c.user]; !ok {
 		golog.Error("ClientConn", "readHandshakeResponse", "user error", 0,
-			"auth", auth,
-			"client_user", c.user,
-			"config_set_user", c.user,
-			"password", c.proxy.users[c.user])
+			"client_user", c.user)
 		return mysql.NewDefaultError(mysql.ER_ACCESS_DENIED_ERROR, c.user, c.c.RemoteAddr().String(), "Yes")
 	}
 
-	//check password
-	checkAuth := mysql.CalcPassword(c.salt, []byte(c.proxy.users[c.user]))
-	if !bytes.Equal(auth, checkAuth) {
-		golog.Error("ClientConn", "readHandshakeResponse", "password error", 0,
-			"auth", auth,
-			"checkAuth", checkAuth,
-			"user", c.user,
-			"salt", c.salt,
-			"password", c.proxy.users[c.user])
+	//check user allow ips
+	if !c.IsAllowUserConnect() {
+		c.proxy.counter.IncrDeniedConnTotal()
 		return mysql.NewDefaultError(mysql.ER_ACCESS_DENIED_ERROR, c.user, c.c.RemoteAddr().String(), "Yes")
 	}
 
-	pos += authLen
-
-	var db string
-	if c.capability&mysql.CLIENT_CONNECT_WITH_DB > 0 {
-		if len(data[pos:]) == 0 {
-			return nil
-		}
+	//check password
+	if err := c.authenticate(authPlugin, auth); err != nil {
+		return err
+	}
 
-		db = string(data[pos : pos+bytes.IndexByte(data[pos:], 0)])
-		pos += len(c.db) + 1
+	if db != "" && c.proxy.GetNode(db) == nil {
+		golog.Error("ClientConn", "readHandshakeResponse", "unknown db", 0,
+			"client_user", c.user,
+			"db", db)
+		return mysql.NewDefaultError(mysql.ER_BAD_DB_ERROR, db)
 	}
 	if db != "" && !c.CanAccess(db) {
 		golog.Error("ClientConn", "readHandshakeResponse", "db access error", 0,
-			"auth", auth,
-			"checkAuth", checkAuth,
 			"client_user", c.user,
 			"db", db)
 		return mysql.NewDefaultError(mysql.ER_DBACCESS_DENIED_ERROR, c.user, c.c.RemoteAddr().String(), db)
@@ -300,6 +398,9 @@ func (c *ClientConn) readHandshakeResponse() error {
 
 func (c *ClientConn) clean() {
 	golog.Info("ClientConn", "clean", "", c.connectionId)
+	for _, s := range c.stmts {
+		s.CloseCursor()
+	}
 	if c.txConn != nil {
 		c.txConn.Commit() // TODO check possible problems?
 		c.txConn = nil
@@ -391,6 +492,8 @@ func (c *ClientConn) dispatch(data []byte) error {
 		return c.handleStmtSendLongData(data)
 	case mysql.COM_STMT_RESET:
 		return c.handleStmtReset(data)
+	case mysql.COM_STMT_FETCH:
+		return c.handleStmtFetch(data)
 	case mysql.COM_SET_OPTION:
 		return c.writeEOF(0)
 	default:
@@ -418,6 +521,11 @@ func (c *ClientConn) writeOK(r *mysql.Result) error {
 	if r == nil {
 		r = &mysql.Result{Status: c.status}
 	}
+	// 记录本会话的影响行数和最后生成的自增ID，用于row_count()和last_insert_id()
+	c.affectedRows = int64(r.AffectedRows)
+	if r.InsertId > 0 {
+		c.lastInsertId = int64(r.InsertId)
+	}
 	data := make([]byte, 4, 32)
 
 	data = append(data, mysql.OK_HEADER)
@@ -441,6 +549,7 @@ func (c *ClientConn) writeError(e error) error {
 	if m, ok = e.(*mysql.SqlError); !ok {
 		m = mysql.NewError(mysql.ER_UNKNOWN_ERROR, e.Error())
 	}
+	observeError(m)
 
 	data := make([]byte, 4, 16+len(m.Message))
 
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"sync"
+
+	"sqlproxy/core/golog"
+	"sqlproxy/mysql"
+)
+
+const rsaKeyBits = 2048
+
+func isSupportedAuthPlugin(plugin string) bool {
+	switch plugin {
+	case mysql.AUTH_NATIVE_PASSWORD, mysql.AUTH_CACHING_SHA2_PASSWORD:
+		return true
+	}
+	return false
+}
+
+// sha2PasswordCache keeps SHA256(SHA256(password)) of users which passed
+// caching_sha2_password full authentication, later logins of these users
+// are verified by the scramble only.
+type sha2PasswordCache struct {
+	sync.RWMutex
+	digests map[string][]byte
+}
+
+func newSha2PasswordCache() *sha2PasswordCache {
+	return &sha2PasswordCache{digests: make(map[string][]byte)}
+}
+
+func (c *sha2PasswordCache) Get(user string) ([]byte, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	digest, ok := c.digests[user]
+	return digest, ok
+}
+
+func (c *sha2PasswordCache) Set(user string, digest []byte) {
+	c.Lock()
+	defer c.Unlock()
+	c.digests[user] = digest
+}
+
+// rsaKeyHolder generates the RSA key pair on first use, clients without
+// TLS fetch its public key to encrypt the password in full authentication.
+type rsaKeyHolder struct {
+	once      sync.Once
+	key       *rsa.PrivateKey
+	publicPem []byte
+	err       error
+}
+
+func (h *rsaKeyHolder) Get() (*rsa.PrivateKey, []byte, error) {
+	h.once.Do(func() {
+		h.key, h.err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if h.err != nil {
+			return
+		}
+		der, err := x509.MarshalPKIXPublicKey(&h.key.PublicKey)
+		if err != nil {
+			h.err = err
+			return
+		}
+		h.publicPem = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	})
+	return h.key, h.publicPem, h.err
+}
+
+func (c *ClientConn) accessDeniedError() error {
+	return mysql.NewDefaultError(mysql.ER_ACCESS_DENIED_ERROR, c.user, c.c.RemoteAddr().String(), "Yes")
+}
+
+// authenticate checks the auth response of the user, clientPlugin is the
+// plugin the client used to compute auth. If it is not the plugin of the
+// user, an AuthSwitchRequest is sent first.
+func (c *ClientConn) authenticate(clientPlugin string, auth []byte) error {
+	plugin := c.proxy.userAuthPlugins[c.user]
+	if clientPlugin != plugin {
+		if c.capability&mysql.CLIENT_PLUGIN_AUTH == 0 {
+			golog.Error("ClientConn", "authenticate", "client does not support auth plugin", c.connectionId,
+				"user", c.user,
+				"plugin", plugin)
+			return mysql.NewDefaultError(mysql.ER_NOT_SUPPORTED_AUTH_MODE)
+		}
+
+		var err error
+		if auth, err = c.switchAuthPlugin(plugin); err != nil {
+			return err
+		}
+	}
+
+	switch plugin {
+	case mysql.AUTH_CACHING_SHA2_PASSWORD:
+		return c.cachingSha2Auth(auth)
+	default:
+		if !mysql.CheckPassword(c.salt, auth, c.proxy.users[c.user]) {
+			golog.Error("ClientConn", "authenticate", "password error", c.connectionId,
+				"user", c.user,
+				"plugin", plugin)
+			return c.accessDeniedError()
+		}
+	}
+	return nil
+}
+
+// switchAuthPlugin sends AuthSwitchRequest and returns the auth response
+// computed by the client with the new plugin.
+func (c *ClientConn) switchAuthPlugin(plugin string) ([]byte, error) {
+	data := make([]byte, 4, 4+1+len(plugin)+1+len(c.salt)+1)
+	data = append(data, mysql.AUTH_SWITCH_HEADER)
+	data = append(data, plugin...)
+	data = append(data, 0)
+	data = append(data, c.salt...)
+	data = append(data, 0)
+	if err := c.writePacket(data); err != nil {
+		return nil, err
+	}
+	golog.Debug("ClientConn", "switchAuthPlugin", "auth switch", c.connectionId,
+		"user", c.user,
+		"plugin", plugin)
+	return c.readPacket()
+}
+
+func (c *ClientConn) writeAuthMoreData(payload []byte) error {
+	data := make([]byte, 4, 4+1+len(payload))
+	data = append(data, mysql.AUTH_MORE_DATA_HEADER)
+	data = append(data, payload...)
+	return c.writePacket(data)
+}
+
+// cachingSha2Auth uses the fast path if the user is in the cache, otherwise
+// asks for the password: in clear text over TLS, or encrypted by the RSA
+// public key on an insecure connection. The server only knows the password
+// hash, so the first login of a user always needs the full authentication.
+func (c *ClientConn) cachingSha2Auth(auth []byte) error {
+	hash := c.proxy.users[c.user]
+	if len(hash) == 0 {
+		if len(auth) != 0 {
+			return c.accessDeniedError()
+		}
+		return nil
+	}
+
+	if digest, ok := c.proxy.sha2Cache.Get(c.user); ok {
+		if !mysql.CheckCachingSha2Password(c.salt, auth, digest) {
+			golog.Error("ClientConn", "cachingSha2Auth", "password error", c.connectionId,
+				"user", c.user)
+			return c.accessDeniedError()
+		}
+		return c.writeAuthMoreData([]byte{mysql.CACHING_SHA2_FAST_AUTH_SUCCESS})
+	}
+
+	if err := c.writeAuthMoreData([]byte{mysql.CACHING_SHA2_PERFORM_FULL_AUTH}); err != nil {
+		return err
+	}
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+
+	var plain []byte
+	if c.isSecureTransport() {
+		plain = bytes.TrimSuffix(data, []byte{0})
+	} else {
+		if plain, err = c.decryptPassword(data); err != nil {
+			golog.Error("ClientConn", "cachingSha2Auth", err.Error(), c.connectionId,
+				"user", c.user)
+			return c.accessDeniedError()
+		}
+	}
+	if !bytes.Equal(mysql.CalcPasswordHash(plain), hash) {
+		golog.Error("ClientConn", "cachingSha2Auth", "password error", c.connectionId,
+			"user", c.user)
+		return c.accessDeniedError()
+	}
+
+	c.proxy.sha2Cache.Set(c.user, mysql.CalcCachingSha2Digest(plain))
+	return nil
+}
+
+// decryptPassword sends the public key if the client requests it, then
+// decrypts the password, which is XORed with the salt before encryption.
+func (c *ClientConn) decryptPassword(data []byte) ([]byte, error) {
+	key, publicPem, err := c.proxy.rsaKey.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 1 && data[0] == mysql.CACHING_SHA2_REQUEST_PUBLIC_KEY {
+		if err = c.writeAuthMoreData(publicPem); err != nil {
+			return nil, err
+		}
+		if data, err = c.readPacket(); err != nil {
+			return nil, err
+		}
+	}
+
+	plain, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, key, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := range plain {
+		plain[i] ^= c.salt[i%len(c.salt)]
+	}
+	return bytes.TrimSuffix(plain, []byte{0}), nil
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sqlproxy/config"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func newAuthTestServer(t *testing.T, cfg *config.Config) *Server {
+	s, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	return s
+}
+
+func pingAs(dsn string) error {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Ping()
+}
+
+func TestConn_CachingSha2Auth(t *testing.T) {
+	s := newAuthTestServer(t, &config.Config{
+		Addr:              "127.0.0.1:9699",
+		DefaultAuthPlugin: "caching_sha2_password",
+		UserList: []config.UserConfig{
+			{User: "sha2user", Password: "sha2pwd"},
+			{User: "nativeuser", Password: "nativepwd", AuthPlugin: "mysql_native_password"},
+			// SELECT PASSWORD('password')
+			{User: "hashuser", PasswordHash: "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"},
+			{User: "nativehashuser", PasswordHash: "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19", AuthPlugin: "mysql_native_password"},
+		},
+	})
+	defer s.Close()
+
+	//full auth with the RSA public key, then the fast path
+	for i := 0; i < 2; i++ {
+		if err := pingAs("sha2user:sha2pwd@tcp(127.0.0.1:9699)/"); err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+		if _, ok := s.sha2Cache.Get("sha2user"); !ok {
+			t.Fatalf("login %d: sha2user not cached after login", i)
+		}
+	}
+
+	err := pingAs("sha2user:wrong@tcp(127.0.0.1:9699)/")
+	if mysqlErr, ok := err.(*mysql.MySQLError); !ok || mysqlErr.Number != 1045 {
+		t.Fatalf("want ER_ACCESS_DENIED_ERROR, got %v", err)
+	}
+
+	//the client starts with caching_sha2_password and is switched to native
+	if err := pingAs("nativeuser:nativepwd@tcp(127.0.0.1:9699)/"); err != nil {
+		t.Fatal(err)
+	}
+
+	//users configured with password_hash only
+	for i := 0; i < 2; i++ {
+		if err := pingAs("hashuser:password@tcp(127.0.0.1:9699)/"); err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+	}
+	if err := pingAs("nativehashuser:password@tcp(127.0.0.1:9699)/"); err != nil {
+		t.Fatal(err)
+	}
+	err = pingAs("nativehashuser:wrong@tcp(127.0.0.1:9699)/")
+	if mysqlErr, ok := err.(*mysql.MySQLError); !ok || mysqlErr.Number != 1045 {
+		t.Fatalf("want ER_ACCESS_DENIED_ERROR, got %v", err)
+	}
+}
+
+func TestParseUsers(t *testing.T) {
+	users, err := parseUsers([]config.UserConfig{
+		{User: "u1", Password: "password"},
+		{User: "u2", PasswordHash: "2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"},
+		{User: "u3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(users["u1"], users["u2"]) || users["u3"] != nil {
+		t.Fatalf("unexpected users %v", users)
+	}
+
+	_, err = parseUsers([]config.UserConfig{{User: "u1", Password: "password", PasswordHash: "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"}})
+	if err == nil {
+		t.Fatal("want error for both password and password_hash")
+	}
+	_, err = parseUsers([]config.UserConfig{{User: "u1", PasswordHash: "*2470"}})
+	if err == nil {
+		t.Fatal("want error for bad password_hash")
+	}
+}
+
+func TestHashUserPasswords(t *testing.T) {
+	cfg := &config.Config{
+		UserList: []config.UserConfig{
+			{User: "u1", Password: "password"},
+			{User: "u2", PasswordHash: "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"},
+		},
+	}
+	saved := hashUserPasswords(cfg)
+	for _, user := range saved.UserList {
+		if user.Password != "" || user.PasswordHash != "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19" {
+			t.Fatalf("unexpected saved user %+v", user)
+		}
+	}
+	if cfg.UserList[0].Password != "password" {
+		t.Fatal("running config should not be changed")
+	}
+}
+
+func TestConn_CachingSha2AuthTLS(t *testing.T) {
+	s, certFile := newTLSTestServer(t, "127.0.0.1:9700", false)
+	defer s.Close()
+	defer os.RemoveAll(filepath.Dir(certFile))
+	registerTestTLSConfig(t, certFile)
+	s.userAuthPlugins["testuser"] = "caching_sha2_password"
+
+	//full auth sends the password in clear text over tls
+	if err := pingAs("testuser:testpwd@tcp(127.0.0.1:9700)/?tls=custom"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.sha2Cache.Get("testuser"); !ok {
+		t.Fatal("testuser not cached after login")
+	}
+}
+
+func TestParseAuthPlugins(t *testing.T) {
+	cfg := &config.Config{
+		UserList: []config.UserConfig{
+			{User: "u1"},
+			{User: "u2", AuthPlugin: "caching_sha2_password"},
+		},
+	}
+	defaultPlugin, plugins, err := parseAuthPlugins(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defaultPlugin != "mysql_native_password" || plugins["u1"] != "mysql_native_password" ||
+		plugins["u2"] != "caching_sha2_password" {
+		t.Fatalf("unexpected plugins %s %v", defaultPlugin, plugins)
+	}
+
+	cfg.UserList[0].AuthPlugin = "sha256_password"
+	if _, _, err := parseAuthPlugins(cfg); err == nil {
+		t.Fatal("want error for unsupported auth plugin")
+	}
+}
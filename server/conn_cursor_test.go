@@ -0,0 +1,226 @@
+package server
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"sqlproxy/config"
+	"sqlproxy/mysql"
+)
+
+// rawClient speaks the client side of the protocol for commands that
+// go-sql-driver does not send, such as COM_STMT_FETCH.
+type rawClient struct {
+	conn net.Conn
+	pkg  *mysql.PacketIO
+}
+
+func dialRawClient(t *testing.T, addr, user, password string) *rawClient {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &rawClient{conn: conn, pkg: mysql.NewPacketIO(conn)}
+
+	handshake, err := c.pkg.ReadPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//protocol version, server version[00], connection id
+	pos := 1
+	for handshake[pos] != 0 {
+		pos++
+	}
+	pos += 1 + 4
+	salt := append([]byte{}, handshake[pos:pos+8]...)
+	//auth-plugin-data-part-1, filter, capability, charset, status, capability, length, reserved
+	pos += 8 + 1 + 2 + 1 + 2 + 2 + 1 + 10
+	salt = append(salt, handshake[pos:pos+12]...)
+
+	capability := mysql.CLIENT_PROTOCOL_41 | mysql.CLIENT_SECURE_CONNECTION |
+		mysql.CLIENT_LONG_PASSWORD | mysql.CLIENT_TRANSACTIONS
+	auth := mysql.CalcPassword(salt, []byte(password))
+	data := make([]byte, 4, 128)
+	data = append(data, mysql.Uint32ToBytes(capability)...)
+	data = append(data, 0, 0, 0, 1)
+	data = append(data, byte(mysql.DEFAULT_COLLATION_ID))
+	data = append(data, make([]byte, 23)...)
+	data = append(data, user...)
+	data = append(data, 0)
+	data = append(data, byte(len(auth)))
+	data = append(data, auth...)
+	if err := c.pkg.WritePacket(data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.readOK(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (c *rawClient) Close() {
+	c.conn.Close()
+}
+
+func (c *rawClient) writeCommand(cmd byte, payload []byte) error {
+	c.pkg.Sequence = 0
+	data := make([]byte, 4, 5+len(payload))
+	data = append(data, cmd)
+	data = append(data, payload...)
+	return c.pkg.WritePacket(data)
+}
+
+func (c *rawClient) readPacket() ([]byte, error) {
+	data, err := c.pkg.ReadPacket()
+	if err != nil {
+		return nil, err
+	}
+	if data[0] == mysql.ERR_HEADER {
+		code := binary.LittleEndian.Uint16(data[1:3])
+		return nil, mysql.NewError(code, string(data[9:]))
+	}
+	return data, nil
+}
+
+func (c *rawClient) readOK() ([]byte, error) {
+	return c.readPacket()
+}
+
+// readUntilEOF returns the packets before EOF and the status of the EOF.
+func (c *rawClient) readUntilEOF() ([][]byte, uint16, error) {
+	var packets [][]byte
+	for {
+		data, err := c.readPacket()
+		if err != nil {
+			return nil, 0, err
+		}
+		if data[0] == mysql.EOF_HEADER && len(data) < 9 {
+			return packets, binary.LittleEndian.Uint16(data[3:5]), nil
+		}
+		packets = append(packets, data)
+	}
+}
+
+// prepare returns the statement id, the statement must not have params.
+func (c *rawClient) prepare(query string) (uint32, error) {
+	if err := c.writeCommand(mysql.COM_STMT_PREPARE, []byte(query)); err != nil {
+		return 0, err
+	}
+	data, err := c.readPacket()
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(data[1:5]), nil
+}
+
+func (c *rawClient) execute(id uint32, flag byte) error {
+	payload := mysql.Uint32ToBytes(id)
+	payload = append(payload, flag)
+	payload = append(payload, mysql.Uint32ToBytes(1)...)
+	return c.writeCommand(mysql.COM_STMT_EXECUTE, payload)
+}
+
+func (c *rawClient) fetch(id uint32, rows uint32) error {
+	payload := mysql.Uint32ToBytes(id)
+	payload = append(payload, mysql.Uint32ToBytes(rows)...)
+	return c.writeCommand(mysql.COM_STMT_FETCH, payload)
+}
+
+func newFakeNodeServer(t *testing.T, addr string) *Server {
+	return newAuthTestServer(t, &config.Config{
+		Addr:       addr,
+		UserList:   []config.UserConfig{{User: "testuser", Password: "testpwd"}},
+		Nodes:      []config.NodeConfig{{Name: "fake", DriverName: "fakedb", Datasource: "fake", MaxOpenConns: 4}},
+		SchemaList: []config.SchemaConfig{{User: "testuser", Nodes: []string{"fake"}}},
+	})
+}
+
+func TestConn_StmtFetch(t *testing.T) {
+	registerFakeResult("select id, name from cursor_test", &fakeResult{
+		columns: []fakeColumn{{name: "id", typeName: "INT"}, {name: "name", typeName: "VARCHAR"}},
+		rows: [][]driver.Value{
+			{int64(1), "a"},
+			{int64(2), "b"},
+			{int64(3), nil},
+		},
+	})
+	s := newFakeNodeServer(t, "127.0.0.1:9701")
+	defer s.Close()
+
+	c := dialRawClient(t, "127.0.0.1:9701", "testuser", "testpwd")
+	defer c.Close()
+
+	id, err := c.prepare("select id, name from cursor_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.execute(id, mysql.CURSOR_TYPE_READ_ONLY); err != nil {
+		t.Fatal(err)
+	}
+	//column count, column definitions and EOF, no rows
+	if _, err = c.readPacket(); err != nil {
+		t.Fatal(err)
+	}
+	fields, status, err := c.readUntilEOF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 2 || status&mysql.SERVER_STATUS_CURSOR_EXISTS == 0 {
+		t.Fatalf("execute: %d fields, status %x", len(fields), status)
+	}
+
+	fetches := []struct {
+		rows    int
+		lastRow bool
+	}{
+		{2, false},
+		{1, true},
+	}
+	for i, f := range fetches {
+		if err = c.fetch(id, 2); err != nil {
+			t.Fatal(err)
+		}
+		rows, status, err := c.readUntilEOF()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != f.rows || (status&mysql.SERVER_STATUS_LAST_ROW_SEND != 0) != f.lastRow ||
+			status&mysql.SERVER_STATUS_CURSOR_EXISTS == 0 {
+			t.Fatalf("fetch %d: %d rows, status %x", i, len(rows), status)
+		}
+	}
+
+	//the cursor is closed after the last row
+	if err = c.fetch(id, 2); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.readPacket()
+	if sqlErr, ok := err.(*mysql.SqlError); !ok || sqlErr.Code != mysql.ER_STMT_HAS_NO_OPEN_CURSOR {
+		t.Fatalf("want ER_STMT_HAS_NO_OPEN_CURSOR, got %v", err)
+	}
+
+	//COM_STMT_RESET closes an open cursor
+	if err = c.execute(id, mysql.CURSOR_TYPE_READ_ONLY); err != nil {
+		t.Fatal(err)
+	}
+	c.readPacket()
+	if _, _, err = c.readUntilEOF(); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.writeCommand(mysql.COM_STMT_RESET, mysql.Uint32ToBytes(id)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.readOK(); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.fetch(id, 2); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.readPacket()
+	if sqlErr, ok := err.(*mysql.SqlError); !ok || sqlErr.Code != mysql.ER_STMT_HAS_NO_OPEN_CURSOR {
+		t.Fatalf("cursor not closed by COM_STMT_RESET, got %v", err)
+	}
+}
@@ -15,10 +15,13 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 	"strings"
+	"time"
 
+	"sqlproxy/backend"
 	"sqlproxy/core/errors"
 	"sqlproxy/core/golog"
 	"sqlproxy/core/hack"
@@ -48,6 +51,12 @@ func (c *ClientConn) handleQuery(sql string) (err error) {
 	}()
 	golog.Debug("ClientConn", "handleQuery", sql, c.connectionId)
 
+	//解析失败的语句记为other
+	stmtType, start := "other", time.Now()
+	defer func() {
+		c.observeQuery(stmtType, start)
+	}()
+
 	sql = strings.TrimRight(sql, ";") //删除sql语句最后的分号
 
 	var stmt sqlparser.Statement
@@ -56,19 +65,18 @@ func (c *ClientConn) handleQuery(sql string) (err error) {
 		golog.Error("ClientConn", "handleQuery", err.Error(), c.connectionId /*"hasHandled", hasHandled,*/, "sql", sql)
 		return err
 	}
+	stmtType = statementType(stmt)
 	switch v := stmt.(type) {
 	case *sqlparser.Show:
 		return c.handleShow(v, sql, nil)
 	case *sqlparser.Select:
 		return c.handleSelect(v, sql, nil)
-	case *sqlparser.Insert:
+	case *sqlparser.Insert: // replace解析为Action为replace的Insert
 		return c.handleExec(sql, nil)
 	case *sqlparser.Update:
 		return c.handleExec(sql, nil)
 	case *sqlparser.Delete:
 		return c.handleExec(sql, nil)
-	// case *sqlparser.Replace: // Replace --> Insert
-	// 	return c.handleExec(sql, nil)
 	case *sqlparser.Set:
 		return c.handleSet(v, sql)
 	case *sqlparser.Begin:
@@ -143,14 +151,19 @@ func (c *ClientConn) newEmptyResultsetForColumns(columns []string) *mysql.Result
 	return r
 }
 
+// execContext 客户端没有设置CLIENT_FOUND_ROWS时update和on duplicate key update返回值改变的行数
+func (c *ClientConn) execContext() context.Context {
+	return backend.WithFoundRows(context.Background(), c.capability&mysql.CLIENT_FOUND_ROWS != 0)
+}
+
 func (c *ClientConn) handleExec(sql string, args []interface{}) error {
 	backend := c.GetBackendDB()
 	if backend == nil {
-		golog.Fatal("ClientConn", "handleExec", "no backend db", c.connectionId)
-		return c.writeOK(nil)
+		golog.Error("ClientConn", "handleExec", "no backend db", c.connectionId, "db", c.db)
+		return mysql.NewDefaultError(mysql.ER_NO_DB_ERROR)
 	}
 
-	rs, err := backend.Exec(sql, args...)
+	rs, err := backend.ExecContext(c.execContext(), sql, args...)
 	if err != nil {
 		golog.Error("ClientConn", "handleExec", err.Error(), c.connectionId)
 		return err
@@ -19,11 +19,16 @@ import (
 	"sqlproxy/core/golog"
 	"strconv"
 
+	"sqlproxy/backend"
 	"sqlproxy/core/errors"
 	"sqlproxy/core/hack"
 	"sqlproxy/mysql"
+	"sqlproxy/sqlparser"
 )
 
+// rows of a streamed resultset are written to the client every streamFlushSize bytes
+const streamFlushSize = 64 * 1024
+
 func formatValue(value interface{}) ([]byte, error) {
 	if value == nil {
 		return hack.Slice("NULL"), nil
@@ -143,30 +148,198 @@ func (c *ClientConn) buildResultset(fields []*mysql.Field, names []string, value
 	return r, nil
 }
 
-func (c *ClientConn) writeResultset(status uint16, r *mysql.Resultset) error {
-	c.affectedRows = int64(-1)
-	total := make([]byte, 0, 4096)
+// writeFieldsBatch writes the column count, column definitions and the EOF
+// that ends them, the part of a resultset before the rows.
+func (c *ClientConn) writeFieldsBatch(total []byte, fields []*mysql.Field, status uint16, direct bool) ([]byte, error) {
 	data := make([]byte, 4, 512)
 	var err error
 
-	columnLen := mysql.PutLengthEncodedInt(uint64(len(r.Fields)))
+	columnLen := mysql.PutLengthEncodedInt(uint64(len(fields)))
 
 	data = append(data, columnLen...)
 	total, err = c.writePacketBatch(total, data, false)
 	if err != nil {
-		return err
+		return total, err
 	}
 
-	for _, v := range r.Fields {
+	for _, v := range fields {
 		data = data[0:4]
 		data = append(data, v.Dump()...)
 		total, err = c.writePacketBatch(total, data, false)
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return c.writeEOFBatch(total, status, direct)
+}
+
+// writeCursorResultset streams the rows of cursor to the client, at most
+// streamFlushSize bytes are buffered before they are written to the socket,
+// so a slow client also slows down reading from the backend. stmt is used
+// to fill the table of the columns, it is nil if unknown.
+func (c *ClientConn) writeCursorResultset(status uint16, cursor *backend.Cursor, stmt *sqlparser.Select, binary bool) error {
+	c.affectedRows = int64(-1)
+	total := make([]byte, 0, streamFlushSize+4096)
+	data := make([]byte, 4, 512)
+	var err error
+
+	fields, fieldNames := cursor.Fields()
+	c.setFieldsTable(fields, stmt)
+	total, err = c.writeFieldsBatch(total, fields, status, false)
+	if err != nil {
+		return err
+	}
+
+	rowNum := 0
+	for {
+		row, err := cursor.Next()
+		if err == nil && row == nil {
+			break
+		}
+
+		var rowData mysql.RowData
+		if err == nil {
+			rowData, err = mysql.PacketRowData(fields, row, binary)
+		}
+		if err != nil {
+			//flush the rows already packed, the error packet follows them
+			if _, flushErr := c.writePacketBatch(total, nil, true); flushErr != nil {
+				return flushErr
+			}
+			return err
+		}
+
+		data = data[0:4]
+		data = append(data, rowData...)
+		total, err = c.writePacketBatch(total, data, false)
 		if err != nil {
 			return err
 		}
+		rowNum++
+
+		if len(total) >= streamFlushSize {
+			if _, err = c.writePacketBatch(total, nil, true); err != nil {
+				return err
+			}
+			total = total[:0]
+		}
 	}
 
-	total, err = c.writeEOFBatch(total, status, false)
+	total, err = c.writeEOFBatch(total, status, true)
+	total = nil
+	if err != nil {
+		return err
+	}
+
+	golog.Debug("ClientConn", "writeCursorResultset", "result info", c.connectionId,
+		"status", status, "rows", rowNum,
+		"columns", fieldNames)
+
+	return nil
+}
+
+// setFieldsTable fills schema, table and original column name of fields
+// selected from a single table. database/sql does not return the table of
+// a column, so like MySQL only plain column references get a table.
+func (c *ClientConn) setFieldsTable(fields []*mysql.Field, stmt *sqlparser.Select) {
+	if stmt == nil || len(stmt.From) != 1 {
+		return
+	}
+	tableExpr, ok := stmt.From[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return
+	}
+	tableName, ok := tableExpr.Expr.(sqlparser.TableName)
+	if !ok {
+		return
+	}
+
+	schema := c.db
+	if !tableName.Qualifier.IsEmpty() {
+		schema = tableName.Qualifier.String()
+	}
+	orgTable := tableName.Name.String()
+	table := orgTable
+	if !tableExpr.As.IsEmpty() {
+		table = tableExpr.As.String()
+	}
+
+	//select * 的列和select表达式无法一一对应
+	star := false
+	for _, expr := range stmt.SelectExprs {
+		if _, ok := expr.(*sqlparser.StarExpr); ok {
+			star = true
+		}
+	}
+	if star && len(stmt.SelectExprs) != 1 {
+		return
+	}
+
+	node := c.GetBackendDB()
+
+	for i, field := range fields {
+		if !star {
+			if i >= len(stmt.SelectExprs) {
+				return
+			}
+			expr, ok := stmt.SelectExprs[i].(*sqlparser.AliasedExpr)
+			if !ok {
+				continue
+			}
+			col, ok := expr.Expr.(*sqlparser.ColName)
+			if !ok {
+				continue
+			}
+			field.OrgName = []byte(col.Name.String())
+		}
+		field.Schema = []byte(schema)
+		field.Table = []byte(table)
+		field.OrgTable = []byte(orgTable)
+		c.setEnumFlag(node, field)
+		c.setKeyFlag(node, field)
+	}
+}
+
+// setKeyFlag 按转换器记录的主键和唯一索引设置PRI_KEY_FLAG和UNIQUE_KEY_FLAG，
+// 没有记录普通索引，不设置MULTIPLE_KEY_FLAG
+func (c *ClientConn) setKeyFlag(node *backend.BackendProxy, field *mysql.Field) {
+	if node == nil {
+		return
+	}
+	primary, unique := node.LookupKeyColumn(string(field.OrgTable), string(field.OrgName))
+	if primary {
+		field.Flag |= mysql.PRI_KEY_FLAG
+	}
+	if unique {
+		field.Flag |= mysql.UNIQUE_KEY_FLAG
+	}
+}
+
+// setEnumFlag 达梦中由enum和set转换的varchar列按MySQL的类型返回
+func (c *ClientConn) setEnumFlag(node *backend.BackendProxy, field *mysql.Field) {
+	if node == nil {
+		return
+	}
+	enum, ok := node.LookupEnumColumn(string(field.OrgTable), string(field.OrgName))
+	if !ok {
+		return
+	}
+	field.Type = mysql.MYSQL_TYPE_STRING
+	if enum.Type == "set" {
+		field.Flag |= mysql.SET_FLAG
+	} else {
+		field.Flag |= mysql.ENUM_FLAG
+	}
+}
+
+func (c *ClientConn) writeResultset(status uint16, r *mysql.Resultset) error {
+	c.affectedRows = int64(-1)
+	total := make([]byte, 0, 4096)
+	data := make([]byte, 4, 512)
+	var err error
+
+	total, err = c.writeFieldsBatch(total, r.Fields, status, false)
 	if err != nil {
 		return err
 	}
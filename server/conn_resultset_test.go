@@ -0,0 +1,291 @@
+package server
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"sqlproxy/config"
+	"sqlproxy/mysql"
+)
+
+func TestConn_StreamResultset(t *testing.T) {
+	const rowCount = 20000
+	rows := make([][]driver.Value, rowCount)
+	for i := range rows {
+		rows[i] = []driver.Value{int64(i), strings.Repeat("x", i%100)}
+	}
+	columns := []fakeColumn{{name: "id", typeName: "INT"}, {name: "name", typeName: "VARCHAR"}}
+	registerFakeResult("select id, name from stream_test", &fakeResult{columns: columns, rows: rows})
+	registerFakeResult("select id, name from stream_error_test", &fakeResult{
+		columns: columns,
+		rows:    rows[:10],
+		err:     errors.New("backend gone"),
+	})
+
+	s := newFakeNodeServer(t, "127.0.0.1:9702")
+	defer s.Close()
+
+	db, err := sql.Open("mysql", "testuser:testpwd@tcp(127.0.0.1:9702)/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	//text protocol and binary protocol
+	for _, args := range [][]interface{}{nil, {1}} {
+		query := "select id, name from stream_test"
+		if args != nil {
+			query += " where 1 = ?"
+			registerFakeResult(query, &fakeResult{columns: columns, rows: rows})
+		}
+		n, err := countRows(db, query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != rowCount {
+			t.Fatalf("%s: want %d rows, got %d", query, rowCount, n)
+		}
+	}
+
+	//an error after some rows have been sent
+	n, err := countRows(db, "select id, name from stream_error_test")
+	if err == nil || !strings.Contains(err.Error(), "backend gone") {
+		t.Fatalf("want backend error after %d rows, got %v", n, err)
+	}
+
+	//the connection is still usable after the error
+	if n, err = countRows(db, "select id, name from stream_test"); err != nil || n != rowCount {
+		t.Fatalf("after error: %d rows, %v", n, err)
+	}
+}
+
+func countRows(db *sql.DB, query string, args ...interface{}) (int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return n, err
+		}
+		if id != n || len(name) != n%100 {
+			return n, fmt.Errorf("unexpected row %d: %d %q", n, id, name)
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+func TestConn_ColumnMetadata(t *testing.T) {
+	const query = "select id, price as amount, name, created, data, notes, score, upper(name) from meta_test t"
+	registerFakeResult(query, &fakeResult{
+		columns: []fakeColumn{
+			{name: "id", typeName: "INT", notNull: true},
+			{name: "amount", typeName: "DECIMAL", precision: 10, scale: 2},
+			{name: "name", typeName: "VARCHAR", length: 20},
+			{name: "created", typeName: "TIMESTAMP"},
+			{name: "data", typeName: "BLOB"},
+			{name: "notes", typeName: "CLOB"},
+			{name: "score", typeName: "UNKNOWN", scanType: reflect.TypeOf(uint32(0))},
+			{name: "upper(name)", typeName: "VARCHAR", length: 20},
+		},
+		rows: [][]driver.Value{{int64(1), "9.99", "a", "2020-01-02 03:04:05", []byte{0}, "n", int64(1), "A"}},
+	})
+	s := newFakeNodeServer(t, "127.0.0.1:9703")
+	defer s.Close()
+
+	c := dialRawClient(t, "127.0.0.1:9703", "testuser", "testpwd")
+	defer c.Close()
+
+	if err := c.writeCommand(mysql.COM_INIT_DB, []byte("fake")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.readOK(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.writeCommand(mysql.COM_QUERY, []byte(query)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.readPacket(); err != nil {
+		t.Fatal(err)
+	}
+	packets, _, err := c.readUntilEOF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = c.readUntilEOF(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		orgName string
+		table   string
+		typ     uint8
+		flag    uint16
+		charset uint16
+		length  uint32
+		decimal uint8
+	}{
+		{"id", "t", mysql.MYSQL_TYPE_LONG, mysql.NUM_FLAG | mysql.NOT_NULL_FLAG, 63, 11, 0},
+		{"price", "t", mysql.MYSQL_TYPE_NEWDECIMAL, mysql.NUM_FLAG, 63, 12, 2},
+		{"name", "t", mysql.MYSQL_TYPE_VAR_STRING, 0, 33, 60, 0},
+		{"created", "t", mysql.MYSQL_TYPE_DATETIME, mysql.BINARY_FLAG, 63, 19, 0},
+		{"data", "t", mysql.MYSQL_TYPE_BLOB, mysql.BLOB_FLAG | mysql.BINARY_FLAG, 63, 4294967295, 0},
+		{"notes", "t", mysql.MYSQL_TYPE_BLOB, mysql.BLOB_FLAG, 33, 4294967295, 0},
+		{"score", "t", mysql.MYSQL_TYPE_LONGLONG, mysql.NUM_FLAG | mysql.UNSIGNED_FLAG, 63, 20, 0},
+		{"upper(name)", "", mysql.MYSQL_TYPE_VAR_STRING, 0, 33, 60, 0},
+	}
+	if len(packets) != len(tests) {
+		t.Fatalf("want %d fields, got %d", len(tests), len(packets))
+	}
+	for i, tt := range tests {
+		f, err := mysql.FieldData(packets[i]).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(f.OrgName) != tt.orgName || string(f.Table) != tt.table || f.Type != tt.typ ||
+			f.Flag != tt.flag || f.Charset != tt.charset || f.ColumnLength != tt.length || f.Decimal != tt.decimal {
+			t.Errorf("field %d: got %s %s.%s type %d flag %d charset %d length %d decimal %d", i,
+				f.Name, f.Table, f.OrgName, f.Type, f.Flag, f.Charset, f.ColumnLength, f.Decimal)
+		}
+		if tt.table != "" && (string(f.Schema) != "fake" || string(f.OrgTable) != "meta_test") {
+			t.Errorf("field %d: got schema %s org_table %s", i, f.Schema, f.OrgTable)
+		}
+	}
+
+	//the primary key and unique indexes recorded by the converter when the table is created
+	registerFakeResult(`select "id", "code", "a", "b" from "meta_key_test"`, &fakeResult{
+		columns: []fakeColumn{
+			{name: "id", typeName: "INT", notNull: true},
+			{name: "code", typeName: "VARCHAR", length: 10},
+			{name: "a", typeName: "INT"},
+			{name: "b", typeName: "INT"},
+		},
+	})
+	ks := newAuthTestServer(t, &config.Config{
+		Addr:       "127.0.0.1:9707",
+		UserList:   []config.UserConfig{{User: "testuser", Password: "testpwd"}},
+		Nodes:      []config.NodeConfig{{Name: "oracle", DriverName: "oci8", Datasource: "fake", MaxOpenConns: 4}},
+		SchemaList: []config.SchemaConfig{{User: "testuser", Nodes: []string{"oracle"}}},
+	})
+	defer ks.Close()
+
+	kc := dialRawClient(t, "127.0.0.1:9707", "testuser", "testpwd")
+	defer kc.Close()
+
+	if err := kc.writeCommand(mysql.COM_INIT_DB, []byte("oracle")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kc.readOK(); err != nil {
+		t.Fatal(err)
+	}
+	const ddl = "create table meta_key_test (id int primary key, code varchar(10) unique, a int, b int, unique key ab (a, b))"
+	if err := kc.writeCommand(mysql.COM_QUERY, []byte(ddl)); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := kc.readOK(); err != nil || data[0] != mysql.OK_HEADER {
+		t.Fatalf("create table: %v %q", err, data)
+	}
+	if err := kc.writeCommand(mysql.COM_QUERY, []byte("select id, code, a, b from meta_key_test")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kc.readPacket(); err != nil {
+		t.Fatal(err)
+	}
+	packets, _, err = kc.readUntilEOF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = kc.readUntilEOF(); err != nil {
+		t.Fatal(err)
+	}
+
+	//a and b are in a unique key of two columns, which gets no flag
+	keyFlags := []uint16{mysql.PRI_KEY_FLAG, mysql.UNIQUE_KEY_FLAG, 0, 0}
+	if len(packets) != len(keyFlags) {
+		t.Fatalf("want %d fields, got %d", len(keyFlags), len(packets))
+	}
+	for i, flag := range keyFlags {
+		f, err := mysql.FieldData(packets[i]).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.Flag & (mysql.PRI_KEY_FLAG | mysql.UNIQUE_KEY_FLAG); got != flag {
+			t.Errorf("field %s: want key flag %d, got %d", f.OrgName, flag, got)
+		}
+	}
+}
+
+func TestConn_BinaryResultset(t *testing.T) {
+	const query = "select * from binary_test where id = ?"
+	registerFakeResult(query, &fakeResult{
+		columns: []fakeColumn{
+			{name: "tiny", typeName: "TINYINT"},
+			{name: "small", typeName: "SMALLINT"},
+			{name: "i", typeName: "INT"},
+			{name: "big", typeName: "BIGINT"},
+			{name: "ubig", typeName: "UNKNOWN", scanType: reflect.TypeOf(uint64(0))},
+			{name: "f", typeName: "REAL"},
+			{name: "d", typeName: "DOUBLE"},
+			{name: "dec", typeName: "DECIMAL", precision: 10, scale: 2},
+			{name: "s", typeName: "VARCHAR"},
+			{name: "b", typeName: "BLOB"},
+			{name: "dt", typeName: "DATE"},
+			{name: "ts", typeName: "TIMESTAMP"},
+			{name: "tm", typeName: "TIME"},
+			{name: "n", typeName: "VARCHAR"},
+			{name: "bit", typeName: "BIT"},
+		},
+		rows: [][]driver.Value{{
+			"-5", "-300", "70000", "-9000000000", "18446744073709551615", "1.5", "2.25", "12.34",
+			"abc", []byte{0, 1}, "2020-01-02", "2020-01-02 03:04:05", "-25:00:01", nil, true,
+		}},
+	})
+	s := newFakeNodeServer(t, "127.0.0.1:9704")
+	defer s.Close()
+
+	db, err := sql.Open("mysql", "testuser:testpwd@tcp(127.0.0.1:9704)/?parseTime=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var (
+		tiny, small, i, big int64
+		ubig                uint64
+		f, d                float64
+		dec, str, tm        string
+		b                   []byte
+		dt, ts              time.Time
+		n                   sql.NullString
+		bit                 bool
+	)
+	err = db.QueryRow(query, 1).Scan(&tiny, &small, &i, &big, &ubig, &f, &d, &dec, &str, &b, &dt, &ts, &tm, &n, &bit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tiny != -5 || small != -300 || i != 70000 || big != -9000000000 || ubig != 18446744073709551615 {
+		t.Errorf("integers: %d %d %d %d %d", tiny, small, i, big, ubig)
+	}
+	if f != 1.5 || d != 2.25 || dec != "12.34" {
+		t.Errorf("numbers: %v %v %s", f, d, dec)
+	}
+	if str != "abc" || string(b) != "\x00\x01" || n.Valid || !bit {
+		t.Errorf("strings: %q %v %v %v", str, b, n, bit)
+	}
+	if !dt.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)) ||
+		!ts.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) || tm != "-25:00:01" {
+		t.Errorf("times: %v %v %s", dt, ts, tm)
+	}
+}
@@ -15,6 +15,8 @@
 package server
 
 import (
+	"database/sql"
+	"fmt"
 	"sqlproxy/core/golog"
 	"sqlproxy/mysql"
 	"sqlproxy/sqlparser"
@@ -28,6 +30,7 @@ const (
 	MaxFunc          = "max"
 	MinFunc          = "min"
 	LastInsertIdFunc = "last_insert_id"
+	RowCountFunc     = "row_count"
 	FUNC_EXIST       = 1
 )
 
@@ -43,24 +46,17 @@ func (c *ClientConn) handleUnion(stmt *sqlparser.Union, sql string, args []inter
 
 	backend := c.GetBackendDB()
 	if backend == nil {
-		golog.Fatal("ClientConn", "handleSelect", "backend is nil", c.connectionId, "db", c.db)
-		r := c.newEmptyResultset(stmt.Left.(*sqlparser.Select))
-		return c.writeResultset(c.status, r)
+		golog.Error("ClientConn", "handleUnion", "backend is nil", c.connectionId, "db", c.db)
+		return mysql.NewDefaultError(mysql.ER_NO_DB_ERROR)
 	}
-	rs, err := backend.Query(sql, args...)
+	cursor, err := backend.OpenCursor(sql, args...)
 	if err != nil {
-		golog.Error("ClientConn", "handleSelect", err.Error(), c.connectionId)
+		golog.Error("ClientConn", "handleUnion", err.Error(), c.connectionId)
 		return err
 	}
-	status := c.status | rs.Status
-	if rs.Resultset != nil {
-		err = c.writeResultset(status, rs.Resultset)
-	} else {
-		r := c.newEmptyResultset(stmt.Left.(*sqlparser.Select))
-		err = c.writeResultset(status, r)
-	}
+	defer cursor.Close()
 
-	return err
+	return c.writeCursorResultset(c.status, cursor, nil, false)
 }
 
 // 处理select语句
@@ -68,27 +64,23 @@ func (c *ClientConn) handleSelect(stmt *sqlparser.Select, sql string, args []int
 	if len(stmt.From) == 1 && sqlparser.IsDualTable(stmt.From[0]) && strings.Contains(sql, "@") { //查询环境变量
 		return c.handleVariableSelect(stmt)
 	}
+	if isSessionFuncSelect(stmt) {
+		return c.handleSessionFuncSelect(stmt, false)
+	}
 
 	backend := c.GetBackendDB()
 	if backend == nil {
-		golog.Fatal("ClientConn", "handleSelect", "backend is nil", c.connectionId, "db", c.db)
-		r := c.newEmptyResultset(stmt)
-		return c.writeResultset(c.status, r)
+		golog.Error("ClientConn", "handleSelect", "backend is nil", c.connectionId, "db", c.db)
+		return mysql.NewDefaultError(mysql.ER_NO_DB_ERROR)
 	}
-	rs, err := backend.Query(sql, args...)
+	cursor, err := backend.OpenCursor(sql, args...)
 	if err != nil {
 		golog.Error("ClientConn", "handleSelect", err.Error(), c.connectionId)
 		return err
 	}
-	status := c.status | rs.Status
-	if rs.Resultset != nil {
-		err = c.writeResultset(status, rs.Resultset)
-	} else {
-		r := c.newEmptyResultset(stmt)
-		err = c.writeResultset(status, r)
-	}
+	defer cursor.Close()
 
-	return err
+	return c.writeCursorResultset(c.status, cursor, stmt, false)
 }
 
 func (c *ClientConn) handleVariableSelect(stmt *sqlparser.Select) error {
@@ -119,3 +111,58 @@ func (c *ClientConn) handleVariableSelect(stmt *sqlparser.Select) error {
 	rs, _ := c.buildResultset(nil, columns, [][]interface{}{row})
 	return c.writeResultset(status, rs)
 }
+
+// isSessionFuncSelect 判断是否只查询last_insert_id()和row_count()，
+// 后端的连接不固定，这两个函数的值由proxy按会话记录
+func isSessionFuncSelect(stmt *sqlparser.Select) bool {
+	if len(stmt.From) != 1 || !sqlparser.IsDualTable(stmt.From[0]) || stmt.Where != nil {
+		return false
+	}
+	for _, expr := range stmt.SelectExprs {
+		aliased, ok := expr.(*sqlparser.AliasedExpr)
+		if !ok {
+			return false
+		}
+		fun, ok := aliased.Expr.(*sqlparser.FuncExpr)
+		if !ok || len(fun.Exprs) != 0 {
+			return false
+		}
+		if name := fun.Name.Lowered(); name != LastInsertIdFunc && name != RowCountFunc {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *ClientConn) handleSessionFuncSelect(stmt *sqlparser.Select, binary bool) error {
+	columns := make([]string, 0, len(stmt.SelectExprs))
+	row := make([]interface{}, 0, len(stmt.SelectExprs))
+	for _, expr := range stmt.SelectExprs {
+		aliased := expr.(*sqlparser.AliasedExpr)
+		if aliased.As.IsEmpty() {
+			columns = append(columns, sqlparser.String(aliased.Expr))
+		} else {
+			columns = append(columns, aliased.As.String())
+		}
+		if aliased.Expr.(*sqlparser.FuncExpr).Name.Lowered() == LastInsertIdFunc {
+			row = append(row, uint64(c.lastInsertId))
+		} else {
+			row = append(row, c.affectedRows)
+		}
+	}
+	rs, err := c.buildResultset(nil, columns, [][]interface{}{row})
+	if err != nil {
+		return err
+	}
+	// 预处理语句的结果集使用二进制协议
+	if binary {
+		values := make([]sql.RawBytes, 0, len(row))
+		for _, v := range row {
+			values = append(values, sql.RawBytes(fmt.Sprint(v)))
+		}
+		if rs.RowDatas[0], err = mysql.PacketRowData(rs.Fields, values, true); err != nil {
+			return err
+		}
+	}
+	return c.writeResultset(c.status, rs)
+}
@@ -20,7 +20,9 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"time"
 
+	"sqlproxy/backend"
 	"sqlproxy/core/golog"
 	"sqlproxy/core/hack"
 	"sqlproxy/mysql"
@@ -49,12 +51,27 @@ type Stmt struct {
 	s sqlparser.Statement
 
 	sql string
+
+	//server side cursor opened by COM_STMT_EXECUTE with CURSOR_TYPE_READ_ONLY
+	cursor *backend.Cursor
+	fields []*mysql.Field
 }
 
 func (s *Stmt) ResetParams() {
 	s.args = make([]interface{}, s.params)
 }
 
+func (s *Stmt) CloseCursor() {
+	if s.cursor == nil {
+		return
+	}
+	if err := s.cursor.Close(); err != nil {
+		golog.Warn("Stmt", "CloseCursor", err.Error(), 0, "stmt_id", s.id)
+	}
+	s.cursor = nil
+	s.fields = nil
+}
+
 func (c *ClientConn) handleStmtPrepare(sql string) error {
 
 	s := new(Stmt)
@@ -165,13 +182,18 @@ func (c *ClientConn) handleStmtExecute(data []byte) error {
 			strconv.FormatUint(uint64(id), 10), "stmt_execute")
 	}
 
+	defer c.observeQuery(statementType(s.s), time.Now())
+
 	flag := data[pos]
 	pos++
-	//now we only support CURSOR_TYPE_NO_CURSOR flag
-	if flag != 0 {
+	//now we only support CURSOR_TYPE_NO_CURSOR and CURSOR_TYPE_READ_ONLY flag
+	if flag&^mysql.CURSOR_TYPE_READ_ONLY != 0 {
 		return mysql.NewError(mysql.ER_UNKNOWN_ERROR, fmt.Sprintf("unsupported flag %d", flag))
 	}
 
+	//executing the statement again closes the cursor of last execution
+	s.CloseCursor()
+
 	//skip iteration-count, always 1
 	pos += 4
 
@@ -211,15 +233,17 @@ func (c *ClientConn) handleStmtExecute(data []byte) error {
 
 	switch stmt := s.s.(type) {
 	case *sqlparser.Select:
-		err = c.handlePrepareSelect(stmt, s.sql, s.args)
-	case *sqlparser.Insert:
+		if flag&mysql.CURSOR_TYPE_READ_ONLY != 0 {
+			err = c.handlePrepareCursor(stmt, s)
+		} else {
+			err = c.handlePrepareSelect(stmt, s.sql, s.args)
+		}
+	case *sqlparser.Insert: // replace解析为Action为replace的Insert
 		err = c.handlePrepareExec(s.s, s.sql, s.args)
 	case *sqlparser.Update:
 		err = c.handlePrepareExec(s.s, s.sql, s.args)
 	case *sqlparser.Delete:
 		err = c.handlePrepareExec(s.s, s.sql, s.args)
-	// case *sqlparser.Replace:
-	// 	err = c.handlePrepareExec(s.s, s.sql, s.args)
 	default:
 		err = fmt.Errorf("command %T not supported now", stmt)
 	}
@@ -230,28 +254,108 @@ func (c *ClientConn) handleStmtExecute(data []byte) error {
 }
 
 func (c *ClientConn) handlePrepareSelect(stmt *sqlparser.Select, sql string, args []interface{}) error {
-	var rs *mysql.Result
+	if isSessionFuncSelect(stmt) {
+		return c.handleSessionFuncSelect(stmt, true)
+	}
+
 	backend := c.GetBackendDB()
 	if backend == nil {
-		golog.Fatal("ClientConn", "handlePrepareSelect", "no backend db", c.connectionId)
-		r := c.newEmptyResultset(stmt)
-		return c.writeResultset(c.status, r)
+		golog.Error("ClientConn", "handlePrepareSelect", "no backend db", c.connectionId, "db", c.db)
+		return mysql.NewDefaultError(mysql.ER_NO_DB_ERROR)
 	}
 
-	rs, err := backend.StmtQuery(sql, args...)
+	cursor, err := backend.OpenCursor(sql, args...)
 	if err != nil {
 		golog.Error("ClientConn", "handlePrepareSelect", err.Error(), c.connectionId)
 		return err
 	}
+	defer cursor.Close()
 
-	status := c.status | rs.Status
-	if rs.Resultset != nil {
-		err = c.writeResultset(status, rs.Resultset)
-	} else {
-		r := c.newEmptyResultset(stmt)
-		err = c.writeResultset(status, r)
+	return c.writeCursorResultset(c.status, cursor, stmt, true)
+}
+
+// handlePrepareCursor opens a cursor on the backend and only sends the
+// column definitions, rows are sent by COM_STMT_FETCH.
+func (c *ClientConn) handlePrepareCursor(stmt *sqlparser.Select, s *Stmt) error {
+	backend := c.GetBackendDB()
+	if backend == nil {
+		golog.Error("ClientConn", "handlePrepareCursor", "no backend db", c.connectionId, "db", c.db)
+		return mysql.NewDefaultError(mysql.ER_NO_DB_ERROR)
+	}
+
+	cursor, err := backend.OpenCursor(s.sql, s.args...)
+	if err != nil {
+		golog.Error("ClientConn", "handlePrepareCursor", err.Error(), c.connectionId)
+		return err
+	}
+	s.cursor = cursor
+	s.fields, _ = cursor.Fields()
+	c.setFieldsTable(s.fields, stmt)
+
+	c.affectedRows = int64(-1)
+	total := make([]byte, 0, 1024)
+	total, err = c.writeFieldsBatch(total, s.fields, c.status|mysql.SERVER_STATUS_CURSOR_EXISTS, true)
+	total = nil
+	if err != nil {
+		s.CloseCursor()
+		return err
 	}
+	return nil
+}
+
+func (c *ClientConn) handleStmtFetch(data []byte) error {
+	if len(data) < 8 {
+		return mysql.ErrMalformPacket
+	}
+
+	id := binary.LittleEndian.Uint32(data[0:4])
+	numRows := binary.LittleEndian.Uint32(data[4:8])
+
+	s, ok := c.stmts[id]
+	if !ok {
+		return mysql.NewDefaultError(mysql.ER_UNKNOWN_STMT_HANDLER,
+			strconv.FormatUint(uint64(id), 10), "stmt_fetch")
+	}
+	if s.cursor == nil {
+		return mysql.NewDefaultError(mysql.ER_STMT_HAS_NO_OPEN_CURSOR, id)
+	}
+
+	var err error
+	var lastRow bool
+	total := make([]byte, 0, 4096)
+	data = make([]byte, 4, 512)
+	for i := uint32(0); i < numRows; i++ {
+		row, err := s.cursor.Next()
+		if err != nil {
+			s.CloseCursor()
+			return err
+		}
+		if row == nil {
+			lastRow = true
+			break
+		}
 
+		rowData, err := mysql.PacketRowData(s.fields, row, true)
+		if err != nil {
+			s.CloseCursor()
+			return err
+		}
+		data = data[0:4]
+		data = append(data, rowData...)
+		total, err = c.writePacketBatch(total, data, false)
+		if err != nil {
+			s.CloseCursor()
+			return err
+		}
+	}
+
+	status := c.status | mysql.SERVER_STATUS_CURSOR_EXISTS
+	if lastRow {
+		status |= mysql.SERVER_STATUS_LAST_ROW_SEND
+		s.CloseCursor()
+	}
+	total, err = c.writeEOFBatch(total, status, true)
+	total = nil
 	return err
 }
 
@@ -260,11 +364,11 @@ func (c *ClientConn) handlePrepareExec(stmt sqlparser.Statement, sql string, arg
 
 	backend := c.GetBackendDB()
 	if backend == nil {
-		golog.Fatal("ClientConn", "handlePrepareExec", "no backend db", c.connectionId)
-		return c.writeOK(nil)
+		golog.Error("ClientConn", "handlePrepareExec", "no backend db", c.connectionId, "db", c.db)
+		return mysql.NewDefaultError(mysql.ER_NO_DB_ERROR)
 	}
 
-	rs, err := backend.Exec(sql, args...)
+	rs, err := backend.ExecContext(c.execContext(), sql, args...)
 	if err != nil {
 		golog.Error("ClientConn", "handlePrepareExec", err.Error(), c.connectionId)
 		return err
@@ -452,6 +556,7 @@ func (c *ClientConn) handleStmtReset(data []byte) error {
 	}
 
 	s.ResetParams()
+	s.CloseCursor()
 
 	return c.writeOK(nil)
 }
@@ -463,6 +568,9 @@ func (c *ClientConn) handleStmtClose(data []byte) error {
 
 	id := binary.LittleEndian.Uint32(data[0:4])
 
+	if s, ok := c.stmts[id]; ok {
+		s.CloseCursor()
+	}
 	delete(c.stmts, id)
 
 	return nil
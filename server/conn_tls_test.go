@@ -0,0 +1,130 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sqlproxy/config"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// writeSelfSignedCert writes a self-signed certificate for 127.0.0.1 into dir
+// and returns the cert and key file names.
+func writeSelfSignedCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sqlproxy-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "server.pem")
+	keyFile := filepath.Join(dir, "server.key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// newTLSTestServer starts a server without backend nodes, which is enough
+// to run the handshake and answer COM_PING.
+func newTLSTestServer(t *testing.T, addr string, requireSecure bool) (*Server, string) {
+	dir, err := ioutil.TempDir("", "sqlproxy-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := writeSelfSignedCert(t, dir)
+
+	cfg := &config.Config{
+		Addr:                   addr,
+		UserList:               []config.UserConfig{{User: "testuser", Password: "testpwd"}},
+		TLSCert:                certFile,
+		TLSKey:                 keyFile,
+		RequireSecureTransport: requireSecure,
+	}
+	s, err := NewServer(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	go s.Run()
+	return s, certFile
+}
+
+func registerTestTLSConfig(t *testing.T, certFile string) {
+	certData, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certData)
+	if err := mysql.RegisterTLSConfig("custom", &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConn_TLSHandshake(t *testing.T) {
+	s, certFile := newTLSTestServer(t, "127.0.0.1:9697", true)
+	defer s.Close()
+	defer os.RemoveAll(filepath.Dir(certFile))
+	registerTestTLSConfig(t, certFile)
+
+	db, err := sql.Open("mysql", "testuser:testpwd@tcp(127.0.0.1:9697)/?tls=custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConn_RequireSecureTransport(t *testing.T) {
+	s, certFile := newTLSTestServer(t, "127.0.0.1:9698", true)
+	defer s.Close()
+	defer os.RemoveAll(filepath.Dir(certFile))
+
+	db, err := sql.Open("mysql", "testuser:testpwd@tcp(127.0.0.1:9698)/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Ping()
+	if mysqlErr, ok := err.(*mysql.MySQLError); !ok || mysqlErr.Number != 3159 {
+		t.Fatalf("want ER_SECURE_TRANSPORT_REQUIRED, got %v", err)
+	}
+}
@@ -40,6 +40,7 @@ func (c *ClientConn) handleBegin() error {
 		if err := c.txConn.Commit(); err != nil {
 			golog.Warn("ClientConn", "handleBegin", err.Error(), c.connectionId)
 		}
+		c.txConn = nil
 	}
 	backend := c.GetBackendDB()
 	if backend == nil {
@@ -26,12 +26,17 @@ func (c *ClientConn) handleUseDB(dbName string) error {
 		return fmt.Errorf("must have database, the length of dbName is zero")
 	}
 	if c.proxy.GetNode(dbName) == nil {
-		return mysql.NewDefaultError(mysql.ER_NO_DB_ERROR)
+		return mysql.NewDefaultError(mysql.ER_BAD_DB_ERROR, dbName)
 	}
 	if !c.CanAccess(dbName) {
 		return mysql.NewDefaultError(mysql.ER_DBACCESS_DENIED_ERROR, c.user, c.c.RemoteAddr().String(), dbName)
 	}
 
+	// 事务中切换db时，事务仍然留在开启它的节点上，提交或回滚后再路由到新节点
+	if c.txConn != nil {
+		golog.Info("ClientConn", "handleUseDB", "switch db in transaction, keep tx on its node", c.connectionId,
+			"from", c.db, "to", dbName)
+	}
 	c.db = dbName
 	golog.Debug("ClientConn", "handleUseDB", "switch db", c.connectionId, "db", dbName)
 	return c.writeOK(nil)
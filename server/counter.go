@@ -23,10 +23,11 @@ type Counter struct {
 	OldErrLogTotal  int64
 	OldSlowLogTotal int64
 
-	ClientConns  int64
-	ClientQPS    int64
-	ErrLogTotal  int64
-	SlowLogTotal int64
+	ClientConns     int64
+	ClientQPS       int64
+	ErrLogTotal     int64
+	SlowLogTotal    int64
+	DeniedConnTotal int64
 }
 
 func (counter *Counter) IncrClientConns() {
@@ -49,6 +50,10 @@ func (counter *Counter) IncrSlowLogTotal() {
 	atomic.AddInt64(&counter.SlowLogTotal, 1)
 }
 
+func (counter *Counter) IncrDeniedConnTotal() {
+	atomic.AddInt64(&counter.DeniedConnTotal, 1)
+}
+
 //flush the count per second
 func (counter *Counter) FlushCounter() {
 	atomic.StoreInt64(&counter.OldClientQPS, counter.ClientQPS)
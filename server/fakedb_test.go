@@ -0,0 +1,157 @@
+package server
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// fakedb is a database/sql driver that answers queries registered by the
+// tests, so that the proxy can be tested end to end without a backend.
+
+type fakeColumn struct {
+	name     string
+	typeName string
+	//length, precision and scale are unknown if 0
+	length    int64
+	precision int64
+	scale     int64
+	notNull   bool
+	scanType  reflect.Type
+}
+
+type fakeResult struct {
+	columns []fakeColumn
+	rows    [][]driver.Value
+	//err is returned by Next after the rows, instead of io.EOF
+	err error
+}
+
+var fakeResults = struct {
+	sync.RWMutex
+	m map[string]*fakeResult
+}{m: make(map[string]*fakeResult)}
+
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+	//oci8 is not linked into the tests, the nodes of the fake driver under its
+	//name convert the SQL with the Oracle converter
+	sql.Register("oci8", fakeDriver{})
+}
+
+func registerFakeResult(query string, r *fakeResult) {
+	fakeResults.Lock()
+	fakeResults.m[query] = r
+	fakeResults.Unlock()
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{}, nil
+}
+
+type fakeConn struct{}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	return nil
+}
+
+type fakeStmt struct {
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	fakeResults.RLock()
+	r, ok := fakeResults.m[s.query]
+	fakeResults.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("fakedb: unknown query %q", s.query)
+	}
+	return &fakeRows{result: r}, nil
+}
+
+type fakeRows struct {
+	result *fakeResult
+	pos    int
+}
+
+func (r *fakeRows) Columns() []string {
+	names := make([]string, len(r.result.columns))
+	for i, c := range r.result.columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+func (r *fakeRows) ColumnTypeDatabaseTypeName(index int) string {
+	return r.result.columns[index].typeName
+}
+
+func (r *fakeRows) ColumnTypeLength(index int) (int64, bool) {
+	c := r.result.columns[index]
+	return c.length, c.length > 0
+}
+
+func (r *fakeRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	c := r.result.columns[index]
+	return c.precision, c.scale, c.precision > 0
+}
+
+func (r *fakeRows) ColumnTypeNullable(index int) (bool, bool) {
+	return !r.result.columns[index].notNull, true
+}
+
+func (r *fakeRows) ColumnTypeScanType(index int) reflect.Type {
+	if t := r.result.columns[index].scanType; t != nil {
+		return t
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.result.rows) {
+		if r.result.err != nil {
+			return r.result.err
+		}
+		return io.EOF
+	}
+	copy(dest, r.result.rows[r.pos])
+	r.pos++
+	return nil
+}
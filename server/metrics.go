@@ -0,0 +1,157 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"sqlproxy/core/golog"
+	"sqlproxy/mysql"
+	"sqlproxy/sqlparser"
+)
+
+var (
+	clientConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sqlproxy_client_connections",
+		Help: "Authenticated client connections.",
+	}, []string{"user"})
+	queryTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sqlproxy_queries_total",
+		Help: "Statements executed by clients, the QPS is the rate of it.",
+	}, []string{"type"})
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "sqlproxy_query_duration_seconds",
+		Help: "Latency of the statements executed by clients.",
+	}, []string{"type"})
+	slowQueryTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sqlproxy_slow_queries_total",
+		Help: "Statements slower than slow_log_time.",
+	}, []string{"type"})
+	errorTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sqlproxy_errors_total",
+		Help: "Errors sent to clients by MySQL error code.",
+	}, []string{"code"})
+)
+
+func init() {
+	prometheus.MustRegister(clientConnections, queryTotal, queryDuration, slowQueryTotal, errorTotal)
+}
+
+// statementType returns the type label of stmt in the query metrics.
+func statementType(stmt sqlparser.Statement) string {
+	switch v := stmt.(type) {
+	case *sqlparser.Select, *sqlparser.Union:
+		return "select"
+	case *sqlparser.Insert:
+		if v.Action == sqlparser.ReplaceStr {
+			return "replace"
+		}
+		return "insert"
+	case *sqlparser.Update:
+		return "update"
+	case *sqlparser.Delete:
+		return "delete"
+	case *sqlparser.Set:
+		return "set"
+	case *sqlparser.Show:
+		return "show"
+	case *sqlparser.Use:
+		return "use"
+	case *sqlparser.Begin:
+		return "begin"
+	case *sqlparser.Commit:
+		return "commit"
+	case *sqlparser.Rollback:
+		return "rollback"
+	case *sqlparser.DDL, *sqlparser.DBDDL:
+		return "ddl"
+	default:
+		return "other"
+	}
+}
+
+// observeQuery records a statement started at start, slow queries are only
+// counted if slow_log_time is set.
+func (c *ClientConn) observeQuery(stmtType string, start time.Time) {
+	elapsed := time.Since(start)
+	queryTotal.WithLabelValues(stmtType).Inc()
+	queryDuration.WithLabelValues(stmtType).Observe(elapsed.Seconds())
+
+	slowLogTime := c.proxy.GetSlowLogTime()
+	if slowLogTime > 0 && elapsed >= time.Duration(slowLogTime)*time.Millisecond {
+		slowQueryTotal.WithLabelValues(stmtType).Inc()
+	}
+}
+
+func observeError(e *mysql.SqlError) {
+	errorTotal.WithLabelValues(strconv.Itoa(int(e.Code))).Inc()
+}
+
+var (
+	backendOpenDesc = prometheus.NewDesc("sqlproxy_backend_open_connections",
+		"Connections to the backend node, both in use and idle.", []string{"node"}, nil)
+	backendInUseDesc = prometheus.NewDesc("sqlproxy_backend_in_use_connections",
+		"Connections to the backend node in use.", []string{"node"}, nil)
+	backendIdleDesc = prometheus.NewDesc("sqlproxy_backend_idle_connections",
+		"Idle connections to the backend node.", []string{"node"}, nil)
+	backendWaitDesc = prometheus.NewDesc("sqlproxy_backend_wait_total",
+		"Times waited for a connection to the backend node.", []string{"node"}, nil)
+	backendWaitDurationDesc = prometheus.NewDesc("sqlproxy_backend_wait_seconds_total",
+		"Time blocked waiting for a connection to the backend node.", []string{"node"}, nil)
+)
+
+// nodeCollector collects the connection pool statistics of the nodes on
+// every scrape.
+type nodeCollector struct {
+	s *Server
+}
+
+func (c nodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- backendOpenDesc
+	ch <- backendInUseDesc
+	ch <- backendIdleDesc
+	ch <- backendWaitDesc
+	ch <- backendWaitDurationDesc
+}
+
+func (c nodeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.s.configUpdateMutex.RLock()
+	nodes := c.s.nodes
+	c.s.configUpdateMutex.RUnlock()
+
+	for name, node := range nodes {
+		stats := node.Stats()
+		ch <- prometheus.MustNewConstMetric(backendOpenDesc, prometheus.GaugeValue, float64(stats.OpenConnections), name)
+		ch <- prometheus.MustNewConstMetric(backendInUseDesc, prometheus.GaugeValue, float64(stats.InUse), name)
+		ch <- prometheus.MustNewConstMetric(backendIdleDesc, prometheus.GaugeValue, float64(stats.Idle), name)
+		ch <- prometheus.MustNewConstMetric(backendWaitDesc, prometheus.CounterValue, float64(stats.WaitCount), name)
+		ch <- prometheus.MustNewConstMetric(backendWaitDurationDesc, prometheus.CounterValue, stats.WaitDuration.Seconds(), name)
+	}
+}
+
+// serveMetrics exports the metrics for Prometheus on prometheus_addr, the
+// node statistics are registered per server besides the global metrics.
+func (s *Server) serveMetrics() {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(nodeCollector{s})
+	handler := promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, registry},
+		promhttp.HandlerOpts{ErrorLog: metricsErrorLog{}})
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	err := http.Serve(s.metricsListener, mux)
+	if err != nil && s.running {
+		golog.Error("server", "serveMetrics", err.Error(), 0)
+	}
+}
+
+// metricsErrorLog writes the errors of the metrics handler to golog.
+type metricsErrorLog struct{}
+
+func (metricsErrorLog) Println(v ...interface{}) {
+	golog.Warn("server", "serveMetrics", fmt.Sprint(v...), 0)
+}
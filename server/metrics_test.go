@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bufio"
+	"database/sql"
+	"database/sql/driver"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"sqlproxy/config"
+)
+
+// scrapeMetrics returns the samples exported on addr by name with labels.
+func scrapeMetrics(t *testing.T, addr string) map[string]float64 {
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("unexpected content type %s", resp.Header.Get("Content-Type"))
+	}
+
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(strings.NewReader(string(body)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("bad sample %q", line)
+		}
+		samples[line[:i]] = v
+	}
+	return samples
+}
+
+func TestServer_Metrics(t *testing.T) {
+	registerFakeResult("select id from metrics_test", &fakeResult{
+		columns: []fakeColumn{{name: "id", typeName: "INT"}},
+		rows:    [][]driver.Value{{int64(1)}},
+	})
+	s := newAuthTestServer(t, &config.Config{
+		Addr:           "127.0.0.1:9705",
+		PrometheusAddr: "127.0.0.1:9706",
+		UserList:       []config.UserConfig{{User: "metricsuser", Password: "testpwd"}},
+		Nodes:          []config.NodeConfig{{Name: "fake", DriverName: "fakedb", Datasource: "fake", MaxOpenConns: 4}},
+		SchemaList:     []config.SchemaConfig{{User: "metricsuser", Nodes: []string{"fake"}}},
+	})
+	defer s.Close()
+
+	before := scrapeMetrics(t, "127.0.0.1:9706")
+
+	db, err := sql.Open("mysql", "metricsuser:testpwd@tcp(127.0.0.1:9705)/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	var id int
+	if err = db.QueryRow("select id from metrics_test").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("use nosuchdb"); err == nil {
+		t.Fatal("want error for unknown database")
+	}
+
+	after := scrapeMetrics(t, "127.0.0.1:9706")
+	deltas := map[string]float64{
+		`sqlproxy_client_connections{user="metricsuser"}`:                 1,
+		`sqlproxy_queries_total{type="select"}`:                           1,
+		`sqlproxy_queries_total{type="use"}`:                              1,
+		`sqlproxy_query_duration_seconds_count{type="select"}`:            1,
+		`sqlproxy_query_duration_seconds_bucket{type="select",le="+Inf"}`: 1,
+		`sqlproxy_errors_total{code="1049"}`:                              1,
+	}
+	for name, delta := range deltas {
+		if got := after[name] - before[name]; got != delta {
+			t.Errorf("%s: want +%v, got +%v", name, delta, got)
+		}
+	}
+	if after[`sqlproxy_backend_open_connections{node="fake"}`] < 1 {
+		t.Errorf("backend connections not exported: %v", after)
+	}
+
+	//slow queries are counted only if slow_log_time is set
+	c := &ClientConn{proxy: s}
+	slow := slowQueryTotal.WithLabelValues("update")
+	c.observeQuery("update", time.Now().Add(-time.Second))
+	if testutil.ToFloat64(slow) != 0 {
+		t.Fatal("slow query counted without slow_log_time")
+	}
+	s.slowLogTime[s.slowLogTimeIndex] = 100
+	c.observeQuery("update", time.Now().Add(-time.Second))
+	c.observeQuery("update", time.Now())
+	if got := testutil.ToFloat64(slow); got != 1 {
+		t.Fatalf("want 1 slow query, got %v", got)
+	}
+}
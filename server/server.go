@@ -16,8 +16,11 @@ package server
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"os"
 	"runtime"
@@ -32,6 +35,7 @@ import (
 	"sqlproxy/config"
 	"sqlproxy/core/errors"
 	"sqlproxy/core/golog"
+	"sqlproxy/sqlparser"
 
 	// "sqlproxy/proxy/router"
 	"sync"
@@ -55,7 +59,7 @@ type AcceptListener interface {
 type Server struct {
 	cfg   *config.Config
 	addr  string
-	users map[string]string //user : psw
+	users map[string][]byte //user : SHA1(SHA1(psw))
 
 	statusIndex        int32
 	status             [2]int32
@@ -67,14 +71,23 @@ type Server struct {
 	blacklistSqls      [2]*BlacklistSqls
 	allowipsIndex      BoolIndex
 	allowips           [2][]IPInfo
+	userAllowips       map[string][]IPInfo // user : allow ips
+	tlsConfig          *tls.Config         // nil if client TLS is not configured
+	defaultAuthPlugin  string              // auth plugin announced in the initial handshake
+	userAuthPlugins    map[string]string   // user : auth plugin
+	sha2Cache          *sha2PasswordCache  // caching_sha2_password fast auth cache
+	rsaKey             *rsaKeyHolder       // key pair for caching_sha2_password full auth
 
 	counter *Counter
 	nodes   map[string]*backend.BackendProxy // dbname -> node
 	schemas map[string][]string              // user -> nodes
 
-	acceptListener AcceptListener
-	listener       net.Listener
-	running        bool
+	rewriteRules *sqlparser.RewriteRules // nil if rewrite_rules_file is not set
+
+	acceptListener  AcceptListener
+	listener        net.Listener
+	metricsListener net.Listener // nil if prometheus_addr is not set
+	running         bool
 
 	configUpdateMutex sync.RWMutex
 	configVer         uint32
@@ -95,7 +108,9 @@ func (s *Server) Status() string {
 	return status
 }
 
-// TODO
+// parse the comma separated ip and ip segment list, an invalid item is an
+// error instead of being skipped, because dropping it silently may leave the
+// list empty and open the proxy to every client
 func parseAllowIps(allowIpsStr string) ([]IPInfo, error) {
 	if len(allowIpsStr) == 0 {
 		return make([]IPInfo, 0, 10), nil
@@ -103,13 +118,128 @@ func parseAllowIps(allowIpsStr string) ([]IPInfo, error) {
 	ipVec := strings.Split(allowIpsStr, ",")
 	allowIpsList := make([]IPInfo, 0, 10)
 	for _, ipStr := range ipVec {
-		if ip, err := ParseIPInfo(strings.TrimSpace(ipStr)); err == nil {
-			allowIpsList = append(allowIpsList, ip)
+		ipStr = strings.TrimSpace(ipStr)
+		if len(ipStr) == 0 {
+			continue
 		}
+		ip, err := ParseIPInfo(ipStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow ip [%s]", ipStr)
+		}
+		allowIpsList = append(allowIpsList, ip)
 	}
 	return allowIpsList, nil
 }
 
+// parse the password hash of each user, the plain text password is hashed
+// here and never kept by the server
+func parseUsers(userList []config.UserConfig) (map[string][]byte, error) {
+	users := make(map[string][]byte, len(userList))
+	for _, user := range userList {
+		if len(user.PasswordHash) == 0 {
+			users[user.User] = mysql.CalcPasswordHash([]byte(user.Password))
+			continue
+		}
+		if len(user.Password) != 0 {
+			return nil, fmt.Errorf("user [%s] set both password and password_hash", user.User)
+		}
+		hash, err := mysql.DecodePassword(user.PasswordHash)
+		if err != nil {
+			return nil, fmt.Errorf("user [%s] %s", user.User, err.Error())
+		}
+		users[user.User] = hash
+	}
+	return users, nil
+}
+
+func parseUserAllowIps(userList []config.UserConfig) (map[string][]IPInfo, error) {
+	userAllowIps := make(map[string][]IPInfo, len(userList))
+	for _, user := range userList {
+		if len(user.AllowIps) == 0 {
+			continue
+		}
+		allowIps, err := parseAllowIps(user.AllowIps)
+		if err != nil {
+			return nil, fmt.Errorf("user [%s] %s", user.User, err.Error())
+		}
+		userAllowIps[user.User] = allowIps
+	}
+	return userAllowIps, nil
+}
+
+// parse the default auth plugin and the auth plugin of each user
+func parseAuthPlugins(cfg *config.Config) (string, map[string]string, error) {
+	defaultPlugin := cfg.DefaultAuthPlugin
+	if len(defaultPlugin) == 0 {
+		defaultPlugin = mysql.AUTH_NATIVE_PASSWORD
+	}
+	if !isSupportedAuthPlugin(defaultPlugin) {
+		return "", nil, fmt.Errorf("default_auth_plugin [%s] not supported", defaultPlugin)
+	}
+
+	userAuthPlugins := make(map[string]string, len(cfg.UserList))
+	for _, user := range cfg.UserList {
+		plugin := user.AuthPlugin
+		if len(plugin) == 0 {
+			plugin = defaultPlugin
+		}
+		if !isSupportedAuthPlugin(plugin) {
+			return "", nil, fmt.Errorf("user [%s] auth_plugin [%s] not supported", user.User, plugin)
+		}
+		userAuthPlugins[user.User] = plugin
+	}
+	return defaultPlugin, userAuthPlugins, nil
+}
+
+// matchAllowIps reports whether ip is allowed by the list, an empty list allows all
+func matchAllowIps(allowIps []IPInfo, ip net.IP) bool {
+	if len(allowIps) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, allowIp := range allowIps {
+		if allowIp.Match(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parse the certificate settings for client connections, returns nil if
+// tls_cert and tls_key are not set
+func parseTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if len(cfg.TLSCert) == 0 && len(cfg.TLSKey) == 0 {
+		if cfg.RequireSecureTransport {
+			return nil, fmt.Errorf("require_secure_transport needs tls_cert and tls_key")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if len(cfg.TLSClientCA) != 0 {
+		caData, err := ioutil.ReadFile(cfg.TLSClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no certificate found in tls_client_ca [%s]", cfg.TLSClientCA)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
 // parse the blacklist sql file
 func parseBlackListSqls(blackListFilePath string) (*BlacklistSqls, error) {
 	bs := new(BlacklistSqls)
@@ -149,6 +279,24 @@ func parseBlackListSqls(blackListFilePath string) (*BlacklistSqls, error) {
 	return bs, nil
 }
 
+// parse the rewrite rules file, returns nil if the file is not set
+func parseRewriteRules(rulesFilePath string) (*sqlparser.RewriteRules, error) {
+	if len(rulesFilePath) == 0 {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(rulesFilePath)
+	if err != nil {
+		return nil, err
+	}
+	return sqlparser.ParseRewriteRules(data)
+}
+
+func setRewriteRules(nodes map[string]*backend.BackendProxy, rules *sqlparser.RewriteRules) {
+	for _, node := range nodes {
+		node.SetRewriteRules(rules)
+	}
+}
+
 func parseNode(cfg config.NodeConfig) (*backend.BackendProxy, error) {
 	n := backend.NewBackendProxy(cfg)
 	err := n.InitConnectionPool()
@@ -201,10 +349,6 @@ func NewServer(cfg *config.Config) (*Server, error) {
 	s.cfg = cfg
 	s.counter = new(Counter)
 	s.addr = cfg.Addr
-	s.users = make(map[string]string)
-	for _, user := range cfg.UserList {
-		s.users[user.User] = user.Password
-	}
 	atomic.StoreInt32(&s.statusIndex, 0)
 	s.status[s.statusIndex] = Online
 	atomic.StoreInt32(&s.logSqlIndex, 0)
@@ -243,12 +387,46 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		s.allowips[another] = allowIps
 	}
 
+	if users, err := parseUsers(s.cfg.UserList); err != nil {
+		return nil, err
+	} else {
+		s.users = users
+	}
+
+	if userAllowIps, err := parseUserAllowIps(s.cfg.UserList); err != nil {
+		return nil, err
+	} else {
+		s.userAllowips = userAllowIps
+	}
+
+	if tlsConfig, err := parseTLSConfig(s.cfg); err != nil {
+		return nil, err
+	} else {
+		s.tlsConfig = tlsConfig
+	}
+
+	if defaultPlugin, userAuthPlugins, err := parseAuthPlugins(s.cfg); err != nil {
+		return nil, err
+	} else {
+		s.defaultAuthPlugin = defaultPlugin
+		s.userAuthPlugins = userAuthPlugins
+	}
+	s.sha2Cache = newSha2PasswordCache()
+	s.rsaKey = new(rsaKeyHolder)
+
 	if nodes, err := parseNodes(s.cfg.Nodes); err != nil {
 		return nil, err
 	} else {
 		s.nodes = nodes
 	}
 
+	if rules, err := parseRewriteRules(s.cfg.RulesFile); err != nil {
+		return nil, err
+	} else {
+		s.rewriteRules = rules
+		setRewriteRules(s.nodes, rules)
+	}
+
 	if schemas, err := parseSchemaList(s.cfg.SchemaList, s.nodes); err != nil {
 		return nil, err
 	} else {
@@ -270,6 +448,17 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		return nil, err
 	}
 
+	if s.cfg.PrometheusAddr != "" {
+		s.metricsListener, err = net.Listen(netProto, s.cfg.PrometheusAddr)
+		if err != nil {
+			s.listener.Close()
+			return nil, err
+		}
+		golog.Info("server", "NewServer", "Metrics exporter running", 0,
+			"address",
+			s.cfg.PrometheusAddr)
+	}
+
 	golog.Info("server", "NewServer", "Server running", 0,
 		"netProto",
 		netProto,
@@ -350,7 +539,8 @@ func (s *Server) onConn(c net.Conn) {
 	}()
 
 	if allowConnect := conn.IsAllowConnect(); allowConnect == false {
-		err := mysql.NewError(mysql.ER_ACCESS_DENIED_ERROR, "ip address access denied by kingshard.")
+		s.counter.IncrDeniedConnTotal()
+		err := mysql.NewError(mysql.ER_ACCESS_DENIED_ERROR, "ip address access denied by sqlproxy.")
 		conn.writeError(err)
 		conn.Close()
 		return
@@ -362,6 +552,10 @@ func (s *Server) onConn(c net.Conn) {
 		return
 	}
 
+	userConns := clientConnections.WithLabelValues(conn.user)
+	userConns.Inc()
+	defer userConns.Dec()
+
 	// Add for clientConn test
 	if s.acceptListener != nil {
 		s.acceptListener.OnConnect(conn)
@@ -563,8 +757,23 @@ func (s *Server) saveBlackSql() error {
 	return nil
 }
 
+// hashUserPasswords returns a copy of the config whose user_list keeps
+// password_hash only, so that plain text passwords are not written back.
+func hashUserPasswords(cfg *config.Config) *config.Config {
+	newCfg := *cfg
+	newCfg.UserList = make([]config.UserConfig, len(cfg.UserList))
+	for i, user := range cfg.UserList {
+		if len(user.Password) != 0 {
+			user.PasswordHash = mysql.EncodePassword(user.Password)
+			user.Password = ""
+		}
+		newCfg.UserList[i] = user
+	}
+	return &newCfg
+}
+
 func (s *Server) SaveProxyConfig() error {
-	err := config.WriteConfigFile(s.cfg)
+	err := config.WriteConfigFile(hashUserPasswords(s.cfg))
 	if err != nil {
 		return err
 	}
@@ -583,6 +792,10 @@ func (s *Server) Run() error {
 	// flush counter
 	go s.flushCounter()
 
+	if s.metricsListener != nil {
+		go s.serveMetrics()
+	}
+
 	for s.running {
 		conn, err := s.listener.Accept()
 		if err != nil {
@@ -601,6 +814,9 @@ func (s *Server) Close() {
 	if s.listener != nil {
 		s.listener.Close()
 	}
+	if s.metricsListener != nil {
+		s.metricsListener.Close()
+	}
 }
 
 func (s *Server) GetNode(name string) *backend.BackendProxy {
@@ -612,6 +828,39 @@ func (s *Server) GetNode(name string) *backend.BackendProxy {
 // 	return s.nodes
 // }
 
+// ReloadRewriteRules reloads rewrite_rules_file, the old rules are kept if
+// the file is invalid.
+func (s *Server) ReloadRewriteRules() error {
+	s.configUpdateMutex.RLock()
+	rulesFile := s.cfg.RulesFile
+	s.configUpdateMutex.RUnlock()
+	if len(rulesFile) == 0 {
+		return errors.ErrNoRulesFile
+	}
+
+	rules, err := parseRewriteRules(rulesFile)
+	if err != nil {
+		golog.Error("Server", "ReloadRewriteRules", err.Error(), 0, "rewrite_rules_file", rulesFile)
+		return err
+	}
+
+	s.configUpdateMutex.Lock()
+	defer s.configUpdateMutex.Unlock()
+	s.rewriteRules = rules
+	setRewriteRules(s.nodes, rules)
+	golog.Info("Server", "ReloadRewriteRules", "rewrite rules reloaded", 0, "rules", len(rules.Rules))
+	return nil
+}
+
+func (s *Server) GetRewriteRules() []*sqlparser.RewriteRule {
+	s.configUpdateMutex.RLock()
+	defer s.configUpdateMutex.RUnlock()
+	if s.rewriteRules == nil {
+		return []*sqlparser.RewriteRule{}
+	}
+	return s.rewriteRules.Rules
+}
+
 func (s *Server) GetSlowLogTime() int {
 	return s.slowLogTime[s.slowLogTimeIndex]
 }
@@ -668,10 +917,36 @@ func (s *Server) UpdateConfig(newCfg *config.Config) {
 		return
 	}
 
-	newUserList := make(map[string]string)
-	for _, user := range newCfg.UserList {
-		newUserList[user.User] = user.Password
+	newUserList, err := parseUsers(newCfg.UserList)
+	if nil != err {
+		golog.Error("Server", "UpdateConfig", err.Error(), 0)
+		return
+	}
+
+	newUserAllowIps, err := parseUserAllowIps(newCfg.UserList)
+	if nil != err {
+		golog.Error("Server", "UpdateConfig", err.Error(), 0)
+		return
+	}
+
+	newTLSConfig, err := parseTLSConfig(newCfg)
+	if nil != err {
+		golog.Error("Server", "UpdateConfig", err.Error(), 0)
+		return
+	}
+
+	newDefaultAuthPlugin, newUserAuthPlugins, err := parseAuthPlugins(newCfg)
+	if nil != err {
+		golog.Error("Server", "UpdateConfig", err.Error(), 0)
+		return
+	}
+
+	newRewriteRules, err := parseRewriteRules(newCfg.RulesFile)
+	if nil != err {
+		golog.Error("Server", "UpdateConfig", err.Error(), 0)
+		return
 	}
+	setRewriteRules(nodes, newRewriteRules)
 
 	for user, _ := range newUserList {
 		if _, exist := newSchemas[user]; !exist {
@@ -701,6 +976,12 @@ func (s *Server) UpdateConfig(newCfg *config.Config) {
 	s.allowipsIndex.Set(!index)
 
 	s.users = newUserList
+	s.userAllowips = newUserAllowIps
+	s.tlsConfig = newTLSConfig
+	s.defaultAuthPlugin = newDefaultAuthPlugin
+	s.userAuthPlugins = newUserAuthPlugins
+	//passwords may have changed, clients must pass full auth again
+	s.sha2Cache = newSha2PasswordCache()
 
 	switch strings.ToLower(newCfg.LogLevel) {
 	case "debug":
@@ -722,6 +1003,7 @@ func (s *Server) UpdateConfig(newCfg *config.Config) {
 	// 	n.Online = false
 	// }
 	s.nodes = nodes
+	s.rewriteRules = newRewriteRules
 
 	//reset schema
 	s.schemas = newSchemas
@@ -15,6 +15,7 @@
 package server
 
 import (
+	"io/ioutil"
 	"os"
 	"sqlproxy/core/golog"
 	"sync"
@@ -23,6 +24,7 @@ import (
 
 	"sqlproxy/backend"
 	"sqlproxy/config"
+	"sqlproxy/core/errors"
 )
 
 var testServerOnce sync.Once
@@ -126,3 +128,35 @@ func newFrontConn() *backend.BackendProxy {
 func TestServer(t *testing.T) {
 	newTestServer()
 }
+
+func TestServer_ReloadRewriteRules(t *testing.T) {
+	s := &Server{cfg: &config.Config{}}
+	if err := s.ReloadRewriteRules(); err != errors.ErrNoRulesFile {
+		t.Fatalf("want ErrNoRulesFile, got %v", err)
+	}
+
+	f, err := ioutil.TempFile("", "rewrite_rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("rules:\n  - name: r1\n    func: ifnull\n    rename: coalesce\n")
+	f.Close()
+
+	s.cfg.RulesFile = f.Name()
+	if err := s.ReloadRewriteRules(); err != nil {
+		t.Fatal(err)
+	}
+	if rules := s.GetRewriteRules(); len(rules) != 1 || rules[0].Name != "r1" {
+		t.Fatalf("unexpected rules %v", rules)
+	}
+
+	// 规则文件有错误时保留原来的规则
+	ioutil.WriteFile(f.Name(), []byte("rules:\n  - name: r2\n    func: ifnull\n"), 0644)
+	if err := s.ReloadRewriteRules(); err == nil {
+		t.Fatal("want error for invalid rule")
+	}
+	if rules := s.GetRewriteRules(); len(rules) != 1 || rules[0].Name != "r1" {
+		t.Fatalf("unexpected rules %v", rules)
+	}
+}
@@ -74,3 +74,60 @@ func TestCreateIPInfoIPNetError2(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestIPInfoMatchIPv6(t *testing.T) {
+	info, err := ParseIPInfo("fd00:10::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Match(net.ParseIP("fd00:10::1")) {
+		t.Fatal("fd00:10::1 should match fd00:10::/32")
+	}
+	if info.Match(net.ParseIP("fd00:11::1")) {
+		t.Fatal("fd00:11::1 should not match fd00:10::/32")
+	}
+
+	info, err = ParseIPInfo("::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Match(net.ParseIP("::1")) {
+		t.Fatal("::1 should match ::1")
+	}
+}
+
+func TestMatchAllowIps(t *testing.T) {
+	allowIps, err := parseAllowIps("127.0.0.1, 192.168.15.0/24,fd00::/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		ip    string
+		allow bool
+	}{
+		{"127.0.0.1", true},
+		{"192.168.15.20", true},
+		{"::ffff:192.168.15.20", true},
+		{"192.168.16.20", false},
+		{"fd12::1", true},
+		{"fe80::1", false},
+	}
+	for _, c := range cases {
+		if matchAllowIps(allowIps, net.ParseIP(c.ip)) != c.allow {
+			t.Fatalf("ip %s, want allow %v", c.ip, c.allow)
+		}
+	}
+
+	if !matchAllowIps(nil, net.ParseIP("10.0.0.1")) {
+		t.Fatal("empty allow ips should allow all")
+	}
+	if matchAllowIps(allowIps, nil) {
+		t.Fatal("unknown client ip should be denied")
+	}
+}
+
+func TestParseAllowIpsError(t *testing.T) {
+	if _, err := parseAllowIps("127.0.0.1,192.168.1"); err == nil {
+		t.Fatal("invalid allow ip should be an error")
+	}
+}
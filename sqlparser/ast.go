@@ -804,9 +804,12 @@ func (node *PartitionDefinition) walkSubtree(visit Visit) error {
 
 // TableSpec describes the structure of a table from a CREATE TABLE statement
 type TableSpec struct {
-	Columns []*ColumnDefinition
-	Indexes []*IndexDefinition
-	Options string
+	Columns     []*ColumnDefinition
+	Indexes     []*IndexDefinition
+	ForeignKeys []*ForeignKeyDefinition
+	Options     string
+	// Comment is the comment in Options
+	Comment *SQLVal
 }
 
 // Format formats the node.
@@ -822,6 +825,9 @@ func (ts *TableSpec) Format(buf *TrackedBuffer) {
 	for _, idx := range ts.Indexes {
 		buf.Myprintf(",\n\t%v", idx)
 	}
+	for _, fk := range ts.ForeignKeys {
+		buf.Myprintf(",\n\t%v", fk)
+	}
 
 	buf.Myprintf("\n)%s", strings.Replace(ts.Options, ", ", ",\n  ", -1))
 }
@@ -853,6 +859,12 @@ func (ts *TableSpec) walkSubtree(visit Visit) error {
 		}
 	}
 
+	for _, n := range ts.ForeignKeys {
+		if err := Walk(visit, n); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -940,16 +952,16 @@ func (ct *ColumnType) Format(buf *TrackedBuffer) {
 		opts = append(opts, keywordStrings[NOT], keywordStrings[NULL])
 	}
 	if ct.Default != nil {
-		opts = append(opts, keywordStrings[DEFAULT], String(ct.Default))
+		opts = append(opts, keywordStrings[DEFAULT], buf.nodeString(ct.Default))
 	}
 	if ct.OnUpdate != nil {
-		opts = append(opts, keywordStrings[ON], keywordStrings[UPDATE], String(ct.OnUpdate))
+		opts = append(opts, keywordStrings[ON], keywordStrings[UPDATE], buf.nodeString(ct.OnUpdate))
 	}
 	if ct.Autoincrement {
 		opts = append(opts, keywordStrings[AUTO_INCREMENT])
 	}
 	if ct.Comment != nil {
-		opts = append(opts, keywordStrings[COMMENT_KEYWORD], String(ct.Comment))
+		opts = append(opts, keywordStrings[COMMENT_KEYWORD], buf.nodeString(ct.Comment))
 	}
 	if ct.KeyOpt == colKeyPrimary {
 		opts = append(opts, keywordStrings[PRIMARY], keywordStrings[KEY])
@@ -1172,6 +1184,43 @@ type IndexColumn struct {
 	Length *SQLVal
 }
 
+// ForeignKeyDefinition describes a foreign key in a CREATE TABLE statement
+type ForeignKeyDefinition struct {
+	Name       ColIdent
+	Columns    Columns
+	RefTable   TableName
+	RefColumns Columns
+	OnDelete   string
+	OnUpdate   string
+}
+
+// Format formats the node.
+func (fk *ForeignKeyDefinition) Format(buf *TrackedBuffer) {
+	if !fk.Name.IsEmpty() {
+		buf.Myprintf("constraint %v ", fk.Name)
+	}
+	buf.Myprintf("foreign key %v references %v %v", fk.Columns, fk.RefTable, fk.RefColumns)
+	if fk.OnDelete != "" {
+		buf.Myprintf(" on delete %s", fk.OnDelete)
+	}
+	if fk.OnUpdate != "" {
+		buf.Myprintf(" on update %s", fk.OnUpdate)
+	}
+}
+
+func (fk *ForeignKeyDefinition) walkSubtree(visit Visit) error {
+	if fk == nil {
+		return nil
+	}
+	return Walk(
+		visit,
+		fk.Name,
+		fk.Columns,
+		fk.RefTable,
+		fk.RefColumns,
+	)
+}
+
 // LengthScaleOption is used for types that have an optional length
 // and scale
 type LengthScaleOption struct {
@@ -2313,7 +2362,11 @@ func NewValArg(in []byte) *SQLVal {
 func (node *SQLVal) Format(buf *TrackedBuffer) {
 	switch node.Type {
 	case StrVal:
-		sqltypes.MakeTrusted(sqltypes.VarBinary, node.Val).EncodeSQL(buf)
+		if buf.dialect == OracleDialect {
+			encodeOracleString(buf, node.Val)
+		} else {
+			sqltypes.MakeTrusted(sqltypes.VarBinary, node.Val).EncodeSQL(buf)
+		}
 	case IntVal, FloatVal, HexNum:
 		buf.Myprintf("%s", []byte(node.Val))
 	case HexVal:
@@ -3425,14 +3478,18 @@ func formatID(buf *TrackedBuffer, original, lowered string) {
 	return
 
 mustEscape:
-	buf.WriteByte('`')
+	quote := '`'
+	if buf.dialect == OracleDialect {
+		quote = '"'
+	}
+	buf.WriteRune(quote)
 	for _, c := range original {
 		buf.WriteRune(c)
-		if c == '`' {
-			buf.WriteByte('`')
+		if c == quote {
+			buf.WriteRune(quote)
 		}
 	}
-	buf.WriteByte('`')
+	buf.WriteRune(quote)
 }
 
 func compliantName(in string) string {
@@ -1,17 +1,22 @@
 package sqlparser
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
 	"sqlproxy/sqlparser/dependency/querypb"
 	"sqlproxy/sqlparser/dependency/sqltypes"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 type Merge struct {
 	Comments  Comments
 	Table     *MergeTableExpr
 	Matched   MatchedExpr
+	Where     *Where // when matched then update的条件
 	Unmatched *UnmatchedExpr
 }
 
@@ -19,9 +24,14 @@ func (node *Merge) iStatement() {}
 
 // Format formats the node.
 func (node *Merge) Format(buf *TrackedBuffer) {
-	buf.Myprintf("merge %vinto %v %v %v",
-		node.Comments,
-		node.Table, node.Matched, node.Unmatched)
+	buf.Myprintf("merge %vinto %v", node.Comments, node.Table)
+	// insert ignore转换的merge没有matched子句，多表update转换的merge没有not matched子句
+	if node.Matched != nil {
+		buf.Myprintf(" %v%v", node.Matched, node.Where)
+	}
+	if node.Unmatched != nil {
+		buf.Myprintf(" %v", node.Unmatched)
+	}
 }
 
 func (node *Merge) walkSubtree(visit Visit) error {
@@ -33,10 +43,35 @@ func (node *Merge) walkSubtree(visit Visit) error {
 		node.Comments,
 		node.Table,
 		node.Matched,
+		node.Where,
 		node.Unmatched,
 	)
 }
 
+// Statements is a statement converted into several statements executed in
+// order as a unit, such as a replace converted into delete and insert.
+type Statements []Statement
+
+func (Statements) iStatement() {}
+
+// Format formats the node, the statements are sent to the database one by one.
+func (node Statements) Format(buf *TrackedBuffer) {
+	prefix := ""
+	for _, n := range node {
+		buf.Myprintf("%s%v", prefix, n)
+		prefix = "; "
+	}
+}
+
+func (node Statements) walkSubtree(visit Visit) error {
+	for _, n := range node {
+		if err := Walk(visit, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type MatchedExpr UpdateExprs
 
 // Format formats the node.
@@ -136,15 +171,20 @@ func (node *MergeTableExpr) walkSubtree(visit Visit) error {
 
 // using语句拼接的虚拟表定义
 type VirtualTableExpr struct {
-	Rows      SelectValues // 虚拟表数据，来自于Insert.Rows
-	TableName TableIdent   // 表名
-	Columns   Columns      // 虚拟表数据声明的列
+	Rows      SelectValues    // 虚拟表数据，来自于Insert.Rows
+	Select    SelectStatement // insert ... select的查询，不为nil时没有Rows
+	TableName TableIdent      // 表名
+	Columns   Columns         // 虚拟表数据声明的列
 }
 
 func (node *VirtualTableExpr) iTableExpr() {}
 
 // Format formats the node.
 func (node *VirtualTableExpr) Format(buf *TrackedBuffer) {
+	if node.Select != nil {
+		buf.Myprintf("(%v) %v %v", node.Select, node.TableName, node.Columns)
+		return
+	}
 	buf.Myprintf("(%v) %v %v", node.Rows, node.TableName, node.Columns)
 }
 
@@ -155,6 +195,7 @@ func (node *VirtualTableExpr) walkSubtree(visit Visit) error {
 	return Walk(
 		visit,
 		node.Rows,
+		node.Select,
 		node.TableName,
 		node.Columns,
 	)
@@ -183,7 +224,7 @@ type SelectTuple Exprs
 
 // Format formats the node.
 func (node SelectTuple) Format(buf *TrackedBuffer) {
-	buf.Myprintf("select %v", Exprs(node))
+	buf.Myprintf("select %v from dual", Exprs(node))
 }
 
 func (node SelectTuple) walkSubtree(visit Visit) error {
@@ -223,30 +264,42 @@ func (node *DmDDL) FromCreateDDL(ddl *DDL) {
 	node.VindexSpec = ddl.VindexSpec
 	node.VindexCols = ddl.VindexCols
 	node.TableSpec = &DmTableSpec{}
+	// 达梦建表语句中不能有列注释和普通索引，由建表之后的语句添加
 	for _, col := range ddl.TableSpec.Columns {
-		node.TableSpec.Columns = append(node.TableSpec.Columns, &DmColumnDefinition{
-			Name: col.Name,
-			Type: DmColumnType{
-				AutoIncrement: match,
-				Type:          col.Type.Type,
-				NotNull:       col.Type.NotNull,
-				Default:       col.Type.Default,
-				Autoincrement: col.Type.Autoincrement,
-				Charset:       col.Type.Charset,
-				OnUpdate:      col.Type.OnUpdate,
-				Length:        col.Type.Length,
-				Unsigned:      col.Type.Unsigned,
-				Zerofill:      col.Type.Zerofill,
-				Scale:         col.Type.Scale,
-				Collate:       col.Type.Collate,
-				EnumValues:    col.Type.EnumValues,
-				KeyOpt:        col.Type.KeyOpt,
-				Comment:       col.Type.Comment,
-			},
-		})
+		dmCol := NewDmColumnDefinition(col, match)
+		dmCol.Type.Comment = nil
+		dmCol.setEnumCheck(ddl.NewName)
+		node.TableSpec.AddColumn(dmCol)
 	}
 	for _, i := range ddl.TableSpec.Indexes {
-		node.TableSpec.AddIndex(i)
+		if i.Info.Primary {
+			node.TableSpec.AddIndex(i)
+		}
+	}
+}
+
+// NewDmColumnDefinition converts a column of MySQL, autoIncrement is the
+// start value of the identity column, empty for 1.
+func NewDmColumnDefinition(col *ColumnDefinition, autoIncrement string) *DmColumnDefinition {
+	return &DmColumnDefinition{
+		Name: col.Name,
+		Type: DmColumnType{
+			AutoIncrement: autoIncrement,
+			Type:          col.Type.Type,
+			NotNull:       col.Type.NotNull,
+			Default:       col.Type.Default,
+			Autoincrement: col.Type.Autoincrement,
+			Charset:       col.Type.Charset,
+			OnUpdate:      col.Type.OnUpdate,
+			Length:        col.Type.Length,
+			Unsigned:      col.Type.Unsigned,
+			Zerofill:      col.Type.Zerofill,
+			Scale:         col.Type.Scale,
+			Collate:       col.Type.Collate,
+			EnumValues:    col.Type.EnumValues,
+			KeyOpt:        col.Type.KeyOpt,
+			Comment:       col.Type.Comment,
+		},
 	}
 }
 
@@ -307,6 +360,256 @@ func (node *DmDDL) walkSubtree(visit Visit) error {
 	)
 }
 
+// DmAlter represents a DM statement converted from a clause of MySQL ALTER
+// TABLE, an ALTER TABLE with several clauses is converted into several
+// statements. Column is set for AddColumnStr, ModifyColumnStr and AddCheckStr,
+// Index for
+// CreateIndexStr and AddPrimaryKeyStr, ForeignKey for AddForeignKeyStr, Spec
+// is the clause of AlterSpecStr.
+type DmAlter struct {
+	Action     string
+	Table      TableName
+	Column     *DmColumnDefinition
+	Index      *IndexDefinition
+	ForeignKey *ForeignKeyDefinition
+	Name       ColIdent   // 列名、索引名或约束名
+	NewName    ColIdent   // 列或索引的新名字
+	NewTable   TableIdent // 表的新名字
+	Default    Expr
+	Comment    *SQLVal
+	Spec       string // 已转换标识符和字符串的子句
+}
+
+// DmAlter actions
+const (
+	AddColumnStr      = "add column"
+	ModifyColumnStr   = "modify"
+	ColumnDefaultStr  = "modify default"
+	DropColumnStr     = "drop column"
+	RenameColumnStr   = "rename column"
+	CreateIndexStr    = "create index"
+	DropIndexStr      = "drop index"
+	RenameIndexStr    = "rename index"
+	AddPrimaryKeyStr  = "add primary key"
+	DropPrimaryKeyStr = "drop primary key"
+	AddForeignKeyStr  = "add foreign key"
+	AddCheckStr       = "add check"
+	DropConstraintStr = "drop constraint"
+	RenameTableStr    = "rename to"
+	CommentTableStr   = "comment on table"
+	CommentColumnStr  = "comment on column"
+	AlterSpecStr      = "alter spec"
+)
+
+func (node *DmAlter) iStatement() {}
+
+// Format formats the node.
+func (node *DmAlter) Format(buf *TrackedBuffer) {
+	switch node.Action {
+	case AddColumnStr:
+		buf.Myprintf("alter table %v add column %v", node.Table, node.Column)
+	case ModifyColumnStr:
+		buf.Myprintf("alter table %v modify %v", node.Table, node.Column)
+	case ColumnDefaultStr:
+		buf.Myprintf("alter table %v modify %v default %v", node.Table, node.Name, node.Default)
+	case DropColumnStr:
+		buf.Myprintf("alter table %v drop column %v", node.Table, node.Name)
+	case RenameColumnStr:
+		buf.Myprintf("alter table %v rename column %v to %v", node.Table, node.Name, node.NewName)
+	case CreateIndexStr:
+		unique := ""
+		if node.Index.Info.Unique {
+			unique = "unique "
+		}
+		buf.Myprintf("create %sindex ", unique)
+		node.formatIndexName(buf, node.Index.Info.Name)
+		buf.Myprintf(" on %v ", node.Table)
+		node.formatIndexColumns(buf)
+	case AddPrimaryKeyStr:
+		buf.Myprintf("alter table %v add primary key ", node.Table)
+		node.formatIndexColumns(buf)
+	case DropIndexStr:
+		buf.Myprintf("drop index ")
+		node.formatIndexName(buf, node.Name)
+	case RenameIndexStr:
+		buf.Myprintf("alter index ")
+		node.formatIndexName(buf, node.Name)
+		buf.Myprintf(" rename to %v", node.NewName)
+	case DropPrimaryKeyStr:
+		buf.Myprintf("alter table %v drop primary key", node.Table)
+	case AddForeignKeyStr:
+		buf.Myprintf("alter table %v add %v", node.Table, node.ForeignKey)
+	case AddCheckStr:
+		buf.Myprintf("alter table %v add ", node.Table)
+		node.Column.formatCheck(buf)
+	case DropConstraintStr:
+		buf.Myprintf("alter table %v drop constraint %v", node.Table, node.Name)
+	case RenameTableStr:
+		buf.Myprintf("alter table %v rename to %v", node.Table, node.NewTable)
+	case CommentTableStr:
+		buf.Myprintf("comment on table %v is %v", node.Table, node.Comment)
+	case CommentColumnStr:
+		buf.Myprintf("comment on column %v.%v is %v", node.Table, node.Name, node.Comment)
+	default:
+		buf.Myprintf("alter table %v ", node.Table)
+		buf.WriteString(node.Spec)
+	}
+}
+
+// formatIndexName 索引与表在同一个模式中
+func (node *DmAlter) formatIndexName(buf *TrackedBuffer, name ColIdent) {
+	if !node.Table.Qualifier.IsEmpty() {
+		buf.Myprintf("%v.", node.Table.Qualifier)
+	}
+	buf.Myprintf("%v", name)
+}
+
+// formatIndexColumns 达梦不支持前缀索引，去掉列的长度
+func (node *DmAlter) formatIndexColumns(buf *TrackedBuffer) {
+	prefix := "("
+	for _, col := range node.Index.Columns {
+		buf.Myprintf("%s%v", prefix, col.Column)
+		prefix = ", "
+	}
+	buf.WriteString(")")
+}
+
+func (node *DmAlter) walkSubtree(visit Visit) error {
+	if node == nil {
+		return nil
+	}
+	return Walk(
+		visit,
+		node.Table,
+		node.Name,
+		node.NewName,
+		node.NewTable,
+		node.ForeignKey,
+		node.Default,
+	)
+}
+
+// DmTrigger represents the trigger emulating a MySQL column with ON UPDATE
+// CURRENT_TIMESTAMP, it sets the column to the current time if an UPDATE does
+// not set it and changes one of Columns, the other columns of the table. The
+// change check is left out if Columns is empty. Action is CreateStr or DropStr.
+type DmTrigger struct {
+	Action  string
+	Table   TableName
+	Column  ColIdent
+	Columns []ColIdent
+}
+
+func (node *DmTrigger) iStatement() {}
+
+// Name returns the name of the trigger, which is unique for the column.
+func (node *DmTrigger) Name() ColIdent {
+	return NewColIdent(node.Table.Name.String() + "_" + node.Column.String() + "_on_update")
+}
+
+// Format formats the node.
+func (node *DmTrigger) Format(buf *TrackedBuffer) {
+	if node.Action == DropStr {
+		buf.Myprintf("drop trigger if exists ")
+		node.formatName(buf)
+		return
+	}
+	buf.Myprintf("create or replace trigger ")
+	node.formatName(buf)
+	buf.Myprintf(" before update on %v for each row begin if not updating(%v)",
+		node.Table, NewStrVal([]byte(node.Column.String())))
+	// decode认为两个null相等
+	for i, col := range node.Columns {
+		if i == 0 {
+			buf.Myprintf(" and (")
+		} else {
+			buf.Myprintf(" or ")
+		}
+		buf.Myprintf("decode(:new.%v, :old.%v, 0, 1) = 1", col, col)
+	}
+	if len(node.Columns) > 0 {
+		buf.Myprintf(")")
+	}
+	buf.Myprintf(" then :new.%v := %s; end if; end;", node.Column, SystimestampStr)
+}
+
+// formatName 触发器与表在同一个模式中
+func (node *DmTrigger) formatName(buf *TrackedBuffer) {
+	if !node.Table.Qualifier.IsEmpty() {
+		buf.Myprintf("%v.", node.Table.Qualifier)
+	}
+	buf.Myprintf("%v", node.Name())
+}
+
+func (node *DmTrigger) walkSubtree(visit Visit) error {
+	if node == nil {
+		return nil
+	}
+	if err := Walk(visit, node.Table, node.Column); err != nil {
+		return err
+	}
+	for _, col := range node.Columns {
+		if err := Walk(visit, col); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DmIdentityInsert represents SET IDENTITY_INSERT of DM, the identity column
+// of the table accepts explicit values while it is on.
+type DmIdentityInsert struct {
+	Table TableName
+	On    bool
+}
+
+func (node *DmIdentityInsert) iStatement() {}
+
+// Format formats the node.
+func (node *DmIdentityInsert) Format(buf *TrackedBuffer) {
+	state := "off"
+	if node.On {
+		state = "on"
+	}
+	buf.Myprintf("set identity_insert %v %s", node.Table, state)
+}
+
+func (node *DmIdentityInsert) walkSubtree(visit Visit) error {
+	if node == nil {
+		return nil
+	}
+	return Walk(visit, node.Table)
+}
+
+// DmResultQuery represents a query executed with the statements converted
+// from an INSERT, Column tells whether its value is the affected rows or the
+// insert id. It selects from dual if From is nil.
+type DmResultQuery struct {
+	Column string
+	Expr   Expr
+	From   TableExprs
+	Where  *Where
+}
+
+func (node *DmResultQuery) iStatement() {}
+
+// Format formats the node.
+func (node *DmResultQuery) Format(buf *TrackedBuffer) {
+	buf.Myprintf("select %v as %v", node.Expr, NewColIdent(node.Column))
+	if node.From == nil {
+		buf.WriteString(" from dual")
+		return
+	}
+	buf.Myprintf(" from %v%v", node.From, node.Where)
+}
+
+func (node *DmResultQuery) walkSubtree(visit Visit) error {
+	if node == nil {
+		return nil
+	}
+	return Walk(visit, node.Expr, node.From, node.Where)
+}
+
 // DmTableSpec describes the structure of a table from a CREATE TABLE statement
 type DmTableSpec struct {
 	Columns []*DmColumnDefinition
@@ -361,15 +664,50 @@ func (dts *DmTableSpec) walkSubtree(visit Visit) error {
 	return nil
 }
 
-// DmColumnDefinition describes a column in a CREATE TABLE statement
+// DmColumnDefinition describes a column in a CREATE TABLE statement, Check
+// is the name of the check constraint of a column converted from ENUM or SET.
 type DmColumnDefinition struct {
-	Name ColIdent
-	Type DmColumnType
+	Name  ColIdent
+	Type  DmColumnType
+	Check ColIdent
 }
 
 // Format formats the node.
 func (dmCol *DmColumnDefinition) Format(buf *TrackedBuffer) {
 	buf.Myprintf("%v %v", dmCol.Name, &dmCol.Type)
+	if !dmCol.Check.IsEmpty() {
+		buf.WriteString(" ")
+		dmCol.formatCheck(buf)
+	}
+}
+
+// setEnumCheck 达梦没有enum和set，转换为varchar并用check约束校验值，约束按表名和列名命名
+func (dmCol *DmColumnDefinition) setEnumCheck(table TableName) {
+	if dmCol.Type.Type == "enum" || dmCol.Type.Type == "set" {
+		dmCol.Check = NewColIdent(table.Name.String() + "_" + dmCol.Name.String() + "_" + dmCol.Type.Type)
+	}
+}
+
+// formatCheck enum的值必须是列表中的一个，set的值是逗号分隔的列表中的值或者空字符串
+func (dmCol *DmColumnDefinition) formatCheck(buf *TrackedBuffer) {
+	buf.Myprintf("constraint %v check (", dmCol.Check)
+	values := dmCol.Type.enumValues()
+	if dmCol.Type.Type == "enum" {
+		buf.Myprintf("%v in ", dmCol.Name)
+		prefix := "("
+		for _, val := range values {
+			buf.Myprintf("%s%v", prefix, NewStrVal([]byte(val)))
+			prefix = ", "
+		}
+		buf.WriteString("))")
+		return
+	}
+	for i, val := range values {
+		values[i] = regexp.QuoteMeta(val)
+	}
+	item := "(" + strings.Join(values, "|") + ")"
+	pattern := NewStrVal([]byte("^" + item + "(," + item + ")*$"))
+	buf.Myprintf("%v = '' or regexp_like(%v, %v))", dmCol.Name, dmCol.Name, pattern)
 }
 
 func (dmCol *DmColumnDefinition) walkSubtree(visit Visit) error {
@@ -380,6 +718,7 @@ func (dmCol *DmColumnDefinition) walkSubtree(visit Visit) error {
 		visit,
 		dmCol.Name,
 		&dmCol.Type,
+		dmCol.Check,
 	)
 }
 
@@ -428,6 +767,8 @@ func (dct *DmColumnType) Format(buf *TrackedBuffer) {
 		if dct.Length != nil {
 			buf.Myprintf("varchar(%v CHAR)", dct.Length)
 		}
+	case "enum", "set":
+		buf.Myprintf("varchar(%s CHAR)", strconv.Itoa(dct.enumLength()))
 	case "longtext":
 		buf.Myprintf("%s", "text")
 	case "mediumtext":
@@ -492,8 +833,8 @@ func (dct *DmColumnType) Format(buf *TrackedBuffer) {
 			}
 		default:
 			val := string(dct.Default.Val)
-			if dct.Type == "char" || dct.Type == "varchar" {
-				val = String(dct.Default)
+			if dct.Type == "char" || dct.Type == "varchar" || dct.Type == "enum" || dct.Type == "set" {
+				val = buf.nodeString(dct.Default)
 			}
 			opts = append(opts, keywordStrings[DEFAULT], val)
 		}
@@ -504,7 +845,7 @@ func (dct *DmColumnType) Format(buf *TrackedBuffer) {
 	//}
 
 	if dct.Comment != nil {
-		opts = append(opts, keywordStrings[COMMENT_KEYWORD], String(dct.Comment))
+		opts = append(opts, keywordStrings[COMMENT_KEYWORD], buf.nodeString(dct.Comment))
 	}
 	//if dct.KeyOpt == colKeyUnique {
 	//	opts = append(opts, keywordStrings[UNIQUE])
@@ -524,6 +865,36 @@ func (dct *DmColumnType) Format(buf *TrackedBuffer) {
 	}
 }
 
+// enumValues 语法解析时enum和set的值带有单引号
+func (dct *DmColumnType) enumValues() []string {
+	values := make([]string, 0, len(dct.EnumValues))
+	for _, val := range dct.EnumValues {
+		values = append(values, val[1:len(val)-1])
+	}
+	return values
+}
+
+// enumLength enum的长度是最长的值，set的长度是所有值用逗号连接的长度
+func (dct *DmColumnType) enumLength() int {
+	n := 0
+	for _, val := range dct.enumValues() {
+		l := utf8.RuneCountInString(val)
+		switch {
+		case dct.Type == "set":
+			n += l + 1
+		case l > n:
+			n = l
+		}
+	}
+	if dct.Type == "set" {
+		n--
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
 // DescribeType returns the abbreviated type information as required for
 // describe table
 func (dct *DmColumnType) DescribeType() string {
@@ -697,3 +1068,431 @@ func (node *DmUse) Format(buf *TrackedBuffer) {
 func (node *DmUse) walkSubtree(visit Visit) error {
 	return Walk(visit, node.DBName)
 }
+
+// Pseudocolumn represents an oracle pseudocolumn such as rowid and rownum,
+// or a function called without parentheses such as sysdate, it must not be
+// quoted like a column name.
+type Pseudocolumn string
+
+// Pseudocolumn names
+const (
+	RowidStr           = "rowid"
+	RownumStr          = "rownum"
+	SysdateStr         = "sysdate"
+	SystimestampStr    = "systimestamp"
+	SessiontimezoneStr = "sessiontimezone"
+)
+
+func (Pseudocolumn) iExpr() {}
+
+// Format formats the node.
+func (node Pseudocolumn) Format(buf *TrackedBuffer) {
+	buf.WriteString(string(node))
+}
+
+func (node Pseudocolumn) walkSubtree(visit Visit) error {
+	return nil
+}
+
+func (node Pseudocolumn) replace(from, to Expr) bool {
+	return false
+}
+
+// RowidExpr represents the rowid of a table or an alias, such as "t".rowid.
+type RowidExpr struct {
+	Qualifier TableIdent
+}
+
+func (*RowidExpr) iExpr() {}
+
+// Format formats the node.
+func (node *RowidExpr) Format(buf *TrackedBuffer) {
+	buf.Myprintf("%v.%s", node.Qualifier, RowidStr)
+}
+
+func (node *RowidExpr) walkSubtree(visit Visit) error {
+	if node == nil {
+		return nil
+	}
+	return Walk(visit, node.Qualifier)
+}
+
+func (node *RowidExpr) replace(from, to Expr) bool {
+	return false
+}
+
+// OffsetFetchSelect represents a select paged by
+// OFFSET ... ROWS FETCH NEXT ... ROWS ONLY, it replaces the limit of MySQL.
+type OffsetFetchSelect struct {
+	Select   SelectStatement // limit和lock已去掉
+	Offset   Expr
+	Rowcount Expr
+	Lock     string
+}
+
+func (*OffsetFetchSelect) iStatement()       {}
+func (*OffsetFetchSelect) iSelectStatement() {}
+func (*OffsetFetchSelect) iInsertRows()      {}
+
+// AddOrder adds an order by element
+func (node *OffsetFetchSelect) AddOrder(order *Order) {
+	panic("unreachable")
+}
+
+// SetLimit sets the limit clause
+func (node *OffsetFetchSelect) SetLimit(limit *Limit) {
+	panic("unreachable")
+}
+
+// Format formats the node.
+func (node *OffsetFetchSelect) Format(buf *TrackedBuffer) {
+	if node.Offset != nil {
+		buf.Myprintf("%v offset %v rows fetch next %v rows only%s", node.Select, node.Offset, node.Rowcount, node.Lock)
+		return
+	}
+	buf.Myprintf("%v fetch first %v rows only%s", node.Select, node.Rowcount, node.Lock)
+}
+
+func (node *OffsetFetchSelect) walkSubtree(visit Visit) error {
+	if node == nil {
+		return nil
+	}
+	return Walk(
+		visit,
+		node.Select,
+		node.Offset,
+		node.Rowcount,
+	)
+}
+
+// RownumSelect represents a select paged by rownum in an inline view, for
+// the targets without OFFSET ... FETCH.
+//
+// Without offset:
+//
+//	select * from (select ...) where rownum <= count
+//
+// With offset:
+//
+//	select cols from (select t__.*, rownum rn__ from (select ...) t__ where rownum <= offset + count) where rn__ > offset
+//
+// Columns are the names of the select expressions, the row number column
+// rn__ is returned to clients if they can't be named, e.g. select *.
+type RownumSelect struct {
+	Select  SelectStatement // limit和lock已去掉
+	Columns SelectExprs
+	Offset  Expr
+	MaxRow  Expr // offset + count，没有offset时为count
+	Lock    string
+}
+
+func (*RownumSelect) iStatement()       {}
+func (*RownumSelect) iSelectStatement() {}
+func (*RownumSelect) iInsertRows()      {}
+
+// AddOrder adds an order by element
+func (node *RownumSelect) AddOrder(order *Order) {
+	panic("unreachable")
+}
+
+// SetLimit sets the limit clause
+func (node *RownumSelect) SetLimit(limit *Limit) {
+	panic("unreachable")
+}
+
+// Format formats the node.
+func (node *RownumSelect) Format(buf *TrackedBuffer) {
+	if node.Offset == nil {
+		buf.Myprintf("select * from (%v) where rownum <= %v%s", node.Select, node.MaxRow, node.Lock)
+		return
+	}
+	if len(node.Columns) == 0 {
+		buf.WriteString("select *")
+	} else {
+		buf.Myprintf("select %v", node.Columns)
+	}
+	buf.Myprintf(" from (select t__.*, rownum rn__ from (%v) t__ where rownum <= %v) where rn__ > %v%s",
+		node.Select, node.MaxRow, node.Offset, node.Lock)
+}
+
+func (node *RownumSelect) walkSubtree(visit Visit) error {
+	if node == nil {
+		return nil
+	}
+	return Walk(
+		visit,
+		node.Columns,
+		node.Select,
+		node.MaxRow,
+		node.Offset,
+	)
+}
+
+// CastExpr represents cast(expr as type).
+type CastExpr struct {
+	Expr Expr
+	Type string
+}
+
+func (*CastExpr) iExpr() {}
+
+// Format formats the node.
+func (node *CastExpr) Format(buf *TrackedBuffer) {
+	buf.Myprintf("cast(%v as %s)", node.Expr, node.Type)
+}
+
+func (node *CastExpr) walkSubtree(visit Visit) error {
+	if node == nil {
+		return nil
+	}
+	return Walk(visit, node.Expr)
+}
+
+func (node *CastExpr) replace(from, to Expr) bool {
+	return replaceExprs(from, to, &node.Expr)
+}
+
+// AtTimeZoneExpr represents expr at time zone zone.
+type AtTimeZoneExpr struct {
+	Expr Expr
+	Zone Expr
+}
+
+func (*AtTimeZoneExpr) iExpr() {}
+
+// Format formats the node.
+func (node *AtTimeZoneExpr) Format(buf *TrackedBuffer) {
+	buf.Myprintf("%v at time zone %v", node.Expr, node.Zone)
+}
+
+func (node *AtTimeZoneExpr) walkSubtree(visit Visit) error {
+	if node == nil {
+		return nil
+	}
+	return Walk(visit, node.Expr, node.Zone)
+}
+
+func (node *AtTimeZoneExpr) replace(from, to Expr) bool {
+	return replaceExprs(from, to, &node.Expr, &node.Zone)
+}
+
+// ConcatStr is the string concatenation operator of oracle, MySQL parses
+// || as or.
+const ConcatStr = "||"
+
+// ListAggExpr represents listagg(expr, separator) within group (order by ...),
+// the oracle counterpart of group_concat.
+type ListAggExpr struct {
+	Distinct  string
+	Expr      Expr
+	Separator Expr
+	OrderBy   OrderBy // 为空时按null排序，within group不能省略
+}
+
+func (*ListAggExpr) iExpr() {}
+
+// Format formats the node.
+func (node *ListAggExpr) Format(buf *TrackedBuffer) {
+	buf.Myprintf("listagg(%s%v, %v) within group (order by ", node.Distinct, node.Expr, node.Separator)
+	if len(node.OrderBy) == 0 {
+		buf.WriteString("null")
+	}
+	prefix := ""
+	for _, order := range node.OrderBy {
+		buf.Myprintf("%s%v", prefix, order)
+		prefix = ", "
+	}
+	buf.WriteByte(')')
+}
+
+func (node *ListAggExpr) walkSubtree(visit Visit) error {
+	if node == nil {
+		return nil
+	}
+	return Walk(
+		visit,
+		node.Expr,
+		node.Separator,
+		node.OrderBy,
+	)
+}
+
+func (node *ListAggExpr) replace(from, to Expr) bool {
+	if replaceExprs(from, to, &node.Expr, &node.Separator) {
+		return true
+	}
+	for _, order := range node.OrderBy {
+		if replaceExprs(from, to, &order.Expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// CloneExpr returns a deep copy of expr. A rewrite which uses an expression
+// more than once must clone it, the bind variables in each copy are
+// renumbered separately.
+func CloneExpr(expr Expr) Expr {
+	if expr == nil {
+		return nil
+	}
+	return cloneValue(reflect.ValueOf(expr)).Interface().(Expr)
+}
+
+// cloneSelect returns a deep copy of sel like CloneExpr.
+func cloneSelect(sel SelectStatement) SelectStatement {
+	if sel == nil {
+		return nil
+	}
+	return cloneValue(reflect.ValueOf(sel)).Interface().(SelectStatement)
+}
+
+func cloneValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(cloneValue(v.Elem()))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(cloneValue(v.Elem()))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(cloneValue(v.Index(i)))
+		}
+		return c
+	case reflect.Struct:
+		// 未导出的字段（如ColIdent）只有字符串，直接复制
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(cloneValue(v.Field(i)))
+			}
+		}
+		return c
+	}
+	return v
+}
+
+// RewriteExprs replaces every expression in node for which rewrite returns
+// a new expression. Inner expressions are rewritten before the outer ones,
+// so rewrite sees the arguments of a function already rewritten. The
+// expressions returned by rewrite are not rewritten again.
+func RewriteExprs(node SQLNode, rewrite func(Expr) Expr) {
+	var exprs []Expr
+	_ = Walk(func(node SQLNode) (kcontinue bool, err error) {
+		if expr, ok := node.(Expr); ok {
+			exprs = append(exprs, expr)
+		}
+		return true, nil
+	}, node)
+
+	// 先序遍历的逆序中子节点总在父节点之前
+	for i := len(exprs) - 1; i >= 0; i-- {
+		if to := rewrite(exprs[i]); to != nil {
+			replaceInTree(node, exprs[i], to)
+		}
+	}
+}
+
+var errReplaced = errors.New("replaced")
+
+// replaceInTree replaces from with to in the first node of root that holds
+// it, the Expr nodes replace their own subexpressions.
+func replaceInTree(root SQLNode, from, to Expr) bool {
+	replaceIn := func(exprs ...*Expr) error {
+		if replaceExprs(from, to, exprs...) {
+			return errReplaced
+		}
+		return nil
+	}
+	err := Walk(func(node SQLNode) (kcontinue bool, err error) {
+		switch n := node.(type) {
+		case *AliasedExpr:
+			err = replaceIn(&n.Expr)
+		case *Where:
+			// 没有条件的where和limit是nil
+			if n != nil {
+				err = replaceIn(&n.Expr)
+			}
+		case *UpdateExpr:
+			err = replaceIn(&n.Expr)
+		case *SetExpr:
+			err = replaceIn(&n.Expr)
+		case *Order:
+			err = replaceIn(&n.Expr)
+		case *When:
+			err = replaceIn(&n.Cond, &n.Val)
+		case *JoinTableExpr:
+			err = replaceIn(&n.Condition.On)
+		case *MergeTableExpr:
+			err = replaceIn(&n.Condition.On)
+		case *Limit:
+			if n != nil {
+				err = replaceIn(&n.Offset, &n.Rowcount)
+			}
+		case *OffsetFetchSelect:
+			err = replaceIn(&n.Offset, &n.Rowcount)
+		case *RownumSelect:
+			err = replaceIn(&n.Offset, &n.MaxRow)
+		case *DmResultQuery:
+			err = replaceIn(&n.Expr)
+		case GroupBy:
+			for i := range n {
+				if err = replaceIn(&n[i]); err != nil {
+					break
+				}
+			}
+		case Exprs:
+			for i := range n {
+				if err = replaceIn(&n[i]); err != nil {
+					break
+				}
+			}
+		case SelectTuple:
+			for i := range n {
+				if err = replaceIn(&n[i]); err != nil {
+					break
+				}
+			}
+		case Expr:
+			if n.replace(from, to) {
+				err = errReplaced
+			}
+		}
+		return true, err
+	}, root)
+	return err == errReplaced
+}
+
+// zeroDate matches the MySQL zero date and datetime, which are out of the
+// range of DM/Oracle dates.
+var zeroDate = regexp.MustCompile(`^0000-00-00( 00:00:00(\.0+)?)?$`)
+
+// encodeOracleString writes a string literal of OracleDialect, the single
+// quotes are doubled and backslashes are not escape characters.
+func encodeOracleString(buf *TrackedBuffer, val []byte) {
+	if zeroDate.Match(val) {
+		val = append([]byte("0001-01-01"), val[len("0000-00-00"):]...)
+	}
+	buf.WriteByte('\'')
+	for _, b := range val {
+		if b == '\'' {
+			buf.WriteByte('\'')
+		}
+		buf.WriteByte(b)
+	}
+	buf.WriteByte('\'')
+}
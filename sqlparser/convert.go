@@ -1,17 +1,128 @@
 package sqlparser
 
+import (
+	"errors"
+)
+
 const (
 	MYSQL_TO_ORACLE = "mysql-to-oracle"
 )
 
+// limit转换的分页方式
+const (
+	PAGINATION_OFFSET = "offset" // offset ... rows fetch next ... rows only，达梦和Oracle 12c以上
+	PAGINATION_ROWNUM = "rownum" // rownum内联视图，Oracle 11g及以下
+)
+
+// ErrNoUniqueKey is returned for a replace, insert ignore or insert ... on
+// duplicate key update whose columns cover no primary key or unique index,
+// the statement can not be converted to keep its meaning.
+var ErrNoUniqueKey = errors.New("no primary key or unique index in the inserted columns")
+
+// ErrMultiTargetUpdate is returned for a multi-table update which sets the
+// columns of more than one table, the target database can not execute it.
+var ErrMultiTargetUpdate = errors.New("update of more than one table is not supported")
+
+// ErrMultiTargetDelete is returned for a multi-table delete which deletes
+// the rows of more than one table, the target database can not execute it.
+var ErrMultiTargetDelete = errors.New("delete of more than one table is not supported")
+
+// ErrUpdateLimit is returned for a multi-table update with LIMIT, which MySQL
+// rejects with the same message.
+var ErrUpdateLimit = errors.New("Incorrect usage of UPDATE and LIMIT")
+
+// ErrDuplicateKeyRows is returned for a multi-row replace, insert ignore or
+// insert ... on duplicate key update with more than one row of the same
+// primary key or unique index. MySQL applies the rows one by one while the
+// converted statements apply them at once, so the result would differ.
+var ErrDuplicateKeyRows = errors.New("more than one inserted row with the same unique key")
+
+// ErrValuesNotInserted is returned for an insert ... on duplicate key update
+// which refers to VALUES(col) of a column not in the inserted columns. MySQL
+// returns the default of the column, which the converter does not know.
+var ErrValuesNotInserted = errors.New("VALUES() of a column not in the inserted columns")
+
+// InsertIdColumn is the column of the query converted together with an
+// INSERT whose value is the insert id.
+const InsertIdColumn = "insert_id__"
+
+// AffectedRowsColumn is the column of the query converted together with a
+// statement whose value is added to the affected rows.
+const AffectedRowsColumn = "affected_rows__"
+
+// ConvertedStmt is one of the statements converted from a MySQL statement
+// with its own args. The affected rows of the statement are counted
+// RowsFactor times, 0 for SET IDENTITY_INSERT and the insert id query. The
+// affected rows of a query of AffectedRowsColumn is the value it returns.
+type ConvertedStmt struct {
+	SQL        string
+	Args       []interface{}
+	RowsFactor int64
+}
+
+// SQLConverter converts a MySQL statement into the statements of the target
+// database, which are executed in order with the returned args.
 type SQLConverter interface {
-	Convert(sql string, args ...interface{}) ([]string, []string, []interface{}, error)
+	Convert(sql string, args ...interface{}) ([]string, []interface{}, error)
+}
+
+// MetaChange is the change of the table metadata kept by a converter, made
+// by converting a DDL statement such as the columns, triggers and check
+// constraints of a created table. It is applied after the converted
+// statements are executed successfully.
+type MetaChange interface {
+	Apply()
+}
+
+// UnitConverter is a SQLConverter which returns each converted statement with
+// its own args, the statements are executed in order as a unit. foundRows is
+// set for the clients with CLIENT_FOUND_ROWS, which count the matched rows
+// rather than the changed rows as the affected rows of an UPDATE. The
+// returned MetaChange is nil if the statement changes no table metadata.
+type UnitConverter interface {
+	SQLConverter
+	ConvertUnit(sql string, foundRows bool, args ...interface{}) ([]ConvertedStmt, MetaChange, error)
+}
+
+// RuleConverter is a SQLConverter whose conversion can be customized by
+// rewrite rules, the rules can be replaced while converting.
+type RuleConverter interface {
+	SQLConverter
+	SetRewriteRules(rules *RewriteRules)
+	RewriteRules() *RewriteRules
+}
+
+// OnUpdateConverter is a SQLConverter which emulates the columns with ON
+// UPDATE CURRENT_TIMESTAMP by triggers, or by setting them in UPDATE for the
+// tables without the triggers.
+type OnUpdateConverter interface {
+	SQLConverter
+	SetOnUpdateColumns(table string, columns []string)
+}
+
+// EnumConverter is a SQLConverter which converts ENUM and SET columns into
+// VARCHAR with check constraints and remembers their original types.
+type EnumConverter interface {
+	SQLConverter
+	SetEnumColumn(table, column string, enum EnumColumn)
+	LookupEnumColumn(table, column string) (EnumColumn, bool)
+}
+
+// KeyConverter is a SQLConverter which remembers the primary keys and unique
+// indexes of the tables.
+type KeyConverter interface {
+	SQLConverter
+	LookupKeyColumn(table, column string) (primary, unique bool)
 }
 
-func GetSQLConverter(name string, tableUniqueIndexs map[string]map[string][]string, tableColumns map[string][]string, incrementColumns map[string]map[string]int) SQLConverter {
+func GetSQLConverter(name string, pagination string, tableUniqueIndexs map[string]map[string][]string, tableColumns map[string][]string, incrementColumns map[string]map[string]int) SQLConverter {
 	switch name {
 	case MYSQL_TO_ORACLE:
-		return NewOracleConverter(tableUniqueIndexs, tableColumns, incrementColumns)
+		c := NewOracleConverter(tableUniqueIndexs, tableColumns, incrementColumns)
+		if pagination != "" {
+			c.pagination = pagination
+		}
+		return c
 	default:
 		return nil
 	}
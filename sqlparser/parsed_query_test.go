@@ -185,13 +185,13 @@ func TestGenerateQueryForArgs(t *testing.T) {
 				"PRIMARY": {"cal_id"},
 			},
 		}, nil, nil)
-		convertTree, _ := converter.convertStmt(tree)
+		convertTree, _ := converter.convertStmt(tree, true, converter.newMetaChange())
 		if convertTree == nil {
 			t.Errorf("convert failed: %s", tcase.query)
 			continue
 		}
 
-		pq := NewParsedQuery(convertTree)
+		pq := NewTrackedBuffer(nil).WithDialect(OracleDialect).WriteNode(convertTree).ParsedQuery()
 		bytes, err := pq.GenerateQueryForArgs(tcase.bindVars)
 		var got string
 		if err != nil {
@@ -199,7 +199,6 @@ func TestGenerateQueryForArgs(t *testing.T) {
 		} else {
 			got = string(bytes)
 		}
-		got = converter.replaceCommonIdents(got)
 		if got != tcase.output {
 			t.Errorf("for test case: %s, got: '%s', want '%s'", tcase.desc, got, tcase.output)
 		} else {
@@ -0,0 +1,266 @@
+package sqlparser
+
+import (
+	"fmt"
+	"strings"
+
+	"sqlproxy/mysql"
+
+	"gopkg.in/yaml.v2"
+)
+
+// RewriteRule rewrites the statements matching all of its conditions, the
+// conditions not set match any statement. A rule either rewrites the calls
+// of the function Func, or replaces the whole statement with Replace.
+type RewriteRule struct {
+	Name string `yaml:"name" json:"name"`
+
+	Func        string   `yaml:"func,omitempty" json:"func,omitempty"`               // 改写的函数名
+	Stmt        string   `yaml:"stmt,omitempty" json:"stmt,omitempty"`               // 语句类型select、insert、replace、update、delete或ddl
+	Tables      []string `yaml:"tables,omitempty" json:"tables,omitempty"`           // 语句引用了其中任意一个表
+	Fingerprint string   `yaml:"fingerprint,omitempty" json:"fingerprint,omitempty"` // 与该SQL的指纹相同，常量不同的语句指纹相同
+
+	Rename  string `yaml:"rename,omitempty" json:"rename,omitempty"`   // 函数的新名字
+	Args    []int  `yaml:"args,omitempty" json:"args,omitempty"`       // 按原参数的位置（从1开始）重新排列参数，可以重复或省略
+	Wrap    string `yaml:"wrap,omitempty" json:"wrap,omitempty"`       // 包装函数的表达式，?表示函数本身，如nvl(?, 0)
+	Replace string `yaml:"replace,omitempty" json:"replace,omitempty"` // 替换整个语句，原样发送到目标库，参数按原语句的顺序传入
+
+	fingerprint string
+	wrap        Expr
+}
+
+// RewriteRules is a list of rules loaded from YAML, the first rule matching
+// a statement or a function call is applied.
+type RewriteRules struct {
+	Rules []*RewriteRule `yaml:"rules"`
+}
+
+// ParseRewriteRules parses the rules in YAML:
+//
+//	rules:
+//	  - name: ifnull-coalesce
+//	    func: ifnull
+//	    rename: coalesce
+//	  - name: report
+//	    fingerprint: select sum(amount) from orders where user_id = 1
+//	    replace: select sum(amount) from orders where user_id = :1
+func ParseRewriteRules(data []byte) (*RewriteRules, error) {
+	rules := new(RewriteRules)
+	if err := yaml.UnmarshalStrict(data, rules); err != nil {
+		return nil, err
+	}
+	for i, rule := range rules.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rewrite rule %d has no name", i+1)
+		}
+		if err := rule.init(); err != nil {
+			return nil, fmt.Errorf("rewrite rule %s: %v", rule.Name, err)
+		}
+	}
+	return rules, nil
+}
+
+func (r *RewriteRule) init() error {
+	switch r.Stmt = strings.ToLower(r.Stmt); r.Stmt {
+	case "", "select", "insert", "replace", "update", "delete", "ddl":
+	default:
+		return fmt.Errorf("unknown stmt %s", r.Stmt)
+	}
+	if r.Fingerprint != "" {
+		r.fingerprint = mysql.GetFingerprint(r.Fingerprint)
+	}
+
+	if r.Replace != "" {
+		if r.Fingerprint == "" {
+			return fmt.Errorf("replace needs fingerprint")
+		}
+		if r.Func != "" || r.Rename != "" || len(r.Args) != 0 || r.Wrap != "" {
+			return fmt.Errorf("replace can not be used with func, rename, args or wrap")
+		}
+		return nil
+	}
+
+	if r.Func == "" {
+		return fmt.Errorf("needs func or replace")
+	}
+	if r.Rename == "" && len(r.Args) == 0 && r.Wrap == "" {
+		return fmt.Errorf("needs rename, args or wrap")
+	}
+	r.Func = strings.ToLower(r.Func)
+	for _, i := range r.Args {
+		if i < 1 {
+			return fmt.Errorf("invalid args position %d", i)
+		}
+	}
+	if r.Wrap != "" {
+		stmt, err := Parse("select " + r.Wrap)
+		if err != nil {
+			return fmt.Errorf("invalid wrap: %v", err)
+		}
+		sel, ok := stmt.(*Select)
+		if !ok || len(sel.SelectExprs) != 1 {
+			return fmt.Errorf("invalid wrap %s", r.Wrap)
+		}
+		aliased, ok := sel.SelectExprs[0].(*AliasedExpr)
+		if !ok || !aliased.As.IsEmpty() || !hasValArg(aliased.Expr) {
+			return fmt.Errorf("invalid wrap %s", r.Wrap)
+		}
+		r.wrap = aliased.Expr
+	}
+	return nil
+}
+
+func hasValArg(expr Expr) bool {
+	found := false
+	_ = Walk(func(node SQLNode) (kcontinue bool, err error) {
+		if v, ok := node.(*SQLVal); ok && v.Type == ValArg {
+			found = true
+		}
+		return !found, nil
+	}, expr)
+	return found
+}
+
+// ruleStmt is the statement the rules are matched against, the
+// fingerprint and the tables are only computed if a rule needs them.
+type ruleStmt struct {
+	sql         string
+	stmt        Statement
+	fingerprint *string
+	tables      map[string]bool
+}
+
+func (s *ruleStmt) getFingerprint() string {
+	if s.fingerprint == nil {
+		fingerprint := mysql.GetFingerprint(s.sql)
+		s.fingerprint = &fingerprint
+	}
+	return *s.fingerprint
+}
+
+func (s *ruleStmt) hasTable(names []string) bool {
+	if s.tables == nil {
+		s.tables = make(map[string]bool)
+		_ = Walk(func(node SQLNode) (kcontinue bool, err error) {
+			if t, ok := node.(TableName); ok && !t.IsEmpty() {
+				s.tables[strings.ToLower(t.Name.String())] = true
+			}
+			return true, nil
+		}, s.stmt)
+	}
+	for _, name := range names {
+		if s.tables[strings.ToLower(name)] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RewriteRule) match(s *ruleStmt) bool {
+	if r.Stmt != "" && r.Stmt != strings.ToLower(StmtType(Preview(s.sql))) {
+		return false
+	}
+	if r.fingerprint != "" && r.fingerprint != s.getFingerprint() {
+		return false
+	}
+	if len(r.Tables) != 0 && (s.stmt == nil || !s.hasTable(r.Tables)) {
+		return false
+	}
+	return true
+}
+
+// ReplaceStmt returns the replacement of sql if a replace rule matches it.
+func (rules *RewriteRules) ReplaceStmt(sql string) (string, bool) {
+	if rules == nil {
+		return "", false
+	}
+	var s *ruleStmt
+	for _, rule := range rules.Rules {
+		if rule.Replace == "" {
+			continue
+		}
+		if s == nil {
+			// 表名需要语法树，替换在解析之前进行，只解析一次
+			stmt, _ := Parse(sql)
+			s = &ruleStmt{sql: sql, stmt: stmt}
+		}
+		if rule.match(s) {
+			return rule.Replace, true
+		}
+	}
+	return "", false
+}
+
+// RewriteFuncs applies the function rules matching the statement.
+func (rules *RewriteRules) RewriteFuncs(sql string, stmt Statement) {
+	if rules == nil {
+		return
+	}
+	s := &ruleStmt{sql: sql, stmt: stmt}
+	funcRules := make(map[string]*RewriteRule)
+	for _, rule := range rules.Rules {
+		if rule.Func == "" {
+			continue
+		}
+		if _, ok := funcRules[rule.Func]; !ok && rule.match(s) {
+			funcRules[rule.Func] = rule
+		}
+	}
+	if len(funcRules) == 0 {
+		return
+	}
+
+	RewriteExprs(stmt, func(expr Expr) Expr {
+		node, ok := expr.(*FuncExpr)
+		if !ok || !node.Qualifier.IsEmpty() {
+			return nil
+		}
+		if rule, ok := funcRules[node.Name.Lowered()]; ok {
+			return rule.rewrite(node)
+		}
+		return nil
+	})
+}
+
+// rewrite returns nil if the call does not have the arguments in Args.
+func (r *RewriteRule) rewrite(node *FuncExpr) Expr {
+	fn := &FuncExpr{Name: node.Name, Distinct: node.Distinct, Exprs: node.Exprs}
+	if r.Rename != "" {
+		fn.Name = NewColIdent(r.Rename)
+	}
+	if len(r.Args) != 0 {
+		used := make([]bool, len(node.Exprs))
+		fn.Exprs = make(SelectExprs, 0, len(r.Args))
+		for _, i := range r.Args {
+			if i > len(node.Exprs) {
+				return nil
+			}
+			arg := node.Exprs[i-1]
+			if used[i-1] {
+				// 重复的参数需要复制，其中的绑定变量分别编号
+				aliased, ok := arg.(*AliasedExpr)
+				if !ok {
+					return nil
+				}
+				arg = &AliasedExpr{Expr: CloneExpr(aliased.Expr), As: aliased.As}
+			}
+			used[i-1] = true
+			fn.Exprs = append(fn.Exprs, arg)
+		}
+	}
+	if r.wrap == nil {
+		return fn
+	}
+
+	root := &AliasedExpr{Expr: CloneExpr(r.wrap)}
+	var inner Expr = fn
+	RewriteExprs(root, func(expr Expr) Expr {
+		if v, ok := expr.(*SQLVal); ok && v.Type == ValArg {
+			to := inner
+			inner = CloneExpr(fn)
+			return to
+		}
+		return nil
+	})
+	return root.Expr
+}
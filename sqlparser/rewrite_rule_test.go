@@ -0,0 +1,132 @@
+package sqlparser
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testRewriteRules = `
+rules:
+  - name: my-date
+    func: my_date
+    rename: to_char
+    args: [2, 1]
+  - name: order-total
+    func: total
+    tables: [orders]
+    wrap: nvl(?, 0)
+  - name: order-total-select
+    func: total
+    stmt: select
+    rename: sum
+  - name: report
+    fingerprint: select * from report where day = '2024-01-01' and id = 1
+    replace: select /*+ index(r idx_day) */ * from report r where day = :1 and id = :2
+`
+
+func TestRewriteRules(t *testing.T) {
+	rules, err := ParseRewriteRules([]byte(testRewriteRules))
+	assert.Nil(t, err)
+
+	testCases := []struct {
+		in, out string
+		args    []interface{}
+		outArgs []interface{}
+	}{
+		{
+			in:  "select my_date('YYYY', created) from t",
+			out: `select to_char("created", 'YYYY') from "t"`,
+		},
+		// 表名匹配的规则优先，其次按语句类型匹配
+		{
+			in:  "select total(amount) from orders",
+			out: `select nvl(total("amount"), 0) from "orders"`,
+		},
+		{
+			in:  "select total(amount) from items",
+			out: `select sum("amount") from "items"`,
+		},
+		{
+			in:  "update items set amount = total(amount)",
+			out: `update "items" set "amount" = total("amount")`,
+		},
+		// 改写之后再执行内置转换
+		{
+			in:      "select my_date(?, ifnull(created, now())) from t where id = ?",
+			out:     `select to_char(nvl("created", sysdate), :v1) from "t" where "id" = :v2`,
+			args:    []interface{}{"YYYY", 1},
+			outArgs: []interface{}{"YYYY", 1},
+		},
+		{
+			in:      "select * from report where day = ? and id = ?",
+			out:     `select /*+ index(r idx_day) */ * from report r where day = :1 and id = :2`,
+			args:    []interface{}{"2024-02-01", 2},
+			outArgs: []interface{}{"2024-02-01", 2},
+		},
+		{
+			in:  "select * from report where day = '2024-02-01'",
+			out: `select * from "report" where "day" = '2024-02-01'`,
+		},
+	}
+
+	converter := NewOracleConverter(nil, nil, nil)
+	converter.SetRewriteRules(rules)
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			oSql, args, err := converter.Convert(tcase.in, tcase.args...)
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, oSql[0])
+			assert.Equal(t, tcase.outArgs, args)
+		})
+	}
+
+	converter.SetRewriteRules(nil)
+	oSql, _, err := converter.Convert("select my_date('YYYY', created) from t")
+	assert.Nil(t, err)
+	assert.Equal(t, `select my_date('YYYY', "created") from "t"`, oSql[0])
+}
+
+func TestParseRewriteRulesError(t *testing.T) {
+	testCases := []struct {
+		in, err string
+	}{
+		{
+			in:  "rules:\n  - func: f\n    rename: g",
+			err: "rewrite rule 1 has no name",
+		},
+		{
+			in:  "rules:\n  - name: r\n    func: f",
+			err: "rewrite rule r: needs rename, args or wrap",
+		},
+		{
+			in:  "rules:\n  - name: r\n    rename: g",
+			err: "rewrite rule r: needs func or replace",
+		},
+		{
+			in:  "rules:\n  - name: r\n    replace: select 1",
+			err: "rewrite rule r: replace needs fingerprint",
+		},
+		{
+			in:  "rules:\n  - name: r\n    func: f\n    args: [0]",
+			err: "rewrite rule r: invalid args position 0",
+		},
+		{
+			in:  "rules:\n  - name: r\n    func: f\n    wrap: nvl(f, 0)",
+			err: "rewrite rule r: invalid wrap nvl(f, 0)",
+		},
+		{
+			in:  "rules:\n  - name: r\n    func: f\n    rename: g\n    stmt: show",
+			err: "rewrite rule r: unknown stmt show",
+		},
+	}
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			_, err := ParseRewriteRules([]byte(tcase.in))
+			if assert.NotNil(t, err) {
+				assert.Equal(t, tcase.err, err.Error())
+			}
+		})
+	}
+}
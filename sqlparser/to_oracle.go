@@ -3,29 +3,33 @@ package sqlparser
 import (
 	"fmt"
 	"log"
+	"sort"
 	"sqlproxy/core/golog"
 	"strconv"
 	"strings"
-	"unicode"
+	"sync"
+	"sync/atomic"
 )
 
 type OracleConverter struct {
-	replaceChars      map[string]string
-	tableUniqueIndexs map[string]map[string][]string
-	tableColumns      map[string][]string
-	incrementColumns  map[string]map[string]int
+	tableUniqueIndexs map[string]map[string][]string // 建表和修改表时更新，由metaMu保护
+	tableColumns      map[string][]string            // 建表和修改表时更新，由metaMu保护
+	incrementColumns  map[string]map[string]int      // 建表和修改表时更新，由metaMu保护
+	pagination        string                         // limit转换的分页方式，PAGINATION_OFFSET或PAGINATION_ROWNUM
+	rules             atomic.Value                   // *RewriteRules，可以在转换时替换
+
+	// 建表和修改表时记录的列信息，表名 -> 小写的列名 -> 列
+	metaMu          sync.RWMutex
+	onUpdateColumns map[string]map[string]onUpdateColumn // on update current_timestamp的列
+	enumColumns     map[string]map[string]EnumColumn     // 转换为varchar的enum和set列
 }
 
 func NewOracleConverter(tableUniqueIndexs map[string]map[string][]string, tableColumns map[string][]string, incrementColumns map[string]map[string]int) *OracleConverter {
 	return &OracleConverter{
-		replaceChars: map[string]string{
-			"`":                   "\"",
-			"0000-00-00 00:00:00": "0001-01-01 00:00:00",
-			`\'`:                  `''`,
-		},
 		tableUniqueIndexs: tableUniqueIndexs,
 		incrementColumns:  incrementColumns,
 		tableColumns:      tableColumns,
+		pagination:        PAGINATION_OFFSET,
 	}
 }
 
@@ -34,55 +38,153 @@ func NewOracleConverter(tableUniqueIndexs map[string]map[string][]string, tableC
 // 2. check if need to convert
 // 3. convert mysql ast to oracle ast
 // 4. rebuild oracle sql from ast
-func (c *OracleConverter) Convert(sql string, args ...interface{}) ([]string, []string, []interface{}, error) {
+//
+// UPDATE counts the matched rows as with CLIENT_FOUND_ROWS. The args of the
+// statement with the most args are returned, see ConvertUnit for the args of
+// each statement. The table metadata changed by DDL is applied at once.
+func (c *OracleConverter) Convert(sql string, args ...interface{}) ([]string, []interface{}, error) {
+	unit, meta, err := c.ConvertUnit(sql, true, args...)
+	if err != nil {
+		return nil, args, err
+	}
+	if meta != nil {
+		meta.Apply()
+	}
+	convertSQLs := make([]string, 0, len(unit))
+	var newArgs []interface{}
+	for _, s := range unit {
+		convertSQLs = append(convertSQLs, s.SQL)
+		if len(unit) == 1 || len(s.Args) > len(newArgs) {
+			newArgs = s.Args
+		}
+	}
+	return convertSQLs, newArgs, nil
+}
+
+// ConvertUnit converts sql like Convert and returns each statement with its
+// own args. The table metadata changed by DDL is returned rather than
+// applied, the caller applies it after the statements are executed
+// successfully.
+func (c *OracleConverter) ConvertUnit(sql string, foundRows bool, args ...interface{}) ([]ConvertedStmt, MetaChange, error) {
+	rules := c.RewriteRules()
+	if replaced, ok := rules.ReplaceStmt(sql); ok {
+		golog.Info("OracleConverter", "Convert", "ReplaceSQL", 0, replaced)
+		return []ConvertedStmt{{SQL: replaced, Args: args, RowsFactor: 1}}, nil, nil
+	}
 	sqlType := Preview(sql)
 	if !supportConvert(sqlType) {
-		return nil, []string{sql}, args, nil
+		return []ConvertedStmt{{SQL: sql, Args: args, RowsFactor: 1}}, nil, nil
+	}
+	meta := c.newMetaChange()
+	var keys *TableSpec
+	if sqlType == StmtDDL {
+		// ALTER TABLE的子句不在语法树中，从SQL文本转换
+		if stmts, ok, err := c.convertAlter(sql, meta); ok {
+			if err != nil {
+				return nil, nil, err
+			}
+			return c.unitStmts(stmts, args...), meta.change(), nil
+		}
+		// CREATE TABLE中语法不支持的键和外键单独解析
+		var err error
+		if sql, keys, err = splitTableKeys(sql); err != nil {
+			return nil, nil, err
+		}
 	}
-	sql, fks := SplitFk(sql)
 	stmt, err := Parse(sql)
 	if err != nil {
 		log.Printf("ignoring error parsing sql '%s': %v", sql, err)
-		return nil, nil, args, err
-	}
-	for i, fk := range fks {
-		fks[i] = fmt.Sprintf("alter table `%s` add %s;", stmt.(*DDL).NewName.Name, fk)
+		return nil, nil, err
 	}
+	mergeTableKeys(stmt, keys)
+	// 自定义规则在内置转换之前改写MySQL语法树
+	rules.RewriteFuncs(sql, stmt)
 
-	// 转换statement时可能带来参数数量的变化，例如：replace转merge， insert去掉increment column等，
-	// 因此，参数args也需要作相应的配套处理
-	oracleStmt, args := c.convertStmt(stmt, args...)
+	oracleStmt, err := c.convertStmt(stmt, foundRows, meta, args...)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	if oracleStmt == nil {
-		return fks, []string{c.replaceCommonIdents(sql)}, args, nil
+		return []ConvertedStmt{{SQL: oracleRawSQL(sql), Args: args, RowsFactor: 1}}, meta.change(), nil
+	}
+	stmts, ok := oracleStmt.(Statements)
+	if !ok {
+		stmts = Statements{oracleStmt}
 	}
-	buf := NewTrackedBuffer(nil).WriteNode(oracleStmt)
-	convertSQL := c.replaceCommonIdents(buf.String())
-	golog.Info("OracleConverter", "Convert", "ConvertSQL", 0, convertSQL)
-	return fks, []string{convertSQL}, args, nil
+	return c.unitStmts(stmts, args...), meta.change(), nil
 }
 
-func (c *OracleConverter) convertStmt(stmt Statement, args ...interface{}) (Statement, []interface{}) {
-	var newStmt Statement
+// unitStmts 多条语句分别生成SQL，转换statement时可能带来参数数量的变化，例如：insert去掉
+// increment column，replace转换的delete和insert都引用插入的值等，每条语句都按原参数的顺序
+// 引用参数，分别编号
+func (c *OracleConverter) unitStmts(stmts Statements, args ...interface{}) []ConvertedStmt {
+	unit := make([]ConvertedStmt, 0, len(stmts))
+	for _, s := range stmts {
+		factor := int64(1)
+		switch n := s.(type) {
+		case *DmResultQuery:
+			// 查询的影响行数是查到的affected_rows__
+			if n.Column != AffectedRowsColumn {
+				factor = 0
+			}
+		case *DmIdentityInsert:
+			factor = 0
+		}
+		stmtArgs := args
+		if c.needConvertArgs(s, args...) {
+			s, stmtArgs = c.convertStmtArgs(s, args...)
+		}
+		buf := NewTrackedBuffer(nil).WithDialect(OracleDialect).WriteNode(s)
+		convertSQL := buf.String()
+		golog.Info("OracleConverter", "Convert", "ConvertSQL", 0, convertSQL)
+		unit = append(unit, ConvertedStmt{SQL: convertSQL, Args: stmtArgs, RowsFactor: factor})
+	}
+	return unit
+}
+
+// SetRewriteRules replaces the rewrite rules, nil removes them.
+func (c *OracleConverter) SetRewriteRules(rules *RewriteRules) {
+	c.rules.Store(rules)
+}
+
+func (c *OracleConverter) RewriteRules() *RewriteRules {
+	rules, _ := c.rules.Load().(*RewriteRules)
+	return rules
+}
+
+func (c *OracleConverter) convertStmt(stmt Statement, foundRows bool, meta *metaChange, args ...interface{}) (Statement, error) {
+	var (
+		newStmt Statement
+		err     error
+	)
 	switch stmt.(type) {
 	case *Insert:
-		newStmt = c.convertInsert(stmt.(*Insert))
+		if newStmt, err = c.convertInsert(stmt.(*Insert), foundRows, args...); err != nil {
+			return nil, err
+		}
 	case *Update:
-		newStmt = c.convertUpdateIncrement(stmt.(*Update))
+		if newStmt, err = c.convertUpdate(stmt.(*Update), foundRows); err != nil {
+			return nil, err
+		}
+	case *Delete:
+		if newStmt, err = c.convertDelete(stmt.(*Delete)); err != nil {
+			return nil, err
+		}
 	case *Select:
 		newStmt = c.convertSelect(stmt.(*Select))
 	case *DDL:
-		newStmt = c.convertDDL(stmt.(*DDL))
+		newStmt = c.convertDDL(stmt.(*DDL), meta)
 	case *DBDDL:
 		newStmt = c.convertDBDDL(stmt.(*DBDDL))
 	default:
 		newStmt = stmt
 	}
-
-	if c.needConvertArgs(newStmt, args...) {
-		return c.convertStmtArgs(newStmt, args...)
+	if newStmt != nil {
+		newStmt = c.convertLimit(newStmt)
+		c.convertFuncs(newStmt)
 	}
-	return newStmt, args
+	return newStmt, nil
 }
 
 func (c *OracleConverter) convertSelect(stmt *Select) Statement {
@@ -96,16 +198,180 @@ func (c *OracleConverter) convertSelect(stmt *Select) Statement {
 	return stmt
 }
 
-func (c *OracleConverter) needConvertArgs(stmt Statement, args ...interface{}) bool {
-	if len(args) == 0 {
-		return false
+// convertLimit 把limit转换为目标库的分页语法，包括子查询、union、insert ... select和merge的
+// using中的limit，update和delete的limit转换为rownum条件
+func (c *OracleConverter) convertLimit(stmt Statement) Statement {
+	switch node := stmt.(type) {
+	case SelectStatement:
+		stmt = c.pageSelect(node)
+	case *Update:
+		if node.Limit != nil {
+			node.Where = limitRows(node.TableExprs, node.Where, node.OrderBy, node.Limit)
+			node.OrderBy, node.Limit = nil, nil
+		}
+	case *Delete:
+		if node.Limit != nil {
+			node.Where = limitRows(node.TableExprs, node.Where, node.OrderBy, node.Limit)
+			node.OrderBy, node.Limit = nil, nil
+		}
 	}
-	switch stmt.(type) {
-	case *Merge, *Insert:
-		return true
+
+	visit := func(node SQLNode) (kcontinue bool, err error) {
+		switch n := node.(type) {
+		case *Subquery:
+			n.Select = c.pageSelect(n.Select)
+		case *ParenSelect:
+			n.Select = c.pageSelect(n.Select)
+		case *Union:
+			n.Left = c.pageSelect(n.Left)
+			n.Right = c.pageSelect(n.Right)
+		case *Insert:
+			if rows, ok := n.Rows.(SelectStatement); ok {
+				n.Rows = c.pageSelect(rows)
+			}
+		case *VirtualTableExpr:
+			if n.Select != nil {
+				n.Select = c.pageSelect(n.Select)
+			}
+		}
+		return true, nil
+	}
+	_ = Walk(visit, stmt)
+	return stmt
+}
+
+// pageSelect 去掉select或union的limit，返回按c.pagination分页的查询
+func (c *OracleConverter) pageSelect(sel SelectStatement) SelectStatement {
+	var (
+		limit *Limit
+		lock  string
+	)
+	switch node := sel.(type) {
+	case *Select:
+		limit, lock = node.Limit, node.Lock
+		node.Limit, node.Lock = nil, ""
+	case *Union:
+		limit, lock = node.Limit, node.Lock
+		node.Limit, node.Lock = nil, ""
+	}
+	if limit == nil {
+		return sel
+	}
+
+	offset := limit.Offset
+	if v, ok := offset.(*SQLVal); ok && v.Type == IntVal && string(v.Val) == "0" {
+		offset = nil
+	}
+	if c.pagination == PAGINATION_ROWNUM {
+		if offset == nil {
+			return &RownumSelect{Select: sel, MaxRow: limit.Rowcount, Lock: lock}
+		}
+		return &RownumSelect{
+			Select:  sel,
+			Columns: selectColumnNames(sel),
+			Offset:  offset,
+			MaxRow:  addLimitExpr(offset, limit.Rowcount),
+			Lock:    lock,
+		}
+	}
+	return &OffsetFetchSelect{Select: sel, Offset: offset, Rowcount: limit.Rowcount, Lock: lock}
+}
+
+// addLimitExpr 返回offset + count，offset在rownum分页中出现两次，参数需要复制一份
+func addLimitExpr(offset, rowcount Expr) Expr {
+	o, ok1 := offset.(*SQLVal)
+	r, ok2 := rowcount.(*SQLVal)
+	if ok1 && ok2 && o.Type == IntVal && r.Type == IntVal {
+		ov, err1 := strconv.ParseUint(string(o.Val), 10, 64)
+		rv, err2 := strconv.ParseUint(string(r.Val), 10, 64)
+		if err1 == nil && err2 == nil {
+			return NewIntVal([]byte(strconv.FormatUint(ov+rv, 10)))
+		}
+	}
+	if ok1 {
+		offset = &SQLVal{Type: o.Type, Val: o.Val}
+	}
+	return &BinaryExpr{Left: offset, Operator: PlusStr, Right: rowcount}
+}
+
+// selectColumnNames 返回查询结果的列名，用于rownum分页时不返回行号列，
+// 有select *、没有别名的表达式或重名的列时返回nil
+func selectColumnNames(sel SelectStatement) SelectExprs {
+	var node *Select
+	switch n := sel.(type) {
+	case *Select:
+		node = n
+	case *Union:
+		return selectColumnNames(n.Left)
+	case *ParenSelect:
+		return selectColumnNames(n.Select)
 	default:
-		return false
+		return nil
 	}
+
+	names := make(map[string]bool, len(node.SelectExprs))
+	columns := make(SelectExprs, 0, len(node.SelectExprs))
+	for _, expr := range node.SelectExprs {
+		aliased, ok := expr.(*AliasedExpr)
+		if !ok {
+			return nil
+		}
+		name := aliased.As
+		if name.IsEmpty() {
+			col, ok := aliased.Expr.(*ColName)
+			if !ok {
+				return nil
+			}
+			name = col.Name
+		}
+		if names[name.Lowered()] {
+			return nil
+		}
+		names[name.Lowered()] = true
+		columns = append(columns, &AliasedExpr{Expr: &ColName{Name: name}})
+	}
+	return columns
+}
+
+// limitRows 把update、delete的limit转换为where条件：没有order by时直接加rownum条件，
+// 有order by时按rowid取排序后的前count行
+func limitRows(tables TableExprs, where *Where, orderBy OrderBy, limit *Limit) *Where {
+	if len(orderBy) == 0 {
+		return andWhere(where, &ComparisonExpr{Left: Pseudocolumn(RownumStr), Operator: LessEqualStr, Right: limit.Rowcount})
+	}
+	return limitRowids(tables, where, orderBy, limit)
+}
+
+// limitRowids 返回rowid in (前count行的rowid)，不与其他条件一起按rownum取行
+func limitRowids(tables TableExprs, where *Where, orderBy OrderBy, limit *Limit) *Where {
+	rows := &RownumSelect{
+		Select: &Select{
+			SelectExprs: SelectExprs{&AliasedExpr{Expr: Pseudocolumn(RowidStr)}},
+			From:        tables,
+			Where:       where,
+			OrderBy:     orderBy,
+		},
+		MaxRow: limit.Rowcount,
+	}
+	return NewWhere(WhereStr, &ComparisonExpr{Left: Pseudocolumn(RowidStr), Operator: InStr, Right: &Subquery{Select: rows}})
+}
+
+// andWhere 在where条件之后追加and条件
+func andWhere(where *Where, cond Expr) *Where {
+	if where == nil {
+		return NewWhere(WhereStr, cond)
+	}
+	expr := where.Expr
+	if _, ok := expr.(*OrExpr); ok {
+		expr = &ParenExpr{Expr: expr}
+	}
+	return NewWhere(WhereStr, &AndExpr{Left: expr, Right: cond})
+}
+
+// needConvertArgs 转换可能去掉参数（insert去掉自增列）或复制参数（rownum分页的offset），
+// 有参数时都按转换后的位置重新编号
+func (c *OracleConverter) needConvertArgs(stmt Statement, args ...interface{}) bool {
+	return stmt != nil && len(args) > 0
 }
 
 func (c *OracleConverter) convertStmtArgs(stmt Statement, args ...interface{}) (Statement, []interface{}) {
@@ -115,6 +381,9 @@ func (c *OracleConverter) convertStmtArgs(stmt Statement, args ...interface{}) (
 		switch node.(type) {
 		case *SQLVal:
 			n := node.(*SQLVal)
+			if n.Type != ValArg {
+				return true, nil
+			}
 			v := string(n.Val)
 			i, _ := strconv.Atoi(strings.ReplaceAll(v, ":v", ""))
 			n.Val = []byte(fmt.Sprintf(":v%d", id))
@@ -129,46 +398,187 @@ func (c *OracleConverter) convertStmtArgs(stmt Statement, args ...interface{}) (
 	return stmt, newArgs
 }
 
-func (c *OracleConverter) convertInsert(stmt *Insert) Statement {
-	// try to find auto increment columns and remove them
-	stmt = c.convertInsertIncrement(stmt)
-	// write a method to walk ast tree, recognize all kinds of expr, and rebuild oracle ast
-	if stmt.Action == InsertStr && stmt.OnDup == nil {
-		return stmt
+// convertInsert 把replace、insert ignore和insert ... on duplicate key update按插入的列中的
+// 主键或唯一索引转换：
+//   - replace转换为先delete冲突的行再insert的两条语句，影响行数与MySQL相同，替换的行计为2；
+//   - insert ignore转换为只有not matched子句的merge；
+//   - on duplicate key update转换为merge，影响行数与MySQL相同，参见upsertToMerges。
+//
+// 插入的列中没有主键或唯一索引时返回ErrNoUniqueKey，按原语句执行会改变语义。
+//
+// 自增列的值为NULL或0的行去掉该列由数据库生成，指定了值的行在set identity_insert on和off
+// 之间插入，两种行都有时拆分为两条语句，各自引用自己的行中的参数。
+func (c *OracleConverter) convertInsert(stmt *Insert, foundRows bool, args ...interface{}) (Statement, error) {
+	explicit, generated := c.convertInsertIncrement(stmt, args...)
+	var stmts Statements
+	if explicit != nil {
+		s, err := c.convertUpsert(explicit, foundRows, args...)
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, &DmIdentityInsert{Table: stmt.Table, On: true})
+		stmts = appendStatements(stmts, s)
+		stmts = append(stmts, &DmIdentityInsert{Table: stmt.Table})
+	}
+	if generated != nil {
+		s, err := c.convertUpsert(generated, foundRows, args...)
+		if err != nil {
+			return nil, err
+		}
+		stmts = appendStatements(stmts, s)
+		if len(c.tableIncrementColumns(stmt.Table.Name.String())) != 0 {
+			stmts = append(stmts, insertIdQuery(generated))
+		}
+	}
+	if len(stmts) == 1 {
+		return stmts[0], nil
 	}
-	// The case where columns is empty is not currently supported for conversion.
+	return stmts, nil
+}
+
+// insertIdQuery 查询生成的自增ID，与MySQL一样多行insert返回第一行的ID，
+// 达梦的scope_identity()是最后一行的ID，自增列的步长为1
+func insertIdQuery(stmt *Insert) *DmResultQuery {
+	var expr Expr = &FuncExpr{Name: NewColIdent("scope_identity")}
+	rows, ok := stmt.Rows.(Values)
+	if ok && len(rows) > 1 && stmt.Action == InsertStr && stmt.OnDup == nil && stmt.Ignore == "" {
+		expr = &BinaryExpr{Left: expr, Operator: MinusStr, Right: newInt(int64(len(rows) - 1))}
+	}
+	return &DmResultQuery{Column: InsertIdColumn, Expr: expr}
+}
+
+func appendStatements(stmts Statements, s Statement) Statements {
+	if more, ok := s.(Statements); ok {
+		return append(stmts, more...)
+	}
+	return append(stmts, s)
+}
+
+// convertUpsert 转换replace、insert ignore和insert ... on duplicate key update，普通insert不变。
+// 多行插入中有唯一索引的值相同的行时返回ErrDuplicateKeyRows，参见duplicateKeyRows
+func (c *OracleConverter) convertUpsert(stmt *Insert, foundRows bool, args ...interface{}) (Statement, error) {
+	if stmt.Action == InsertStr && stmt.OnDup == nil && stmt.Ignore == "" {
+		return stmt, nil
+	}
+	// 没有指定columns时按表的列补充
 	if len(stmt.Columns) == 0 {
-		return stmt
+		for _, column := range c.tableColumnNames(stmt.Table.Name.String()) {
+			stmt.Columns = append(stmt.Columns, NewColIdent(column))
+		}
 	}
 
 	// find unique columns for table
 	condcols := c.getUniqueConditionColumns(stmt)
-	if len(condcols) == 0 {
-		stmt.OnDup = nil
-		return stmt
+	if len(stmt.Columns) == 0 || len(condcols) == 0 {
+		return nil, fmt.Errorf("%w: table %s", ErrNoUniqueKey, stmt.Table.Name.String())
+	}
+	if duplicateKeyRows(stmt, condcols, args) {
+		return nil, fmt.Errorf("%w: table %s", ErrDuplicateKeyRows, stmt.Table.Name.String())
 	}
 	tableExpr := c.buildMergeTableExpr(stmt, condcols)
-	matchedExpr := buildMatchedExpr(stmt, condcols)
-
-	if tableExpr == nil || len(matchedExpr) == 0 {
-		return stmt
+	if stmt.Action == ReplaceStr {
+		return replaceToDeleteInsert(stmt, tableExpr), nil
 	}
 
-	// sets the qualifier for columns
-	// setQualifierForCols(tableExpr)
-	setQualifierForCols(matchedExpr)
+	unmatchedExpr := &UnmatchedExpr{
+		Columns: stmt.Columns,
+		Values:  buildValuesExpr(stmt),
+	}
+	if stmt.OnDup == nil {
+		return &Merge{
+			Comments:  stmt.Comments,
+			Table:     tableExpr,
+			Unmatched: unmatchedExpr,
+		}, nil
+	}
+	matchedExpr, err := buildMatchedExpr(stmt, condcols)
+	if err != nil {
+		return nil, err
+	}
 	log.Printf("condcols: %v, tableExpr: %v, matchedExpr: %v", condcols, tableExpr, matchedExpr)
 
-	return &Merge{
-		Comments: stmt.Comments,
-		Table:    tableExpr,
-		Matched:  matchedExpr,
-		Unmatched: &UnmatchedExpr{
-			Columns: stmt.Columns,
-			// Rows:    Rows,
-			Values: buildValuesExpr(stmt),
-		},
+	merge := &Merge{
+		Comments:  stmt.Comments,
+		Table:     tableExpr,
+		Matched:   matchedExpr,
+		Unmatched: unmatchedExpr,
+	}
+	if matchedExpr == nil {
+		return merge, nil
+	}
+	return upsertToMerge(merge, foundRows), nil
+}
+
+// upsertToMerge 在on duplicate key update转换的merge之前查询值改变的行数：
+//
+//	select count(*) as affected_rows__ from t as t, s where <on> and <changed>
+//	merge into t using s on ... when matched then update set ... [where <changed>] when not matched then insert ...
+//
+// MySQL插入的行计为1，更新的行计为2，值不变的行计为0，客户端有CLIENT_FOUND_ROWS时计为1，
+// 达梦的merge不区分更新的行是否改变。与convertUpdateChanged一样按decode判断值是否改变，
+// 值改变的行由查询再计一次，没有CLIENT_FOUND_ROWS时merge不更新值不变的行。查询和merge
+// 都引用插入的值，参数绑定两次。
+func upsertToMerge(merge *Merge, foundRows bool) Statements {
+	changed := changedExpr(UpdateExprs(merge.Matched))
+	source := cloneMergeTable(merge.Table)
+	query := &DmResultQuery{
+		Column: AffectedRowsColumn,
+		Expr:   &FuncExpr{Name: NewColIdent("count"), Exprs: SelectExprs{&StarExpr{}}},
+		From:   TableExprs{source.LeftExpr, source.RightExpr},
+		Where:  andWhere(NewWhere(WhereStr, source.Condition.On), CloneExpr(changed)),
+	}
+	if !foundRows {
+		merge.Where = NewWhere(WhereStr, changed)
+	}
+	return Statements{query, merge}
+}
+
+// cloneMergeTable 复制merge的源表，插入的值或查询复制一份，参数分别编号
+func cloneMergeTable(tableExpr *MergeTableExpr) *MergeTableExpr {
+	source := *tableExpr.RightExpr.(*VirtualTableExpr)
+	source.Select = cloneSelect(source.Select)
+	rows := make(SelectValues, 0, len(source.Rows))
+	for _, tuple := range source.Rows {
+		row := make(SelectTuple, 0, len(tuple))
+		for _, expr := range tuple {
+			row = append(row, CloneExpr(expr))
+		}
+		rows = append(rows, row)
 	}
+	source.Rows = rows
+	return &MergeTableExpr{
+		LeftExpr:  tableExpr.LeftExpr,
+		RightExpr: &source,
+		Condition: JoinCondition{On: CloneExpr(tableExpr.Condition.On), Using: tableExpr.Condition.Using},
+	}
+}
+
+// replaceToDeleteInsert 把replace转换为delete和insert：
+//
+//	replace into t (id, name) values (1, 'a')
+//	delete from t as t where exists (select 1 from (select 1, 'a') s (id, name) where t.id = s.id)
+//	insert into t (id, name) values (1, 'a')
+//
+// delete和insert分别引用全部参数，与MySQL一样删除与任意一个唯一索引冲突的行。replace ... select
+// 的查询复制一份作为delete的虚拟表。
+func replaceToDeleteInsert(stmt *Insert, tableExpr *MergeTableExpr) Statements {
+	del := &Delete{
+		Comments:   stmt.Comments,
+		TableExprs: TableExprs{tableExpr.LeftExpr},
+		Where:      matchedWhere(tableExpr),
+	}
+	stmt.Action = InsertStr
+	return Statements{del, stmt}
+}
+
+// matchedWhere 返回目标表中与插入的行冲突的条件，插入的值复制一份，参数分别编号
+func matchedWhere(tableExpr *MergeTableExpr) *Where {
+	source := cloneMergeTable(tableExpr)
+	return NewWhere(WhereStr, &ExistsExpr{Subquery: &Subquery{Select: &Select{
+		SelectExprs: SelectExprs{&AliasedExpr{Expr: newInt(1)}},
+		From:        TableExprs{source.RightExpr},
+		Where:       NewWhere(WhereStr, source.Condition.On),
+	}}})
 }
 
 func buildValuesExpr(stmt *Insert) ValuesExpr {
@@ -184,61 +594,423 @@ func buildValuesExpr(stmt *Insert) ValuesExpr {
 	return ValuesExpr(values)
 }
 
-func (c *OracleConverter) convertInsertIncrement(stmt *Insert) *Insert {
-	if _, ok := stmt.Rows.(Values); !ok {
-		return stmt
-	}
-
-	incrementColumns := c.incrementColumns[stmt.Table.Name.String()]
-	if incrementColumns == nil || len(incrementColumns) == 0 {
-		return stmt
+// convertInsertIncrement 按自增列的值拆分insert的行，返回指定了自增列的值的insert和由数据库生成值
+// 的insert，没有这样的行时为nil。与MySQL一样（没有NO_AUTO_VALUE_ON_ZERO时），NULL和0生成值，
+// 生成值的行去掉自增列。没有参数时（例如prepare）无法判断参数的值，按生成值处理。insert ... select
+// 插入自增列时无法判断查询到的值，整条语句按指定值处理。
+func (c *OracleConverter) convertInsertIncrement(stmt *Insert, args ...interface{}) (*Insert, *Insert) {
+	incrementColumns := c.tableIncrementColumns(stmt.Table.Name.String())
+	if len(incrementColumns) == 0 {
+		return nil, stmt
 	}
 
 	// 没有指定columns的补充columns
 	if len(stmt.Columns) == 0 {
 		stmt.Columns = []ColIdent{}
-		for _, column := range c.tableColumns[stmt.Table.Name.String()] {
+		for _, column := range c.tableColumnNames(stmt.Table.Name.String()) {
 			stmt.Columns = append(stmt.Columns, NewColIdent(column))
 		}
 	}
-
-	// remove auto increment columns
-	ns := []int{}
-	newColumns := []ColIdent{}
+	index := -1
 	for i, column := range stmt.Columns {
 		if _, ok := incrementColumns[column.String()]; ok {
-			ns = append(ns, i)
-		} else {
-			newColumns = append(newColumns, column)
+			index = i
+			break
 		}
-		stmt.Columns = newColumns
+	}
+	if index < 0 {
+		return nil, stmt
+	}
+	values, ok := stmt.Rows.(Values)
+	if !ok {
+		return stmt, nil
 	}
 
-	var rows Values
-	for _, row := range stmt.Rows.(Values) {
-		newRow := ValTuple{}
+	var explicitRows, generatedRows Values
+	for _, row := range values {
+		if index < len(row) && !isGeneratedIncrement(row[index], args) {
+			explicitRows = append(explicitRows, row)
+			continue
+		}
+		newRow := make(ValTuple, 0, len(row))
 		for i, v := range row {
-			if len(ns) == 0 {
+			if i != index {
 				newRow = append(newRow, v)
-			} else {
-				for n := range ns {
-					if i != n {
-						newRow = append(newRow, v)
-					}
+			}
+		}
+		generatedRows = append(generatedRows, newRow)
+	}
+	if len(explicitRows) == 0 {
+		stmt.Columns = append(stmt.Columns[:index:index], stmt.Columns[index+1:]...)
+		stmt.Rows = generatedRows
+		return nil, stmt
+	}
+	if len(generatedRows) == 0 {
+		return stmt, nil
+	}
+	// 两条语句各自引用一部分参数，参见unitStmts
+	generated := *stmt
+	generated.Columns = append(stmt.Columns[:index:index], stmt.Columns[index+1:]...)
+	generated.Rows = generatedRows
+	if stmt.OnDup != nil {
+		// 转换merge时会修改on duplicate key update的表达式
+		generated.OnDup = make(OnDup, 0, len(stmt.OnDup))
+		for _, expr := range stmt.OnDup {
+			generated.OnDup = append(generated.OnDup, &UpdateExpr{Name: CloneExpr(expr.Name).(*ColName), Expr: CloneExpr(expr.Expr)})
+		}
+	}
+	stmt.Rows = explicitRows
+	return stmt, &generated
+}
+
+// isGeneratedIncrement 自增列的值是否由数据库生成
+func isGeneratedIncrement(expr Expr, args []interface{}) bool {
+	switch v := expr.(type) {
+	case *NullVal, *Default:
+		return true
+	case *SQLVal:
+		switch v.Type {
+		case IntVal, FloatVal, StrVal:
+			return isZeroNumber(string(v.Val))
+		case ValArg:
+			arg, ok := bindArg(v, args)
+			return !ok || isZeroNumber(arg)
+		}
+	}
+	return false
+}
+
+// bindArg 返回参数:vN绑定的值，没有绑定或者值为NULL时返回false
+func bindArg(v *SQLVal, args []interface{}) (string, bool) {
+	i, err := strconv.Atoi(strings.TrimPrefix(string(v.Val), ":v"))
+	if err != nil || i < 1 || i > len(args) {
+		return "", false
+	}
+	switch arg := args[i-1].(type) {
+	case nil:
+		return "", false
+	case []byte:
+		return string(arg), true
+	default:
+		return fmt.Sprint(arg), true
+	}
+}
+
+// duplicateKeyRows 判断多行插入中是否有主键或唯一索引的值相同的行。MySQL逐行插入，后面的行
+// 替换、忽略或更新前面插入的行，达梦的merge和replace转换的delete与insert按整条语句执行，
+// 不能得到相同的结果，merge匹配到using中的多行时报错。值不是常量或参数的行不比较
+func duplicateKeyRows(stmt *Insert, condcols [][]string, args []interface{}) bool {
+	rows, ok := stmt.Rows.(Values)
+	if !ok || len(rows) < 2 {
+		return false
+	}
+	for _, cols := range condcols {
+		seen := make(map[string]bool, len(rows))
+	nextRow:
+		for _, row := range rows {
+			values := make([]string, 0, len(cols))
+			for _, col := range cols {
+				i := stmt.Columns.FindColumn(NewColIdent(col))
+				if i < 0 || i >= len(row) {
+					continue nextRow
+				}
+				value, ok := keyValue(row[i], args)
+				if !ok {
+					continue nextRow
 				}
+				values = append(values, value)
+			}
+			key := strings.Join(values, "\x00")
+			if seen[key] {
+				return true
 			}
+			seen[key] = true
 		}
-		rows = append(rows, newRow)
 	}
-	stmt.Rows = rows
-	return stmt
+	return false
+}
+
+// keyValue 返回插入的常量或参数的值，NULL不与其他行冲突
+func keyValue(expr Expr, args []interface{}) (string, bool) {
+	v, ok := expr.(*SQLVal)
+	if !ok {
+		return "", false
+	}
+	switch v.Type {
+	case IntVal, FloatVal, StrVal, HexNum, HexVal:
+		return string(v.Val), true
+	case ValArg:
+		return bindArg(v, args)
+	}
+	return "", false
+}
+
+func isZeroNumber(s string) bool {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return err == nil && f == 0
+}
+
+// convertUpdate 去掉自增列，多表update转换为merge
+func (c *OracleConverter) convertUpdate(stmt *Update, foundRows bool) (Statement, error) {
+	// 与MySQL一样多表update不能有limit，merge不能限制行数
+	if stmt.Limit != nil && isMultiTable(stmt.TableExprs) {
+		return nil, ErrUpdateLimit
+	}
+	stmt = c.convertUpdateIncrement(stmt)
+	if !foundRows {
+		// 先按limit取行再判断值是否改变，与MySQL取相同的行
+		if stmt.Limit != nil {
+			stmt.Where = limitRowids(stmt.TableExprs, stmt.Where, stmt.OrderBy, stmt.Limit)
+			stmt.OrderBy, stmt.Limit = nil, nil
+		}
+		convertUpdateChanged(stmt)
+	}
+	c.convertUpdateOnUpdate(stmt)
+	if !isMultiTable(stmt.TableExprs) {
+		return stmt, nil
+	}
+	// 修改多个表的update目标库不支持，不能按原语句执行
+	target := updateTarget(stmt)
+	if target == nil {
+		return nil, fmt.Errorf("%w: %s", ErrMultiTargetUpdate, String(stmt))
+	}
+	return updateToMerge(stmt, target), nil
+}
+
+// convertUpdateChanged 客户端没有CLIENT_FOUND_ROWS时MySQL返回值改变的行数，达梦返回匹配的行数，
+// update加上至少一列的值改变的条件。MySQL的limit限制匹配的行数，值不变的行也计入limit，
+// 有limit时按rowid取前count行再加上这个条件，不能与rownum条件一起取行
+func convertUpdateChanged(stmt *Update) {
+	if len(stmt.Exprs) == 0 {
+		return
+	}
+	stmt.Where = andWhere(stmt.Where, changedExpr(stmt.Exprs))
+}
+
+// changedExpr 返回set中至少一列的值改变的条件，decode认为两个null相等
+func changedExpr(exprs UpdateExprs) Expr {
+	var changed Expr
+	for _, expr := range exprs {
+		cond := isChanged(expr.Name, expr.Expr)
+		if changed != nil {
+			cond = &OrExpr{Left: changed, Right: cond}
+		}
+		changed = cond
+	}
+	if len(exprs) > 1 {
+		changed = &ParenExpr{Expr: changed}
+	}
+	return changed
+}
+
+// isChanged 返回decode(old, new, 0, 1) = 1
+func isChanged(old, new Expr) Expr {
+	return &ComparisonExpr{
+		Left: &FuncExpr{Name: NewColIdent("decode"), Exprs: SelectExprs{
+			&AliasedExpr{Expr: CloneExpr(old)},
+			&AliasedExpr{Expr: CloneExpr(new)},
+			&AliasedExpr{Expr: newInt(0)},
+			&AliasedExpr{Expr: newInt(1)},
+		}},
+		Operator: EqualStr,
+		Right:    newInt(1),
+	}
+}
+
+// convertDelete 去掉delete t from ...中的删除目标，多表delete转换为exists子查询
+func (c *OracleConverter) convertDelete(stmt *Delete) (Statement, error) {
+	if len(stmt.Targets) == 0 {
+		return stmt, nil
+	}
+	// 删除多个表的delete目标库不支持，不能按原语句执行
+	if len(stmt.Targets) > 1 {
+		return nil, fmt.Errorf("%w: %s", ErrMultiTargetDelete, String(stmt))
+	}
+	target := findTable(aliasedTables(stmt.TableExprs), stmt.Targets[0])
+	if target == nil {
+		return nil, fmt.Errorf("unknown table %s in multi delete", stmt.Targets[0].Name.String())
+	}
+	if !isMultiTable(stmt.TableExprs) {
+		stmt.Targets = nil
+		return stmt, nil
+	}
+	return deleteToExists(stmt, target), nil
+}
+
+// updateToMerge 把多表update转换为按rowid匹配的merge：
+//
+//	update a join b on a.id = b.aid set a.x = b.y where b.z = 1
+//	merge into a using (select a.rowid as rid__, b.y as v1__ from a join b on a.id = b.aid where b.z = 1) as s__
+//	on (a.rowid = s__.rid__) when matched then update set a.x = s__.v1__
+//
+// join的类型和条件都保留在using的子查询中，left join没有匹配的行set为null。
+// 目标表的一行匹配多行时merge报错，子查询按rowid去重，和MySQL一样只修改一次：
+// set的值只引用目标表时留在原处，子查询用distinct；set的值引用了其他表时，
+// 子查询按rowid分组，取匹配的行中的最大值（MySQL取其中任意一行的值）。
+func updateToMerge(stmt *Update, target *AliasedTableExpr) *Merge {
+	qualifier := tableQualifier(target)
+	source := TableName{Name: NewTableIdent("s__")}
+	rid := NewColIdent("rid__")
+	sel := &Select{
+		SelectExprs: SelectExprs{&AliasedExpr{Expr: &RowidExpr{Qualifier: qualifier}, As: rid}},
+		From:        stmt.TableExprs,
+		Where:       stmt.Where,
+	}
+	for _, expr := range stmt.Exprs {
+		if refersOnly(expr.Expr, qualifier) {
+			continue
+		}
+		col := NewColIdent(fmt.Sprintf("v%d__", len(sel.SelectExprs)))
+		sel.SelectExprs = append(sel.SelectExprs, &AliasedExpr{Expr: expr.Expr, As: col})
+		expr.Expr = &ColName{Name: col, Qualifier: source}
+	}
+	if len(sel.SelectExprs) == 1 {
+		sel.Distinct = DistinctStr
+	} else {
+		for _, expr := range sel.SelectExprs[1:] {
+			aliased := expr.(*AliasedExpr)
+			aliased.Expr = newFunc("max", aliased.Expr)
+		}
+		sel.GroupBy = GroupBy{&RowidExpr{Qualifier: qualifier}}
+	}
+
+	return &Merge{
+		Comments: stmt.Comments,
+		Table: &MergeTableExpr{
+			LeftExpr:  &AliasedTableExpr{Expr: target.Expr, As: target.As},
+			RightExpr: &AliasedTableExpr{Expr: &Subquery{Select: sel}, As: source.Name},
+			Condition: JoinCondition{On: &ParenExpr{Expr: &ComparisonExpr{
+				Left:     &RowidExpr{Qualifier: qualifier},
+				Operator: EqualStr,
+				Right:    &ColName{Name: rid, Qualifier: source},
+			}}},
+		},
+		Matched: MatchedExpr(stmt.Exprs),
+	}
+}
+
+// deleteToExists 把多表delete转换为exists子查询，join和where都保留在子查询中，
+// 子查询里的表名和别名不变，按rowid关联外层的目标表：
+//
+//	delete a from a left join b on a.id = b.aid where b.aid is null
+//	delete from a as d__ where exists (select 1 from a left join b on a.id = b.aid where b.aid is null and a.rowid = d__.rowid)
+func deleteToExists(stmt *Delete, target *AliasedTableExpr) *Delete {
+	outer := NewTableIdent("d__")
+	sel := &Select{
+		SelectExprs: SelectExprs{&AliasedExpr{Expr: newInt(1)}},
+		From:        stmt.TableExprs,
+		Where: andWhere(stmt.Where, &ComparisonExpr{
+			Left:     &RowidExpr{Qualifier: tableQualifier(target)},
+			Operator: EqualStr,
+			Right:    &RowidExpr{Qualifier: outer},
+		}),
+	}
+	return &Delete{
+		Comments:   stmt.Comments,
+		TableExprs: TableExprs{&AliasedTableExpr{Expr: target.Expr, As: outer}},
+		Where:      NewWhere(WhereStr, &ExistsExpr{Subquery: &Subquery{Select: sel}}),
+	}
+}
+
+// isMultiTable 判断是否引用了多个表，包括join和逗号分隔的表
+func isMultiTable(tables TableExprs) bool {
+	if len(tables) != 1 {
+		return len(tables) > 1
+	}
+	_, ok := tables[0].(*AliasedTableExpr)
+	return !ok
+}
+
+// aliasedTables 返回join中的所有表，不包括子查询
+func aliasedTables(tables TableExprs) []*AliasedTableExpr {
+	var result []*AliasedTableExpr
+	var add func(expr TableExpr)
+	add = func(expr TableExpr) {
+		switch t := expr.(type) {
+		case *AliasedTableExpr:
+			if _, ok := t.Expr.(TableName); ok {
+				result = append(result, t)
+			}
+		case *ParenTableExpr:
+			for _, e := range t.Exprs {
+				add(e)
+			}
+		case *JoinTableExpr:
+			add(t.LeftExpr)
+			add(t.RightExpr)
+		}
+	}
+	for _, t := range tables {
+		add(t)
+	}
+	return result
+}
+
+// tableQualifier 返回引用表的列时使用的限定名，有别名时是别名
+func tableQualifier(t *AliasedTableExpr) TableIdent {
+	if !t.As.IsEmpty() {
+		return t.As
+	}
+	return t.Expr.(TableName).Name
+}
+
+// findTable 按限定名查找表
+func findTable(tables []*AliasedTableExpr, name TableName) *AliasedTableExpr {
+	for _, t := range tables {
+		if tableQualifier(t).String() == name.Name.String() {
+			return t
+		}
+	}
+	return nil
+}
+
+// updateTarget 返回update修改的表，按set的列的限定名查找，都没有限定名时是第一个表，
+// 修改了多个表时返回nil
+func updateTarget(stmt *Update) *AliasedTableExpr {
+	tables := aliasedTables(stmt.TableExprs)
+	if len(tables) == 0 {
+		return nil
+	}
+	var target *AliasedTableExpr
+	for _, expr := range stmt.Exprs {
+		if expr.Name.Qualifier.IsEmpty() {
+			continue
+		}
+		t := findTable(tables, expr.Name.Qualifier)
+		if t == nil || (target != nil && t != target) {
+			return nil
+		}
+		target = t
+	}
+	if target == nil {
+		target = tables[0]
+	}
+	return target
+}
+
+// refersOnly 判断表达式是否只引用了限定名为qualifier的表的列，
+// 没有限定名的列和子查询都可能引用其他表
+func refersOnly(expr Expr, qualifier TableIdent) bool {
+	only := true
+	_ = Walk(func(node SQLNode) (kcontinue bool, err error) {
+		switch n := node.(type) {
+		case *ColName:
+			if n.Qualifier.Name.String() != qualifier.String() {
+				only = false
+			}
+		case *Subquery:
+			only = false
+		}
+		return only, nil
+	}, expr)
+	return only
 }
 
 func (c *OracleConverter) convertUpdateIncrement(stmt *Update) *Update {
 	if len(stmt.TableExprs) == 0 {
 		return stmt
 	}
-	incrementColumns := c.incrementColumns[getTableName(stmt)]
+	incrementColumns := c.tableIncrementColumns(getTableName(stmt))
 	if incrementColumns == nil || len(incrementColumns) == 0 {
 		return stmt
 	}
@@ -276,8 +1048,15 @@ func (c *OracleConverter) buildMergeTableExpr(stmt *Insert, condcols [][]string)
 func (c *OracleConverter) getUniqueConditionColumns(stmt *Insert) [][]string {
 	condcols := [][]string{}
 	// Case1: If user has configured unique index condcols for the table, use it as condition condcols
-	tableIndexs := c.tableUniqueIndexs[stmt.Table.Name.String()]
-	for _, iii := range tableIndexs {
+	tableIndexs := c.uniqueIndexs(stmt.Table.Name.String())
+	// 按索引名排序，转换结果不随map的遍历顺序变化
+	names := make([]string, 0, len(tableIndexs))
+	for name := range tableIndexs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		iii := tableIndexs[name]
 		i := 0
 		for _, column := range stmt.Columns {
 			for _, v := range iii {
@@ -294,58 +1073,52 @@ func (c *OracleConverter) getUniqueConditionColumns(stmt *Insert) [][]string {
 	return condcols
 }
 
-func buildMatchedExpr(stmt *Insert, condcols [][]string) MatchedExpr {
-	if stmt.OnDup != nil {
-		return MatchedExpr(stmt.OnDup)
+// buildMatchedExpr 把on duplicate key update转换为merge的update子句，列引用目标表t，
+// values(col)引用using虚拟表s中每一行插入的值：
+//
+//	on duplicate key update cnt = cnt + values(cnt)
+//	when matched then update set t.cnt = t.cnt + s.cnt
+//
+// merge不能修改on条件中的列，只有一个唯一索引时去掉col = values(col)这样不改变值的赋值，
+// 都去掉时没有matched子句。MySQL中没有插入的列的values(col)是列的默认值，转换时不知道默认值，
+// 返回ErrValuesNotInserted。
+func buildMatchedExpr(stmt *Insert, condcols [][]string) (MatchedExpr, error) {
+	var exprs MatchedExpr
+	for _, expr := range stmt.OnDup {
+		if v, ok := expr.Expr.(*ValuesFuncExpr); ok && len(condcols) == 1 &&
+			v.Name.Name.Equal(expr.Name.Name) && StringIn(expr.Name.Name.String(), condcols[0]...) {
+			continue
+		}
+		exprs = append(exprs, expr)
 	}
-	vals := getInsertValues(stmt)
-	exprs := make([]*UpdateExpr, 0, len(vals))
-
-	allCondcol := []string{}
-	for _, condcol := range condcols {
-		allCondcol = append(allCondcol, condcol...)
+	if len(exprs) == 0 {
+		return nil, nil
 	}
-	for i, column := range stmt.Columns {
 
-		if !StringIn(column.String(), allCondcol...) {
-			exprs = append(exprs, &UpdateExpr{
-				Name: &ColName{Name: column},
-				Expr: vals[i],
-			})
+	// sets the qualifier for columns
+	setQualifierForCols(exprs)
+	var err error
+	RewriteExprs(exprs, func(expr Expr) Expr {
+		v, ok := expr.(*ValuesFuncExpr)
+		if !ok {
+			return nil
 		}
-	}
-	return exprs
-}
-
-func getInsertValues(stmt *Insert) []*SQLVal {
-	vals := make([]*SQLVal, 0, len(stmt.Columns))
-	visit := func(node SQLNode) (kcontinue bool, err error) {
-		switch node.(type) {
-		case *SQLVal:
-			vals = append(vals, node.(*SQLVal))
-			return true, nil
-		default:
-			return true, nil
+		if stmt.Columns.FindColumn(v.Name.Name) < 0 && err == nil {
+			err = fmt.Errorf("%w: %s", ErrValuesNotInserted, v.Name.Name.String())
 		}
+		return &ColName{Name: v.Name.Name, Qualifier: TableName{Name: NewTableIdent("s")}}
+	})
+	if err != nil {
+		return nil, err
 	}
-	Walk(visit, stmt.Rows)
-	return vals
+	return exprs, nil
 }
 
 func getTableName(stmt *Update) string {
-	var tableName string
-	visit := func(node SQLNode) (kcontinue bool, err error) {
-		switch node.(type) {
-		case TableName:
-			table := node.(TableName)
-			tableName = table.Name.String()
-			return false, nil
-		default:
-			return true, nil
-		}
+	if target := updateTarget(stmt); target != nil {
+		return target.Expr.(TableName).Name.String()
 	}
-	Walk(visit, stmt.TableExprs)
-	return tableName
+	return ""
 }
 
 // sets the qualifier for columns in the SQLNode.
@@ -369,27 +1142,28 @@ func setQualifierForCols(node SQLNode) SQLNode {
 	return node
 }
 
+// buildRightTableExpr 返回merge的using虚拟表，insert ... select的虚拟表是其中的查询
 func buildRightTableExpr(stmt *Insert) *VirtualTableExpr {
-	return &VirtualTableExpr{
+	source := &VirtualTableExpr{
 		TableName: NewTableIdent("s"),
 		Columns:   stmt.Columns,
-		Rows:      buildSelectValues(stmt),
 	}
+	if sel, ok := stmt.Rows.(SelectStatement); ok {
+		source.Select = sel
+	} else {
+		source.Rows = buildSelectValues(stmt)
+	}
+	return source
 }
 
+// buildSelectValues 把插入的每一行转换为using虚拟表的一行
 func buildSelectValues(stmt *Insert) SelectValues {
-	values := make([]SelectTuple, 0, 10)
-	visit := func(node SQLNode) (kcontinue bool, err error) {
-		switch node.(type) {
-		case Exprs:
-			values = append(values, SelectTuple(node.(Exprs)))
-			return true, nil
-		default:
-			return true, nil
-		}
+	rows, _ := stmt.Rows.(Values)
+	values := make(SelectValues, 0, len(rows))
+	for _, row := range rows {
+		values = append(values, SelectTuple(row))
 	}
-	Walk(visit, stmt.Rows)
-	return SelectValues(values)
+	return values
 }
 
 func buildJoinConditions(stmt *Insert, condcols [][]string) Expr {
@@ -441,23 +1215,155 @@ func buildJoinConditions(stmt *Insert, condcols [][]string) Expr {
 	return conditions
 }
 
-func (c *OracleConverter) replaceCommonIdents(sql string) string {
-	for old, new := range c.replaceChars {
-		sql = strings.Replace(sql, old, new, -1)
+// oracleRawSQL rewrites the quoted identifiers and the string literals of a
+// statement which is not rebuilt from the ast, the other text including
+// comments is kept.
+func oracleRawSQL(sql string) string {
+	buf := NewTrackedBuffer(nil).WithDialect(OracleDialect)
+	for i := 0; i < len(sql); {
+		switch ch := sql[i]; {
+		case ch == '`' || ch == '\'' || ch == '"':
+			tkn := NewStringTokenizer(sql[i+1:])
+			tkn.next()
+			var (
+				typ int
+				val []byte
+			)
+			if ch == '`' {
+				typ, val = tkn.scanLiteralIdentifier()
+			} else {
+				typ, val = tkn.scanString(uint16(ch), STRING)
+			}
+			if typ == LEX_ERROR {
+				buf.WriteString(sql[i:])
+				return buf.String()
+			}
+			if ch == '`' {
+				formatID(buf, string(val), "")
+			} else {
+				NewStrVal(val).Format(buf)
+			}
+			// 扫描结束时已经多读了引号之后的一个字符
+			end := len(sql)
+			if tkn.lastChar != eofChar {
+				end = i + tkn.bufPos
+			}
+			i = end
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				buf.WriteString(sql[i:])
+				return buf.String()
+			}
+			buf.WriteString(sql[i : i+2+end+2])
+			i += 2 + end + 2
+		case ch == '#' || strings.HasPrefix(sql[i:], "-- "):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				buf.WriteString(sql[i:])
+				return buf.String()
+			}
+			buf.WriteString(sql[i : i+end])
+			i += end
+		default:
+			buf.WriteByte(ch)
+			i++
+		}
 	}
-	return sql
+	return buf.String()
 }
 
-func (c *OracleConverter) convertDDL(stmt *DDL) Statement {
+func (c *OracleConverter) convertDDL(stmt *DDL, meta *metaChange) Statement {
 	switch stmt.Action {
 	case CreateStr:
-		newDmDdl := &DmDDL{}
-		newDmDdl.FromCreateDDL(stmt)
+		return c.convertCreateTable(stmt, meta)
+	case RenameStr:
+		// rename table a to b
+		meta.rename(stmt.Table, stmt.NewName.Name)
+		return &DmAlter{Action: RenameTableStr, Table: stmt.Table, NewTable: stmt.NewName.Name}
+	case DropStr:
+		// 触发器和约束随表删除
+		meta.drop(stmt.Table)
+	}
+	return nil
+}
+
+// convertCreateTable 达梦的建表语句只有列和主键，其它索引、注释和外键转换为建表之后的语句，
+// 记录表的列、主键、唯一索引和自增列
+func (c *OracleConverter) convertCreateTable(stmt *DDL, meta *metaChange) Statement {
+	// create table ... like等没有列定义的语句不转换
+	if stmt.TableSpec == nil {
+		return nil
+	}
+	newDmDdl := &DmDDL{}
+	newDmDdl.FromCreateDDL(stmt)
+	table := stmt.NewName
+	columns := make([]string, 0, len(stmt.TableSpec.Columns))
+	for _, col := range stmt.TableSpec.Columns {
+		columns = append(columns, col.Name.String())
+	}
+	t := meta.create(table, columns)
+	stmts := Statements{newDmDdl}
+	for i, col := range stmt.TableSpec.Columns {
+		if col.Type.Autoincrement {
+			t.setIncrementColumn(col.Name, i)
+		}
+		if idx := columnKeyIndex(col); idx != nil {
+			stmts = t.addIndex(stmts, table, idx)
+		}
+	}
+	for _, idx := range stmt.TableSpec.Indexes {
+		stmts = t.addIndex(stmts, table, idx)
+	}
+	if stmt.TableSpec.Comment != nil {
+		stmts = append(stmts, &DmAlter{Action: CommentTableStr, Table: table, Comment: stmt.TableSpec.Comment})
+	}
+	for _, col := range stmt.TableSpec.Columns {
+		if col.Type.Comment != nil {
+			stmts = append(stmts, &DmAlter{Action: CommentColumnStr, Table: table, Name: col.Name, Comment: col.Type.Comment})
+		}
+	}
+	for _, fk := range stmt.TableSpec.ForeignKeys {
+		stmts = append(stmts, &DmAlter{Action: AddForeignKeyStr, Table: table, ForeignKey: fk})
+	}
+	for _, col := range stmt.TableSpec.Columns {
+		if col.Type.OnUpdate != nil {
+			stmts = append(stmts, t.onUpdateTrigger(table, col.Name))
+		}
+	}
+	for _, col := range newDmDdl.TableSpec.Columns {
+		if !col.Check.IsEmpty() {
+			t.setEnumColumn(col.Name, EnumColumn{Type: col.Type.Type, Check: col.Check.String()})
+		}
+	}
+	if len(stmts) == 1 {
 		return newDmDdl
-	case AlterStr:
+	}
+	return stmts
+}
+
+// addIndex 记录主键和唯一索引，主键在建表语句中，其它索引转换为create index
+func (t *tableMeta) addIndex(stmts Statements, table TableName, idx *IndexDefinition) Statements {
+	if !idx.Info.Primary {
+		dmIndexName(table, idx)
+		stmts = append(stmts, &DmAlter{Action: CreateIndexStr, Table: table, Index: idx})
+	}
+	t.setKeyIndex(idx)
+	return stmts
+}
+
+// columnKeyIndex 返回列定义中的primary key或unique对应的索引，达梦的建表语句只保留主键
+func columnKeyIndex(col *ColumnDefinition) *IndexDefinition {
+	info := &IndexInfo{}
+	switch col.Type.KeyOpt {
+	case colKeyPrimary:
+		info.Type, info.Primary = "primary key", true
+	case colKeyUnique, colKeyUniqueKey:
+		info.Type, info.Unique = "unique key", true
+	default:
 		return nil
 	}
-	return nil
+	return &IndexDefinition{Info: info, Columns: []*IndexColumn{{Column: col.Name}}}
 }
 
 func (c *OracleConverter) covertUse(stmt *Use) Statement {
@@ -495,31 +1401,3 @@ func supportConvert(sqlType int) bool {
 		return false
 	}
 }
-
-func SplitFk(sql string) (string, []string) {
-	trimmed := StripLeadingComments(sql)
-
-	firstWord := trimmed
-	if end := strings.IndexFunc(trimmed, unicode.IsSpace); end != -1 {
-		firstWord = trimmed[:end]
-	}
-	firstWord = strings.TrimLeftFunc(firstWord, func(r rune) bool { return !unicode.IsLetter(r) })
-	// Comparison is done in order of priority.
-	loweredFirstWord := strings.ToLower(firstWord)
-	if loweredFirstWord != "create" {
-		return sql, nil
-	}
-	lists := strings.Split(sql, "\n")
-	var fks []string
-	for i, v := range lists {
-		if strings.Contains(v, "CONSTRAINT") || strings.Contains(v, "FOREIGN KEY") || strings.Contains(v, "constraint") || strings.Contains(v, "foreign key") {
-			lists = append(lists[:i], lists[i+1:]...)
-			fks = append(fks, v)
-		}
-	}
-
-	lists[len(lists)-2] = strings.TrimRight(lists[len(lists)-2], ",")
-	sql = strings.Join(lists, "\n")
-
-	return sql, fks
-}
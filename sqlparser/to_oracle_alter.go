@@ -0,0 +1,412 @@
+package sqlparser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// alterConverter converts the clauses of an ALTER TABLE statement.
+type alterConverter struct {
+	c     *OracleConverter
+	sql   string
+	table TableName
+	stmts Statements
+
+	// 修改的表的元数据，执行成功之后替换converter中的
+	metaChange *metaChange
+	meta       *tableMeta
+	// 列或on update列改变时需要重建表的触发器
+	columnsChanged  bool
+	triggersChanged bool
+}
+
+// convertAlter converts ALTER TABLE into DM statements, one for each clause
+// in most cases. It returns false if sql is not ALTER TABLE.
+func (c *OracleConverter) convertAlter(sql string, meta *metaChange) (Statements, bool, error) {
+	toks, err := scanDDLTokens(sql)
+	if err != nil || len(toks) < 3 || !toks[0].is("alter") {
+		return nil, false, nil
+	}
+	toks = toks[1:]
+	if toks[0].is("ignore") {
+		toks = toks[1:]
+	}
+	if len(toks) < 2 || !toks[0].is("table") {
+		return nil, false, nil
+	}
+	ac := &alterConverter{c: c, sql: sql, metaChange: meta}
+	ac.table, toks = ddlTableName(toks[1:])
+	if len(toks) == 0 {
+		return nil, true, fmt.Errorf("alter table %s without clauses", ac.table.Name)
+	}
+	ac.meta = meta.table(ac.table)
+	for _, spec := range splitDDLTokens(toks) {
+		if len(spec) == 0 {
+			return nil, true, fmt.Errorf("syntax error in alter table %s", ac.table.Name)
+		}
+		if err := ac.convertSpec(spec); err != nil {
+			return nil, true, err
+		}
+	}
+	ac.recreateTriggers()
+	return ac.stmts, true, nil
+}
+
+// recreateTriggers 触发器比较表中其它的列，列改变之后在最后重建表的所有触发器
+func (ac *alterConverter) recreateTriggers() {
+	if !ac.columnsChanged && !ac.triggersChanged {
+		return
+	}
+	for _, column := range ac.meta.triggerColumns() {
+		ac.stmts = append(ac.stmts, ac.meta.buildOnUpdateTrigger(ac.table, column))
+	}
+}
+
+// addColumn 记录新增的列，已有的列不变
+func (ac *alterConverter) addColumn(column ColIdent) {
+	if ac.meta.columns == nil {
+		return
+	}
+	for _, name := range ac.meta.columns {
+		if column.EqualString(name) {
+			return
+		}
+	}
+	ac.meta.columns = append(ac.meta.columns, column.String())
+	ac.columnsChanged = true
+}
+
+// removeColumn 删除或重命名列，重命名时to不为空
+func (ac *alterConverter) removeColumn(from, to ColIdent) {
+	if ac.meta.columns == nil {
+		return
+	}
+	columns := ac.meta.columns[:0]
+	for _, name := range ac.meta.columns {
+		switch {
+		case !from.EqualString(name):
+			columns = append(columns, name)
+		case !to.IsEmpty():
+			columns = append(columns, to.String())
+		}
+	}
+	ac.meta.columns = columns
+	ac.columnsChanged = true
+}
+
+func (ac *alterConverter) text(toks []ddlToken) string {
+	return ac.sql[toks[0].pos:toks[len(toks)-1].end]
+}
+
+func (ac *alterConverter) add(stmt *DmAlter) {
+	stmt.Table = ac.table
+	ac.stmts = append(ac.stmts, stmt)
+}
+
+// addSpec 无法转换的子句只转换标识符和字符串，原样发送
+func (ac *alterConverter) addSpec(toks []ddlToken) {
+	ac.add(&DmAlter{Action: AlterSpecStr, Spec: oracleRawSQL(ac.text(toks))})
+}
+
+func (ac *alterConverter) convertSpec(toks []ddlToken) error {
+	word, rest := toks[0], toks[1:]
+	switch {
+	case word.is("add"):
+		return ac.convertAdd(toks, rest)
+	case word.is("drop"):
+		return ac.convertDrop(toks, rest)
+	case word.is("modify"):
+		if len(rest) > 0 && rest[0].is("column") {
+			rest = rest[1:]
+		}
+		return ac.convertColumn(ModifyColumnStr, rest)
+	case word.is("change"):
+		if len(rest) > 0 && rest[0].is("column") {
+			rest = rest[1:]
+		}
+		if len(rest) < 3 {
+			return fmt.Errorf("syntax error near %s", ac.text(toks))
+		}
+		if !strings.EqualFold(rest[0].val, rest[1].val) {
+			ac.renameColumn(NewColIdent(rest[0].val), NewColIdent(rest[1].val), false)
+		}
+		return ac.convertColumn(ModifyColumnStr, rest[1:])
+	case word.is("rename"):
+		return ac.convertRename(toks, rest)
+	case word.is("alter"):
+		return ac.convertAlterColumn(toks, rest)
+	case word.is("engine", "auto_increment", "default", "character", "charset", "collate", "comment",
+		"row_format", "convert", "algorithm", "lock", "key_block_size", "checksum", "pack_keys",
+		"stats_persistent", "stats_auto_recalc", "stats_sample_pages", "force"):
+		ac.convertTableOptions(toks)
+	default:
+		ac.addSpec(toks)
+	}
+	return nil
+}
+
+func (ac *alterConverter) convertAdd(toks, rest []ddlToken) error {
+	if len(rest) == 0 {
+		return fmt.Errorf("syntax error near %s", ac.text(toks))
+	}
+	if rest[0].is("column") {
+		return ac.convertAddColumns(rest[1:])
+	}
+	if isKeyDefinition(rest) {
+		return ac.convertAddIndex(toks, rest)
+	}
+	if rest[0].is("partition") {
+		ac.addSpec(toks)
+		return nil
+	}
+	return ac.convertAddColumns(rest)
+}
+
+// convertAddColumns 支持add column c int和add column (c1 int, c2 int)
+func (ac *alterConverter) convertAddColumns(toks []ddlToken) error {
+	if len(toks) > 2 && toks[0].typ == '(' && toks[len(toks)-1].typ == ')' {
+		for _, col := range splitDDLTokens(toks[1 : len(toks)-1]) {
+			if err := ac.convertColumn(AddColumnStr, col); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return ac.convertColumn(AddColumnStr, toks)
+}
+
+// convertColumn 借助create table解析列定义，达梦不支持first和after，忽略列的位置
+func (ac *alterConverter) convertColumn(action string, toks []ddlToken) error {
+	if n := len(toks); n > 1 && toks[n-1].is("first") {
+		toks = toks[:n-1]
+	} else if n > 2 && toks[n-2].is("after") {
+		toks = toks[:n-2]
+	}
+	if len(toks) < 2 {
+		return fmt.Errorf("invalid column definition in alter table %s", ac.table.Name)
+	}
+	def := ac.text(toks)
+	stmt, err := Parse("create table t (" + def + ")")
+	if err != nil {
+		return fmt.Errorf("invalid column definition %s: %v", def, err)
+	}
+	ddl, ok := stmt.(*DDL)
+	if !ok || ddl.TableSpec == nil || len(ddl.TableSpec.Columns) != 1 {
+		return fmt.Errorf("invalid column definition %s", def)
+	}
+	mysqlCol := ddl.TableSpec.Columns[0]
+	col := NewDmColumnDefinition(mysqlCol, "")
+	// 达梦的列注释需要单独的comment语句
+	comment := col.Type.Comment
+	col.Type.Comment = nil
+	// 先删除原来enum或set的约束，修改列之后再添加新的约束
+	if old, ok := ac.meta.dropEnumColumn(col.Name); ok {
+		ac.add(&DmAlter{Action: DropConstraintStr, Name: NewColIdent(old.Check)})
+	}
+	ac.add(&DmAlter{Action: action, Column: col})
+	if action == AddColumnStr {
+		ac.addColumn(col.Name)
+	}
+	ac.convertColumnKeys(mysqlCol)
+	check := *col
+	if check.setEnumCheck(ac.table); !check.Check.IsEmpty() {
+		ac.stmts = append(ac.stmts, ac.meta.enumCheck(ac.table, &check))
+	}
+	if comment != nil {
+		ac.add(&DmAlter{Action: CommentColumnStr, Name: col.Name, Comment: comment})
+	}
+	switch {
+	case mysqlCol.Type.OnUpdate != nil:
+		ac.meta.setOnUpdateTrigger(col.Name)
+		ac.triggersChanged = true
+	case action == ModifyColumnStr:
+		// 修改后的列没有on update，不在缓存中的时间列也可能有之前生成的触发器
+		triggered := ac.meta.dropOnUpdateColumn(col.Name)
+		if triggered || mysqlCol.Type.Type == "timestamp" || mysqlCol.Type.Type == "datetime" {
+			ac.dropTrigger(col.Name)
+		}
+	}
+	return nil
+}
+
+// convertColumnKeys 记录列的自增和主键，列定义中的unique转换为create unique index，
+// 达梦修改列时不去掉列的IDENTITY，没有auto_increment时自增列不变
+func (ac *alterConverter) convertColumnKeys(col *ColumnDefinition) {
+	if col.Type.Autoincrement {
+		pos := 0
+		for i, name := range ac.meta.columns {
+			if col.Name.EqualString(name) {
+				pos = i
+			}
+		}
+		ac.meta.setIncrementColumn(col.Name, pos)
+	}
+	idx := columnKeyIndex(col)
+	if idx == nil {
+		return
+	}
+	if !idx.Info.Primary {
+		dmIndexName(ac.table, idx)
+		ac.add(&DmAlter{Action: CreateIndexStr, Index: idx})
+	}
+	ac.meta.setKeyIndex(idx)
+}
+
+func (ac *alterConverter) dropTrigger(column ColIdent) {
+	ac.stmts = append(ac.stmts, &DmTrigger{Action: DropStr, Table: ac.table, Column: column})
+}
+
+// renameColumn 触发器中引用了列名，重命名列时删除列的触发器，在最后按新的列名重建，
+// change由之后的modify决定是否重建
+func (ac *alterConverter) renameColumn(from, to ColIdent, recreate bool) {
+	if enum, ok := ac.meta.dropEnumColumn(from); ok {
+		ac.meta.setEnumColumn(to, enum)
+	}
+	triggered := ac.meta.dropOnUpdateColumn(from)
+	if triggered {
+		ac.dropTrigger(from)
+	}
+	ac.add(&DmAlter{Action: RenameColumnStr, Name: from, NewName: to})
+	ac.removeColumn(from, to)
+	ac.meta.renameKeyColumn(from, to)
+	if triggered && recreate {
+		ac.meta.setOnUpdateTrigger(to)
+		ac.triggersChanged = true
+	}
+}
+
+// convertAddIndex 普通索引和唯一索引转为create index，主键和外键转为alter table add
+func (ac *alterConverter) convertAddIndex(toks, rest []ddlToken) error {
+	idx, fk, err := parseKeyDefinition(rest)
+	switch {
+	case err != nil:
+		return fmt.Errorf("%v: %s", err, ac.text(toks))
+	case fk != nil:
+		ac.add(&DmAlter{Action: AddForeignKeyStr, ForeignKey: fk})
+	case idx == nil:
+		ac.addSpec(toks)
+	case idx.Info.Primary:
+		ac.add(&DmAlter{Action: AddPrimaryKeyStr, Index: idx})
+		ac.meta.setKeyIndex(idx)
+	default:
+		dmIndexName(ac.table, idx)
+		ac.add(&DmAlter{Action: CreateIndexStr, Index: idx})
+		ac.meta.setKeyIndex(idx)
+	}
+	return nil
+}
+
+func (ac *alterConverter) convertDrop(toks, rest []ddlToken) error {
+	if len(rest) == 0 {
+		return fmt.Errorf("syntax error near %s", ac.text(toks))
+	}
+	switch {
+	case rest[0].is("primary"):
+		ac.add(&DmAlter{Action: DropPrimaryKeyStr})
+		ac.meta.dropUniqueIndex(PrimaryIndexName)
+	case rest[0].is("index", "key") && len(rest) > 1:
+		ac.add(&DmAlter{Action: DropIndexStr, Name: NewColIdent(rest[1].val)})
+		ac.meta.dropUniqueIndex(rest[1].val)
+	case rest[0].is("foreign") && len(rest) > 2:
+		ac.add(&DmAlter{Action: DropConstraintStr, Name: NewColIdent(rest[2].val)})
+	case rest[0].is("constraint", "check") && len(rest) > 1:
+		ac.add(&DmAlter{Action: DropConstraintStr, Name: NewColIdent(rest[1].val)})
+		ac.meta.dropUniqueIndex(rest[1].val)
+	case rest[0].is("column") && len(rest) > 1:
+		ac.dropColumn(NewColIdent(rest[1].val))
+	case rest[0].is("partition", "index", "key", "foreign", "constraint", "check", "column"):
+		ac.addSpec(toks)
+	default:
+		ac.dropColumn(NewColIdent(rest[0].val))
+	}
+	return nil
+}
+
+func (ac *alterConverter) dropColumn(column ColIdent) {
+	if ac.meta.dropOnUpdateColumn(column) {
+		ac.dropTrigger(column)
+	}
+	if enum, ok := ac.meta.dropEnumColumn(column); ok {
+		ac.add(&DmAlter{Action: DropConstraintStr, Name: NewColIdent(enum.Check)})
+	}
+	ac.add(&DmAlter{Action: DropColumnStr, Name: column})
+	ac.removeColumn(column, ColIdent{})
+	ac.meta.dropKeyColumn(column)
+}
+
+func (ac *alterConverter) convertRename(toks, rest []ddlToken) error {
+	switch {
+	case len(rest) == 4 && rest[0].is("column") && rest[2].is("to"):
+		ac.renameColumn(NewColIdent(rest[1].val), NewColIdent(rest[3].val), true)
+	case len(rest) == 4 && rest[0].is("index", "key") && rest[2].is("to"):
+		ac.add(&DmAlter{Action: RenameIndexStr, Name: NewColIdent(rest[1].val), NewName: NewColIdent(rest[3].val)})
+		ac.meta.renameUniqueIndex(rest[1].val, rest[3].val)
+	default:
+		if len(rest) > 0 && rest[0].is("to", "as") {
+			rest = rest[1:]
+		}
+		if len(rest) == 0 {
+			return fmt.Errorf("syntax error near %s", ac.text(toks))
+		}
+		// 达梦重命名表时不能指定模式
+		name, left := ddlTableName(rest)
+		if len(left) != 0 {
+			return fmt.Errorf("syntax error near %s", ac.text(toks))
+		}
+		ac.metaChange.rename(ac.table, name.Name)
+		ac.add(&DmAlter{Action: RenameTableStr, NewTable: name.Name})
+	}
+	return nil
+}
+
+// convertAlterColumn 转换alter column c set default v和alter column c drop default
+func (ac *alterConverter) convertAlterColumn(toks, rest []ddlToken) error {
+	if len(rest) > 0 && rest[0].is("column") {
+		rest = rest[1:]
+	}
+	if len(rest) < 3 || !rest[2].is("default") {
+		ac.addSpec(toks)
+		return nil
+	}
+	name := NewColIdent(rest[0].val)
+	switch {
+	case rest[1].is("drop") && len(rest) == 3:
+		ac.add(&DmAlter{Action: ColumnDefaultStr, Name: name, Default: &NullVal{}})
+	case rest[1].is("set") && len(rest) > 3:
+		def := ac.text(rest[3:])
+		stmt, err := Parse("select " + def)
+		if err != nil {
+			return fmt.Errorf("invalid default %s: %v", def, err)
+		}
+		sel, ok := stmt.(*Select)
+		if !ok || len(sel.SelectExprs) != 1 {
+			return fmt.Errorf("invalid default %s", def)
+		}
+		expr, ok := sel.SelectExprs[0].(*AliasedExpr)
+		if !ok {
+			return fmt.Errorf("invalid default %s", def)
+		}
+		RewriteExprs(expr, ac.c.convertExpr)
+		ac.add(&DmAlter{Action: ColumnDefaultStr, Name: name, Default: expr.Expr})
+	default:
+		ac.addSpec(toks)
+	}
+	return nil
+}
+
+// convertTableOptions 达梦没有存储引擎和字符集等表选项，只保留表注释
+func (ac *alterConverter) convertTableOptions(toks []ddlToken) {
+	for i := 0; i < len(toks)-1; i++ {
+		if !toks[i].is("comment") {
+			continue
+		}
+		val := toks[i+1]
+		if val.typ == '=' && i+2 < len(toks) {
+			val = toks[i+2]
+		}
+		if val.typ == STRING {
+			ac.add(&DmAlter{Action: CommentTableStr, Comment: NewStrVal([]byte(val.val))})
+		}
+		return
+	}
+}
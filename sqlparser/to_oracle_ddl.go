@@ -0,0 +1,336 @@
+package sqlparser
+
+import (
+	"fmt"
+	"strings"
+
+	"sqlproxy/core/golog"
+)
+
+// 语法解析器不支持的DDL部分（ALTER TABLE的子句、CREATE TABLE中的键和外键）
+// 从SQL文本中按词法单元解析
+
+// ddlToken is a token of a DDL statement, pos and end are its offsets in the
+// SQL.
+type ddlToken struct {
+	typ      int
+	val      string
+	pos, end int
+	quoted   bool // 反引号括起的标识符
+}
+
+// is reports whether the token is one of the words, case-insensitively.
+func (t ddlToken) is(words ...string) bool {
+	if t.quoted || t.typ == STRING {
+		return false
+	}
+	for _, word := range words {
+		if strings.EqualFold(t.val, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func scanDDLTokens(sql string) ([]ddlToken, error) {
+	var toks []ddlToken
+	tkn := NewStringTokenizer(sql)
+	tkn.next()
+	for {
+		tkn.skipBlank()
+		pos := tkn.Position - 1
+		typ, val := tkn.Scan()
+		switch typ {
+		case 0:
+			return toks, nil
+		case LEX_ERROR:
+			return nil, fmt.Errorf("syntax error at position %d", tkn.Position)
+		case COMMENT:
+			continue
+		}
+		toks = append(toks, ddlToken{
+			typ:    typ,
+			val:    string(val),
+			pos:    pos,
+			end:    tkn.Position - 1,
+			quoted: typ == ID && sql[pos] == '`',
+		})
+	}
+}
+
+// splitDDLTokens 按不在括号中的逗号分割
+func splitDDLTokens(toks []ddlToken) [][]ddlToken {
+	var (
+		parts [][]ddlToken
+		depth int
+		start int
+	)
+	for i, t := range toks {
+		switch t.typ {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, toks[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, toks[start:])
+}
+
+// ddlTableName 解析[db.]table，返回其后的词法单元
+func ddlTableName(toks []ddlToken) (TableName, []ddlToken) {
+	if len(toks) >= 3 && toks[1].typ == '.' {
+		return TableName{Qualifier: NewTableIdent(toks[0].val), Name: NewTableIdent(toks[2].val)}, toks[3:]
+	}
+	return TableName{Name: NewTableIdent(toks[0].val)}, toks[1:]
+}
+
+// ddlParens 返回以左括号开始的括号中的词法单元和括号之后的词法单元
+func ddlParens(toks []ddlToken) ([]ddlToken, []ddlToken, bool) {
+	if len(toks) == 0 || toks[0].typ != '(' {
+		return nil, nil, false
+	}
+	depth := 0
+	for i, t := range toks {
+		switch t.typ {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return toks[1:i], toks[i+1:], true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// ddlColumns 解析(a, b)，索引中的列可以有前缀长度和排序
+func ddlColumns(toks []ddlToken) ([]*IndexColumn, []ddlToken, bool) {
+	inner, rest, ok := ddlParens(toks)
+	if !ok {
+		return nil, nil, false
+	}
+	var cols []*IndexColumn
+	for _, col := range splitDDLTokens(inner) {
+		if len(col) == 0 {
+			return nil, nil, false
+		}
+		ic := &IndexColumn{Column: NewColIdent(col[0].val)}
+		if len(col) >= 4 && col[1].typ == '(' && col[2].typ == INTEGRAL {
+			ic.Length = NewIntVal([]byte(col[2].val))
+		}
+		cols = append(cols, ic)
+	}
+	return cols, rest, true
+}
+
+// isKeyDefinition reports whether the definition of CREATE TABLE or ALTER
+// TABLE ADD is a key, a foreign key or a check instead of a column.
+func isKeyDefinition(toks []ddlToken) bool {
+	return len(toks) > 0 && toks[0].is("primary", "unique", "index", "key", "constraint",
+		"foreign", "fulltext", "spatial", "check")
+}
+
+// parseKeyDefinition parses a key or a foreign key. It returns nil for the
+// definitions DM does not support such as FULLTEXT, SPATIAL and CHECK.
+func parseKeyDefinition(toks []ddlToken) (*IndexDefinition, *ForeignKeyDefinition, error) {
+	errSyntax := fmt.Errorf("invalid key definition")
+	var constraint ColIdent
+	if len(toks) > 0 && toks[0].is("constraint") {
+		toks = toks[1:]
+		if len(toks) > 0 && !toks[0].is("primary", "unique", "foreign", "check") {
+			constraint = NewColIdent(toks[0].val)
+			toks = toks[1:]
+		}
+	}
+	if len(toks) == 0 {
+		return nil, nil, errSyntax
+	}
+
+	info := &IndexInfo{}
+	switch {
+	case toks[0].is("foreign"):
+		return parseForeignKey(constraint, toks)
+	case toks[0].is("primary"):
+		if len(toks) < 2 || !toks[1].is("key") {
+			return nil, nil, errSyntax
+		}
+		info.Type = "primary key"
+		info.Name = NewColIdent("PRIMARY")
+		info.Primary = true
+		info.Unique = true
+		toks = toks[2:]
+	case toks[0].is("unique"):
+		info.Type = "unique key"
+		info.Unique = true
+		toks = toks[1:]
+		if len(toks) > 0 && toks[0].is("index", "key") {
+			toks = toks[1:]
+		}
+	case toks[0].is("index", "key"):
+		info.Type = "key"
+		toks = toks[1:]
+	default:
+		return nil, nil, nil
+	}
+	if !info.Primary && len(toks) > 0 && toks[0].typ != '(' && !toks[0].is("using") {
+		info.Name = NewColIdent(toks[0].val)
+		toks = toks[1:]
+	}
+	if info.Name.IsEmpty() {
+		info.Name = constraint
+	}
+	if len(toks) > 1 && toks[0].is("using") {
+		toks = toks[2:]
+	}
+	cols, _, ok := ddlColumns(toks)
+	if !ok {
+		return nil, nil, errSyntax
+	}
+	return &IndexDefinition{Info: info, Columns: cols}, nil, nil
+}
+
+// parseForeignKey 解析foreign key [name] (cols) references t (cols) [on delete ...] [on update ...]
+func parseForeignKey(name ColIdent, toks []ddlToken) (*IndexDefinition, *ForeignKeyDefinition, error) {
+	errSyntax := fmt.Errorf("invalid foreign key definition")
+	if len(toks) < 2 || !toks[1].is("key") {
+		return nil, nil, errSyntax
+	}
+	toks = toks[2:]
+	if len(toks) > 0 && toks[0].typ != '(' {
+		if name.IsEmpty() {
+			name = NewColIdent(toks[0].val)
+		}
+		toks = toks[1:]
+	}
+	fk := &ForeignKeyDefinition{Name: name}
+	cols, toks, ok := ddlColumns(toks)
+	if !ok || len(toks) < 2 || !toks[0].is("references") {
+		return nil, nil, errSyntax
+	}
+	for _, col := range cols {
+		fk.Columns = append(fk.Columns, col.Column)
+	}
+	fk.RefTable, toks = ddlTableName(toks[1:])
+	if cols, toks, ok = ddlColumns(toks); !ok {
+		return nil, nil, errSyntax
+	}
+	for _, col := range cols {
+		fk.RefColumns = append(fk.RefColumns, col.Column)
+	}
+	for len(toks) > 2 && toks[0].is("on") {
+		// restrict、cascade、set null、no action
+		n := 3
+		if toks[2].is("set", "no") && len(toks) > 3 {
+			n = 4
+		}
+		action := strings.ToLower(tokensText(toks[2:n]))
+		switch {
+		case toks[1].is("delete"):
+			fk.OnDelete = action
+		case toks[1].is("update"):
+			fk.OnUpdate = action
+		default:
+			return nil, nil, errSyntax
+		}
+		toks = toks[n:]
+	}
+	return nil, fk, nil
+}
+
+func tokensText(toks []ddlToken) string {
+	words := make([]string, 0, len(toks))
+	for _, t := range toks {
+		words = append(words, t.val)
+	}
+	return strings.Join(words, " ")
+}
+
+// splitTableKeys removes the keys and the foreign keys from CREATE TABLE,
+// which the grammar does not fully support, and returns them parsed with the
+// table comment. sql is returned unchanged if it is not CREATE TABLE.
+func splitTableKeys(sql string) (string, *TableSpec, error) {
+	toks, err := scanDDLTokens(sql)
+	if err != nil || len(toks) < 3 || !toks[0].is("create") {
+		return sql, nil, nil
+	}
+	toks = toks[1:]
+	if toks[0].is("temporary") {
+		toks = toks[1:]
+	}
+	if len(toks) < 2 || !toks[0].is("table") {
+		return sql, nil, nil
+	}
+	toks = toks[1:]
+	if len(toks) > 3 && toks[0].is("if") && toks[1].is("not") && toks[2].is("exists") {
+		toks = toks[3:]
+	}
+	_, toks = ddlTableName(toks)
+	body, options, ok := ddlParens(toks)
+	if !ok || len(body) == 0 {
+		return sql, nil, nil
+	}
+
+	keys := &TableSpec{}
+	var columns []string
+	for _, def := range splitDDLTokens(body) {
+		if len(def) == 0 {
+			return sql, nil, fmt.Errorf("syntax error at position %d", body[0].pos)
+		}
+		text := sql[def[0].pos:def[len(def)-1].end]
+		if !isKeyDefinition(def) {
+			columns = append(columns, text)
+			continue
+		}
+		idx, fk, err := parseKeyDefinition(def)
+		switch {
+		case err != nil:
+			return sql, nil, fmt.Errorf("%v: %s", err, text)
+		case idx != nil:
+			keys.AddIndex(idx)
+		case fk != nil:
+			keys.ForeignKeys = append(keys.ForeignKeys, fk)
+		default:
+			golog.Warn("OracleConverter", "splitTableKeys", "unsupported key is ignored", 0, "key", text)
+		}
+	}
+	for i, t := range options {
+		if t.is("comment") && i+1 < len(options) {
+			val := options[i+1]
+			if val.typ == '=' && i+2 < len(options) {
+				val = options[i+2]
+			}
+			if val.typ == STRING {
+				keys.Comment = NewStrVal([]byte(val.val))
+			}
+		}
+	}
+
+	start, end := body[0].pos, body[len(body)-1].end
+	return sql[:start] + strings.Join(columns, ",\n  ") + sql[end:], keys, nil
+}
+
+// mergeTableKeys adds the keys returned by splitTableKeys to the parsed
+// CREATE TABLE.
+func mergeTableKeys(stmt Statement, keys *TableSpec) {
+	ddl, ok := stmt.(*DDL)
+	if !ok || ddl.TableSpec == nil || keys == nil {
+		return
+	}
+	for _, idx := range keys.Indexes {
+		ddl.TableSpec.AddIndex(idx)
+	}
+	ddl.TableSpec.ForeignKeys = keys.ForeignKeys
+	ddl.TableSpec.Comment = keys.Comment
+}
+
+// dmIndexName 达梦的索引名在模式内唯一，没有名字的索引按表名和第一列命名
+func dmIndexName(table TableName, idx *IndexDefinition) {
+	if idx.Info.Name.IsEmpty() && len(idx.Columns) > 0 {
+		idx.Info.Name = NewColIdent(table.Name.String() + "_" + idx.Columns[0].Column.String())
+	}
+}
@@ -0,0 +1,58 @@
+package sqlparser
+
+import "strings"
+
+// 达梦没有enum和set，转换为varchar和check约束，记录这些列的原始类型，
+// 结果集的列信息中返回ENUM_FLAG和SET_FLAG
+
+// EnumColumn is a column converted from ENUM or SET.
+type EnumColumn struct {
+	Type  string // enum或set
+	Check string // check约束的名字
+}
+
+// SetEnumColumn records a column converted from ENUM or SET, for example a
+// column loaded from the check constraints of DM when the proxy starts.
+func (c *OracleConverter) SetEnumColumn(table, column string, enum EnumColumn) {
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+	c.putEnumColumn(table, column, enum)
+}
+
+// LookupEnumColumn returns the ENUM or SET definition of a column.
+func (c *OracleConverter) LookupEnumColumn(table, column string) (EnumColumn, bool) {
+	c.metaMu.RLock()
+	defer c.metaMu.RUnlock()
+	enum, ok := c.enumColumns[table][strings.ToLower(column)]
+	return enum, ok
+}
+
+func (c *OracleConverter) putEnumColumn(table, column string, enum EnumColumn) {
+	if c.enumColumns == nil {
+		c.enumColumns = make(map[string]map[string]EnumColumn)
+	}
+	if c.enumColumns[table] == nil {
+		c.enumColumns[table] = make(map[string]EnumColumn)
+	}
+	c.enumColumns[table][strings.ToLower(column)] = enum
+}
+
+// enumCheck 记录转换后的列，返回单独添加check约束的语句
+func (t *tableMeta) enumCheck(table TableName, col *DmColumnDefinition) *DmAlter {
+	t.setEnumColumn(col.Name, EnumColumn{Type: col.Type.Type, Check: col.Check.String()})
+	return &DmAlter{Action: AddCheckStr, Table: table, Column: col}
+}
+
+func (t *tableMeta) setEnumColumn(column ColIdent, enum EnumColumn) {
+	if t.enums == nil {
+		t.enums = make(map[string]EnumColumn)
+	}
+	t.enums[column.Lowered()] = enum
+}
+
+// dropEnumColumn 列不再是enum或set，返回之前的定义
+func (t *tableMeta) dropEnumColumn(column ColIdent) (EnumColumn, bool) {
+	enum, ok := t.enums[column.Lowered()]
+	delete(t.enums, column.Lowered())
+	return enum, ok
+}
@@ -0,0 +1,819 @@
+package sqlparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var oracleFuncsMutex sync.RWMutex
+
+// oracleFuncs 按函数名（小写）转换MySQL函数，返回nil表示不转换
+var oracleFuncs = map[string]func(*FuncExpr) Expr{
+	"if":                convertIf,
+	"ifnull":            convertIfNull,
+	"isnull":            convertIsNull,
+	"nullif":            convertNullIf,
+	"concat":            convertConcat,
+	"concat_ws":         convertConcatWs,
+	"date_format":       convertDateFormat,
+	"str_to_date":       convertStrToDate,
+	"unix_timestamp":    convertUnixTimestamp,
+	"from_unixtime":     convertFromUnixtime,
+	"date_add":          convertDateAdd,
+	"adddate":           convertDateAdd,
+	"date_sub":          convertDateSub,
+	"subdate":           convertDateSub,
+	"timestampdiff":     convertTimestampDiff,
+	"datediff":          convertDateDiff,
+	"now":               convertNow,
+	"current_timestamp": convertNow,
+	"localtime":         convertNow,
+	"localtimestamp":    convertNow,
+	"sysdate":           convertNow,
+	"curdate":           convertCurDate,
+	"current_date":      convertCurDate,
+	"curtime":           convertCurTime,
+	"current_time":      convertCurTime,
+	"utc_timestamp":     convertUTCTimestamp,
+	"utc_date":          convertUTCDate,
+}
+
+// RegisterOracleFunc registers the conversion of the MySQL function name for
+// DM/Oracle, it replaces the builtin one of the same name. convert receives
+// the function with its arguments already converted and returns nil to keep
+// the function unchanged.
+func RegisterOracleFunc(name string, convert func(*FuncExpr) Expr) {
+	oracleFuncsMutex.Lock()
+	defer oracleFuncsMutex.Unlock()
+	oracleFuncs[strings.ToLower(name)] = convert
+}
+
+// convertFuncs 转换DML语句中的MySQL函数
+func (c *OracleConverter) convertFuncs(stmt Statement) {
+	switch node := stmt.(type) {
+	case Statements:
+		for _, s := range node {
+			c.convertFuncs(s)
+		}
+	case SelectStatement, *Insert, *Update, *Delete, *Merge, *DmResultQuery:
+		_ = Walk(func(node SQLNode) (kcontinue bool, err error) {
+			if sel, ok := node.(*Select); ok {
+				distinctGroupConcat(sel)
+			}
+			return true, nil
+		}, stmt)
+		RewriteExprs(stmt, c.convertExpr)
+	}
+}
+
+func (c *OracleConverter) convertExpr(expr Expr) Expr {
+	switch node := expr.(type) {
+	case *FuncExpr:
+		if !node.Qualifier.IsEmpty() {
+			return nil
+		}
+		oracleFuncsMutex.RLock()
+		convert, ok := oracleFuncs[node.Name.Lowered()]
+		oracleFuncsMutex.RUnlock()
+		if ok {
+			return convert(node)
+		}
+	case *GroupConcatExpr:
+		return convertGroupConcat(node)
+	case *BinaryExpr:
+		// d + interval n unit, interval n unit + d, d - interval n unit
+		if interval, ok := node.Right.(*IntervalExpr); ok {
+			switch node.Operator {
+			case PlusStr:
+				return addInterval(node.Left, interval, false)
+			case MinusStr:
+				return addInterval(node.Left, interval, true)
+			}
+		}
+		if interval, ok := node.Left.(*IntervalExpr); ok && node.Operator == PlusStr {
+			return addInterval(node.Right, interval, false)
+		}
+	}
+	return nil
+}
+
+// funcArgs 返回函数的参数，参数中有*时返回nil
+func funcArgs(node *FuncExpr) []Expr {
+	args := make([]Expr, 0, len(node.Exprs))
+	for _, expr := range node.Exprs {
+		aliased, ok := expr.(*AliasedExpr)
+		if !ok {
+			return nil
+		}
+		args = append(args, aliased.Expr)
+	}
+	return args
+}
+
+func newFunc(name string, args ...Expr) *FuncExpr {
+	exprs := make(SelectExprs, 0, len(args))
+	for _, arg := range args {
+		exprs = append(exprs, &AliasedExpr{Expr: arg})
+	}
+	return &FuncExpr{Name: NewColIdent(name), Exprs: exprs}
+}
+
+func newStr(s string) *SQLVal {
+	return NewStrVal([]byte(s))
+}
+
+func newInt(i int64) *SQLVal {
+	return NewIntVal([]byte(strconv.FormatInt(i, 10)))
+}
+
+// strArg 返回字符串常量参数的值
+func strArg(expr Expr) (string, bool) {
+	v, ok := expr.(*SQLVal)
+	if !ok || v.Type != StrVal {
+		return "", false
+	}
+	return string(v.Val), true
+}
+
+// paren 给不是单个值或函数的表达式加上括号，用作运算的操作数
+func paren(expr Expr) Expr {
+	switch expr.(type) {
+	case *SQLVal, *ColName, *FuncExpr, *ParenExpr, Pseudocolumn, *CastExpr:
+		return expr
+	}
+	return &ParenExpr{Expr: expr}
+}
+
+// multiply 返回expr * k，expr为整数常量时直接计算
+func multiply(expr Expr, k int64) Expr {
+	if v, ok := expr.(*SQLVal); ok && v.Type == IntVal {
+		if i, err := strconv.ParseInt(string(v.Val), 10, 64); err == nil {
+			return newInt(i * k)
+		}
+	}
+	return &BinaryExpr{Left: paren(expr), Operator: MultStr, Right: newInt(k)}
+}
+
+// negate 返回-expr，expr为整数常量时直接计算
+func negate(expr Expr) Expr {
+	if v, ok := expr.(*SQLVal); ok && v.Type == IntVal {
+		if strings.HasPrefix(string(v.Val), "-") {
+			return NewIntVal(v.Val[1:])
+		}
+		return NewIntVal(append([]byte("-"), v.Val...))
+	}
+	return &UnaryExpr{Operator: UMinusStr, Expr: paren(expr)}
+}
+
+// dateLiteral 把MySQL中可以直接当作时间使用的字符串常量转换为to_date或to_timestamp
+func dateLiteral(expr Expr) Expr {
+	s, ok := strArg(expr)
+	if !ok {
+		return expr
+	}
+	switch {
+	case len(s) == len("2006-01-02"):
+		return newFunc("to_date", expr, newStr("YYYY-MM-DD"))
+	case len(s) == len("2006-01-02 15:04:05"):
+		return newFunc("to_date", expr, newStr("YYYY-MM-DD HH24:MI:SS"))
+	case len(s) > len("2006-01-02 15:04:05"):
+		return newFunc("to_timestamp", expr, newStr("YYYY-MM-DD HH24:MI:SS.FF"))
+	}
+	return expr
+}
+
+// dateExpr 把表达式转换为date类型，两个date相减得到天数，timestamp相减得到的是interval
+func dateExpr(expr Expr) Expr {
+	date := dateLiteral(expr)
+	switch node := date.(type) {
+	case Pseudocolumn:
+		if node == SysdateStr {
+			return date
+		}
+	case *FuncExpr:
+		if node.Name.EqualString("to_date") || node.Name.EqualString("trunc") {
+			return date
+		}
+	}
+	return &CastExpr{Expr: date, Type: "date"}
+}
+
+// mysqlDateFormats MySQL时间格式符对应的Oracle格式，FM切换是否去掉前导零和空格
+var mysqlDateFormats = map[byte]string{
+	'Y': "YYYY",
+	'y': "YY",
+	'm': "MM",
+	'c': "FMMMFM",
+	'd': "DD",
+	'e': "FMDDFM",
+	'H': "HH24",
+	'k': "FMHH24FM",
+	'h': "HH12",
+	'I': "HH12",
+	'l': "FMHH12FM",
+	'i': "MI",
+	's': "SS",
+	'S': "SS",
+	'f': "FF6",
+	'p': "AM",
+	'M': "FMMonthFM",
+	'b': "Mon",
+	'W': "FMDayFM",
+	'a': "Dy",
+	'j': "DDD",
+	'T': "HH24:MI:SS",
+	'r': "HH12:MI:SS AM",
+}
+
+// oracleDateFormat 把MySQL的时间格式转换为Oracle的格式，格式中的文字用双引号括起来，
+// 有不支持的格式符（如%U、%w）时返回false
+func oracleDateFormat(format string) (string, bool) {
+	var (
+		buf     strings.Builder
+		literal strings.Builder
+	)
+	flushLiteral := func() bool {
+		text := literal.String()
+		literal.Reset()
+		if text == "" {
+			return true
+		}
+		if strings.Trim(text, " -/,.;:") == "" {
+			buf.WriteString(text)
+			return true
+		}
+		if strings.Contains(text, `"`) {
+			return false
+		}
+		buf.WriteString(`"` + text + `"`)
+		return true
+	}
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			literal.WriteByte(format[i])
+			continue
+		}
+		i++
+		f, ok := mysqlDateFormats[format[i]]
+		if !ok {
+			if isLetter(uint16(format[i])) {
+				return "", false
+			}
+			literal.WriteByte(format[i])
+			continue
+		}
+		if !flushLiteral() {
+			return "", false
+		}
+		buf.WriteString(f)
+	}
+	if !flushLiteral() {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+// date_format(d, format) -> to_char(d, format)
+func convertDateFormat(node *FuncExpr) Expr {
+	args := funcArgs(node)
+	if len(args) != 2 {
+		return nil
+	}
+	format, ok := strArg(args[1])
+	if !ok {
+		return nil
+	}
+	if format, ok = oracleDateFormat(format); !ok {
+		return nil
+	}
+	return newFunc("to_char", dateLiteral(args[0]), newStr(format))
+}
+
+// str_to_date(s, format) -> to_date(s, format)，有微秒时为to_timestamp
+func convertStrToDate(node *FuncExpr) Expr {
+	args := funcArgs(node)
+	if len(args) != 2 {
+		return nil
+	}
+	format, ok := strArg(args[1])
+	if !ok {
+		return nil
+	}
+	name := "to_date"
+	if strings.Contains(format, "%f") {
+		name = "to_timestamp"
+	}
+	if format, ok = oracleDateFormat(format); !ok {
+		return nil
+	}
+	return newFunc(name, args[0], newStr(format))
+}
+
+func unixEpoch() Expr {
+	return newFunc("to_date", newStr("1970-01-01"), newStr("YYYY-MM-DD"))
+}
+
+// unix_timestamp() -> round((cast(sys_extract_utc(systimestamp) as date) - epoch) * 86400)
+// unix_timestamp(d) -> round((cast(sys_extract_utc(from_tz(cast(d as timestamp), sessiontimezone)) as date) - epoch) * 86400)
+func convertUnixTimestamp(node *FuncExpr) Expr {
+	args := funcArgs(node)
+	var utc Expr
+	switch len(args) {
+	case 0:
+		utc = newFunc("sys_extract_utc", Pseudocolumn(SystimestampStr))
+	case 1:
+		ts := &CastExpr{Expr: dateLiteral(args[0]), Type: "timestamp"}
+		utc = newFunc("sys_extract_utc", newFunc("from_tz", ts, Pseudocolumn(SessiontimezoneStr)))
+	default:
+		return nil
+	}
+	days := &BinaryExpr{Left: &CastExpr{Expr: utc, Type: "date"}, Operator: MinusStr, Right: unixEpoch()}
+	return newFunc("round", &BinaryExpr{Left: paren(days), Operator: MultStr, Right: newInt(86400)})
+}
+
+// from_unixtime(ts) -> cast(from_tz(cast(epoch + numtodsinterval(ts, 'SECOND') as timestamp), 'UTC') at time zone sessiontimezone as date)
+// from_unixtime(ts, format) -> to_char(from_unixtime(ts), format)
+func convertFromUnixtime(node *FuncExpr) Expr {
+	args := funcArgs(node)
+	if len(args) != 1 && len(args) != 2 {
+		return nil
+	}
+	utc := &BinaryExpr{Left: unixEpoch(), Operator: PlusStr, Right: newFunc("numtodsinterval", args[0], newStr("SECOND"))}
+	local := &CastExpr{
+		Expr: &AtTimeZoneExpr{
+			Expr: newFunc("from_tz", &CastExpr{Expr: utc, Type: "timestamp"}, newStr("UTC")),
+			Zone: Pseudocolumn(SessiontimezoneStr),
+		},
+		Type: "date",
+	}
+	if len(args) == 1 {
+		return local
+	}
+	format, ok := strArg(args[1])
+	if !ok {
+		return nil
+	}
+	if format, ok = oracleDateFormat(format); !ok {
+		return nil
+	}
+	return newFunc("to_char", local, newStr(format))
+}
+
+// date_add(d, interval n unit)，adddate(d, n)中n为天数
+func convertDateAdd(node *FuncExpr) Expr {
+	return convertAddDate(node, false)
+}
+
+// date_sub(d, interval n unit)，subdate(d, n)中n为天数
+func convertDateSub(node *FuncExpr) Expr {
+	return convertAddDate(node, true)
+}
+
+func convertAddDate(node *FuncExpr, sub bool) Expr {
+	args := funcArgs(node)
+	if len(args) != 2 {
+		return nil
+	}
+	if interval, ok := args[1].(*IntervalExpr); ok {
+		return addInterval(args[0], interval, sub)
+	}
+	return addInterval(args[0], &IntervalExpr{Expr: args[1], Unit: "day"}, sub)
+}
+
+// addInterval 返回d加上或减去interval：天及以下的单位用numtodsinterval，月、季度、年用add_months，
+// 复合单位（如day_hour）不转换
+func addInterval(date Expr, interval *IntervalExpr, sub bool) Expr {
+	n := interval.Expr
+	var dsUnit string
+	switch strings.ToLower(interval.Unit) {
+	case "microsecond":
+		n, dsUnit = &BinaryExpr{Left: paren(n), Operator: DivStr, Right: newInt(1000000)}, "SECOND"
+	case "second":
+		dsUnit = "SECOND"
+	case "minute":
+		dsUnit = "MINUTE"
+	case "hour":
+		dsUnit = "HOUR"
+	case "day":
+		dsUnit = "DAY"
+	case "week":
+		n, dsUnit = multiply(n, 7), "DAY"
+	case "month":
+	case "quarter":
+		n = multiply(n, 3)
+	case "year":
+		n = multiply(n, 12)
+	default:
+		return nil
+	}
+
+	date = dateLiteral(date)
+	if dsUnit == "" {
+		if sub {
+			n = negate(n)
+		}
+		return newFunc("add_months", date, n)
+	}
+	operator := PlusStr
+	if sub {
+		operator = MinusStr
+	}
+	return &BinaryExpr{Left: date, Operator: operator, Right: newFunc("numtodsinterval", n, newStr(dsUnit))}
+}
+
+// timestampdiff(unit, a, b) 按单位计算b - a，小数部分截掉
+func convertTimestampDiff(node *FuncExpr) Expr {
+	args := funcArgs(node)
+	if len(args) != 3 {
+		return nil
+	}
+	unit, ok := args[0].(*ColName)
+	if !ok || !unit.Qualifier.IsEmpty() {
+		return nil
+	}
+	from, to := dateExpr(args[1]), dateExpr(args[2])
+	days := &BinaryExpr{Left: to, Operator: MinusStr, Right: from}
+	months := newFunc("months_between", to, from)
+
+	var diff Expr
+	switch unit.Name.Lowered() {
+	case "microsecond":
+		diff = &BinaryExpr{Left: paren(days), Operator: MultStr, Right: newInt(86400000000)}
+	case "second":
+		diff = &BinaryExpr{Left: paren(days), Operator: MultStr, Right: newInt(86400)}
+	case "minute":
+		diff = &BinaryExpr{Left: paren(days), Operator: MultStr, Right: newInt(1440)}
+	case "hour":
+		diff = &BinaryExpr{Left: paren(days), Operator: MultStr, Right: newInt(24)}
+	case "day":
+		diff = days
+	case "week":
+		diff = &BinaryExpr{Left: paren(days), Operator: DivStr, Right: newInt(7)}
+	case "month":
+		diff = months
+	case "quarter":
+		diff = &BinaryExpr{Left: months, Operator: DivStr, Right: newInt(3)}
+	case "year":
+		diff = &BinaryExpr{Left: months, Operator: DivStr, Right: newInt(12)}
+	default:
+		return nil
+	}
+	return newFunc("trunc", diff)
+}
+
+// datediff(a, b) -> trunc(a) - trunc(b)，只比较日期部分
+func convertDateDiff(node *FuncExpr) Expr {
+	args := funcArgs(node)
+	if len(args) != 2 {
+		return nil
+	}
+	return &BinaryExpr{
+		Left:     newFunc("trunc", dateExpr(args[0])),
+		Operator: MinusStr,
+		Right:    newFunc("trunc", dateExpr(args[1])),
+	}
+}
+
+// now() -> sysdate，now(fsp) -> localtimestamp(fsp)
+func convertNow(node *FuncExpr) Expr {
+	args := funcArgs(node)
+	switch len(args) {
+	case 0:
+		return Pseudocolumn(SysdateStr)
+	case 1:
+		return newFunc("localtimestamp", args[0])
+	}
+	return nil
+}
+
+// curdate() -> trunc(sysdate)
+func convertCurDate(node *FuncExpr) Expr {
+	if len(node.Exprs) != 0 {
+		return nil
+	}
+	return newFunc("trunc", Pseudocolumn(SysdateStr))
+}
+
+// curtime() -> to_char(sysdate, 'HH24:MI:SS')
+func convertCurTime(node *FuncExpr) Expr {
+	if len(node.Exprs) != 0 {
+		return nil
+	}
+	return newFunc("to_char", Pseudocolumn(SysdateStr), newStr("HH24:MI:SS"))
+}
+
+func utcNow() Expr {
+	return &CastExpr{Expr: newFunc("sys_extract_utc", Pseudocolumn(SystimestampStr)), Type: "date"}
+}
+
+// utc_timestamp() -> cast(sys_extract_utc(systimestamp) as date)
+func convertUTCTimestamp(node *FuncExpr) Expr {
+	if len(node.Exprs) != 0 {
+		return nil
+	}
+	return utcNow()
+}
+
+// utc_date() -> trunc(cast(sys_extract_utc(systimestamp) as date))
+func convertUTCDate(node *FuncExpr) Expr {
+	if len(node.Exprs) != 0 {
+		return nil
+	}
+	return newFunc("trunc", utcNow())
+}
+
+// condition 把MySQL中当作真假值使用的表达式转换为条件，非0为真
+func condition(expr Expr) Expr {
+	switch node := expr.(type) {
+	case *ComparisonExpr, *AndExpr, *OrExpr, *NotExpr, *IsExpr, *RangeCond, *ExistsExpr:
+		return expr
+	case *ParenExpr:
+		return &ParenExpr{Expr: condition(node.Expr)}
+	case BoolVal:
+		if node {
+			return &ComparisonExpr{Left: newInt(1), Operator: EqualStr, Right: newInt(1)}
+		}
+		return &ComparisonExpr{Left: newInt(1), Operator: EqualStr, Right: newInt(0)}
+	}
+	return &ComparisonExpr{Left: expr, Operator: NotEqualStr, Right: newInt(0)}
+}
+
+// nullable 判断表达式的值是否可能为null，常量之外的都认为可能为null
+func nullable(expr Expr) bool {
+	if v, ok := expr.(*SQLVal); ok {
+		return v.Type == ValArg
+	}
+	return true
+}
+
+// if(c, a, b) -> case when c then a else b end
+func convertIf(node *FuncExpr) Expr {
+	args := funcArgs(node)
+	if len(args) != 3 {
+		return nil
+	}
+	return &CaseExpr{Whens: []*When{{Cond: condition(args[0]), Val: args[1]}}, Else: args[2]}
+}
+
+// ifnull(a, b) -> nvl(a, b)
+func convertIfNull(node *FuncExpr) Expr {
+	args := funcArgs(node)
+	if len(args) != 2 {
+		return nil
+	}
+	return newFunc("nvl", args...)
+}
+
+// isnull(a) -> nvl2(a, 0, 1)
+func convertIsNull(node *FuncExpr) Expr {
+	args := funcArgs(node)
+	if len(args) != 1 {
+		return nil
+	}
+	return newFunc("nvl2", args[0], newInt(0), newInt(1))
+}
+
+// nullif(a, b)两边语义相同，但Oracle的第一个参数不能是null常量
+func convertNullIf(node *FuncExpr) Expr {
+	args := funcArgs(node)
+	if len(args) != 2 {
+		return nil
+	}
+	if _, ok := args[0].(*NullVal); ok {
+		return &NullVal{}
+	}
+	return nil
+}
+
+// concat(a, b, c) -> case when a is null or c is null then null else a || b || c end，
+// Oracle的||把null当作空字符串，MySQL的concat有一个参数为null时结果为null
+func convertConcat(node *FuncExpr) Expr {
+	args := funcArgs(node)
+	if len(args) == 0 {
+		return nil
+	}
+	var concat, isNull Expr
+	for _, arg := range args {
+		if _, ok := arg.(*NullVal); ok {
+			return &NullVal{}
+		}
+		if concat == nil {
+			concat = paren(arg)
+		} else {
+			concat = &BinaryExpr{Left: concat, Operator: ConcatStr, Right: paren(arg)}
+		}
+		if !nullable(arg) {
+			continue
+		}
+		cond := &IsExpr{Operator: IsNullStr, Expr: CloneExpr(arg)}
+		if isNull == nil {
+			isNull = cond
+		} else {
+			isNull = &OrExpr{Left: isNull, Right: cond}
+		}
+	}
+	if isNull == nil {
+		return concat
+	}
+	return &CaseExpr{Whens: []*When{{Cond: isNull, Val: &NullVal{}}}, Else: concat}
+}
+
+// concat_ws(s, a, b) -> substr(nvl2(a, s || a, null) || nvl2(b, s || b, null), length(s) + 1)，
+// 跳过为null的参数，分隔符为null时结果为null
+func convertConcatWs(node *FuncExpr) Expr {
+	args := funcArgs(node)
+	if len(args) < 2 {
+		return nil
+	}
+	sep, values := args[0], args[1:]
+	if _, ok := sep.(*NullVal); ok {
+		return &NullVal{}
+	}
+
+	var concat Expr
+	for _, value := range values {
+		if _, ok := value.(*NullVal); ok {
+			continue
+		}
+		var item Expr = &BinaryExpr{Left: paren(CloneExpr(sep)), Operator: ConcatStr, Right: paren(value)}
+		if nullable(value) {
+			item = newFunc("nvl2", CloneExpr(value), item, &NullVal{})
+		}
+		if concat == nil {
+			concat = item
+		} else {
+			concat = &BinaryExpr{Left: concat, Operator: ConcatStr, Right: item}
+		}
+	}
+	if concat == nil {
+		return newStr("")
+	}
+
+	var start Expr
+	if s, ok := strArg(sep); ok {
+		start = newInt(int64(utf8.RuneCountInString(s)) + 1)
+	} else {
+		start = &BinaryExpr{Left: newFunc("length", sep), Operator: PlusStr, Right: newInt(1)}
+	}
+	return newFunc("substr", concat, start)
+}
+
+// group_concat(e1, e2 order by o separator s) -> listagg(e1 || e2, s) within group (order by o)，
+// 没有order by且分隔符为默认的逗号时转换为wm_concat(e1 || e2)
+func convertGroupConcat(node *GroupConcatExpr) Expr {
+	var expr Expr
+	for _, selectExpr := range node.Exprs {
+		aliased, ok := selectExpr.(*AliasedExpr)
+		if !ok {
+			return nil
+		}
+		if expr == nil {
+			expr = aliased.Expr
+		} else {
+			expr = &BinaryExpr{Left: expr, Operator: ConcatStr, Right: paren(aliased.Expr)}
+		}
+	}
+	if expr == nil {
+		return nil
+	}
+
+	separator := ","
+	if node.Separator != "" {
+		separator = strings.TrimSuffix(strings.TrimPrefix(node.Separator, " separator '"), "'")
+	}
+	if len(node.OrderBy) == 0 && separator == "," {
+		return &FuncExpr{Name: NewColIdent("wm_concat"), Distinct: node.Distinct != "", Exprs: SelectExprs{&AliasedExpr{Expr: expr}}}
+	}
+	return &ListAggExpr{Distinct: node.Distinct, Expr: expr, Separator: newStr(separator), OrderBy: node.OrderBy}
+}
+
+// distinctGroupConcat 把group_concat(distinct)改写为对去重后的子查询分组：
+//
+//	select a, group_concat(distinct b) from t where w group by a
+//	-> select c1 as a, group_concat(c2) from (select distinct a as c1, b as c2 from t where w) group by c1
+//
+// group_concat的order by中有只用于排序的列时按连接的值去重，这些列在子查询中取每个值排在最前的一行：
+//
+//	select group_concat(distinct b order by d) from t
+//	-> select group_concat(c1 order by c2) from (select b as c1, min(d) as c2 from t group by b)
+//
+// 只有一个group_concat(distinct)且没有其它聚合函数和子查询时才改写，否则保留distinct，
+// 转换为listagg(distinct)或wm_concat(distinct)
+func distinctGroupConcat(sel *Select) {
+	var (
+		concat *GroupConcatExpr
+		ok     = true
+	)
+	_ = Walk(func(node SQLNode) (kcontinue bool, err error) {
+		switch n := node.(type) {
+		case *GroupConcatExpr:
+			if concat != nil || n.Distinct == "" {
+				ok = false
+			}
+			concat = n
+		case *FuncExpr:
+			if n.IsAggregate() {
+				ok = false
+			}
+		case *Subquery, *StarExpr:
+			ok = false
+		}
+		return ok, nil
+	}, sel.SelectExprs, sel.GroupBy, sel.Having, sel.OrderBy)
+	if !ok || concat == nil {
+		return
+	}
+
+	// 没有限定表名且与查询列别名相同的是别名，不是表中的列
+	aliases := make(map[string]bool)
+	for _, expr := range sel.SelectExprs {
+		if aliased, ok := expr.(*AliasedExpr); ok && !aliased.As.IsEmpty() {
+			aliases[aliased.As.Lowered()] = true
+		}
+	}
+	isColumn := func(col *ColName) bool {
+		return !col.Qualifier.IsEmpty() || !aliases[col.Name.Lowered()]
+	}
+
+	// 只在group_concat的order by中出现的列，升序取最小值，降序取最大值
+	orderOnly := make(map[string]string)
+	for _, order := range concat.OrderBy {
+		agg := "min"
+		if order.Direction == DescScr {
+			agg = "max"
+		}
+		_ = Walk(func(node SQLNode) (kcontinue bool, err error) {
+			if col, ok := node.(*ColName); ok && isColumn(col) {
+				orderOnly[String(col)] = agg
+			}
+			return true, nil
+		}, order.Expr)
+	}
+	_ = Walk(func(node SQLNode) (kcontinue bool, err error) {
+		switch n := node.(type) {
+		case *GroupConcatExpr:
+			_ = Walk(func(node SQLNode) (kcontinue bool, err error) {
+				if col, ok := node.(*ColName); ok {
+					delete(orderOnly, String(col))
+				}
+				return true, nil
+			}, n.Exprs)
+			return false, nil
+		case *ColName:
+			delete(orderOnly, String(n))
+		}
+		return true, nil
+	}, sel.SelectExprs, sel.GroupBy, sel.Having, sel.OrderBy)
+
+	var (
+		innerExprs SelectExprs
+		innerGroup GroupBy
+		columns    = make(map[string]ColIdent)
+		refs       = make(map[*ColName]ColIdent)
+	)
+	_ = Walk(func(node SQLNode) (kcontinue bool, err error) {
+		col, ok := node.(*ColName)
+		if !ok || !isColumn(col) {
+			return true, nil
+		}
+		key := String(col)
+		alias, ok := columns[key]
+		if !ok {
+			alias = NewColIdent(fmt.Sprintf("c%d", len(columns)+1))
+			columns[key] = alias
+			var expr Expr = &ColName{Name: col.Name, Qualifier: col.Qualifier}
+			if agg, ok := orderOnly[key]; ok {
+				expr = newFunc(agg, expr)
+			} else {
+				innerGroup = append(innerGroup, &ColName{Name: col.Name, Qualifier: col.Qualifier})
+			}
+			innerExprs = append(innerExprs, &AliasedExpr{Expr: expr, As: alias})
+		}
+		refs[col] = alias
+		return true, nil
+	}, sel.SelectExprs, sel.GroupBy, sel.Having, sel.OrderBy)
+
+	// 查询列保持原来的列名
+	for _, expr := range sel.SelectExprs {
+		if aliased, ok := expr.(*AliasedExpr); ok && aliased.As.IsEmpty() {
+			if col, ok := aliased.Expr.(*ColName); ok {
+				aliased.As = col.Name
+			}
+		}
+	}
+	for col, alias := range refs {
+		col.Name, col.Qualifier = alias, TableName{}
+	}
+
+	inner := &Select{Distinct: DistinctStr, SelectExprs: innerExprs, From: sel.From, Where: sel.Where}
+	if len(orderOnly) > 0 {
+		inner.Distinct, inner.GroupBy = "", innerGroup
+	}
+	sel.From = TableExprs{&AliasedTableExpr{Expr: &Subquery{Select: inner}}}
+	sel.Where = nil
+	concat.Distinct = ""
+}
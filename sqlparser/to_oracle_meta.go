@@ -0,0 +1,288 @@
+package sqlparser
+
+import "strings"
+
+// 建表和修改表时在表的元数据的副本上修改，转换成的语句执行成功之后才替换converter中的元数据，
+// DDL执行失败或者没有执行时不改变之后的转换
+
+// tableMeta is the metadata of a table kept by OracleConverter.
+type tableMeta struct {
+	columns      []string                  // 表的列，未知时为nil
+	uniqueIndexs map[string][]string       // 索引名 -> 主键或唯一索引的列，主键为PrimaryIndexName
+	increments   map[string]int            // 自增列 -> 列的位置
+	onUpdate     map[string]onUpdateColumn // 小写的列名 -> on update current_timestamp的列
+	enums        map[string]EnumColumn     // 小写的列名 -> 转换为varchar的enum和set列
+}
+
+// PrimaryIndexName is the index name of the primary key in the unique indexs
+// of a table.
+const PrimaryIndexName = "PRIMARY"
+
+// metaChange is the change of the table metadata made by converting a DDL
+// statement, it is applied by Apply after the converted statements are
+// executed successfully.
+type metaChange struct {
+	c      *OracleConverter
+	tables map[string]*tableMeta // 表名 -> 修改之后的元数据，删除的表为nil
+}
+
+func (c *OracleConverter) newMetaChange() *metaChange {
+	return &metaChange{c: c, tables: make(map[string]*tableMeta)}
+}
+
+// table 返回表的元数据的副本，修改副本不影响converter，同一条语句中之后的转换使用修改后的副本
+func (m *metaChange) table(table TableName) *tableMeta {
+	name := table.Name.String()
+	if t := m.tables[name]; t != nil {
+		return t
+	}
+	t := &tableMeta{}
+	if _, dropped := m.tables[name]; !dropped {
+		t = m.c.tableMeta(name)
+	}
+	m.tables[name] = t
+	return t
+}
+
+// create 建表时元数据重新记录
+func (m *metaChange) create(table TableName, columns []string) *tableMeta {
+	t := &tableMeta{columns: columns}
+	m.tables[table.Name.String()] = t
+	return t
+}
+
+// drop 删除表时元数据随表删除
+func (m *metaChange) drop(table TableName) {
+	m.tables[table.Name.String()] = nil
+}
+
+// rename 重命名表，触发器和约束都随表重命名，名字不变
+func (m *metaChange) rename(from TableName, to TableIdent) {
+	t := m.table(from)
+	m.drop(from)
+	m.tables[to.String()] = t
+}
+
+// change 没有修改时返回nil
+func (m *metaChange) change() MetaChange {
+	if len(m.tables) == 0 {
+		return nil
+	}
+	return m
+}
+
+// Apply replaces the metadata of the tables changed by the converted
+// statements.
+func (m *metaChange) Apply() {
+	c := m.c
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+	for name, t := range m.tables {
+		c.putTableColumns(name, nil)
+		delete(c.tableUniqueIndexs, name)
+		delete(c.incrementColumns, name)
+		delete(c.onUpdateColumns, name)
+		delete(c.enumColumns, name)
+		if t == nil {
+			continue
+		}
+		c.putTableColumns(name, t.columns)
+		if len(t.uniqueIndexs) > 0 {
+			if c.tableUniqueIndexs == nil {
+				c.tableUniqueIndexs = make(map[string]map[string][]string)
+			}
+			c.tableUniqueIndexs[name] = t.uniqueIndexs
+		}
+		if len(t.increments) > 0 {
+			if c.incrementColumns == nil {
+				c.incrementColumns = make(map[string]map[string]int)
+			}
+			c.incrementColumns[name] = t.increments
+		}
+		if len(t.onUpdate) > 0 {
+			if c.onUpdateColumns == nil {
+				c.onUpdateColumns = make(map[string]map[string]onUpdateColumn)
+			}
+			c.onUpdateColumns[name] = t.onUpdate
+		}
+		if len(t.enums) > 0 {
+			if c.enumColumns == nil {
+				c.enumColumns = make(map[string]map[string]EnumColumn)
+			}
+			c.enumColumns[name] = t.enums
+		}
+	}
+}
+
+// tableMeta 返回converter中表的元数据的副本
+func (c *OracleConverter) tableMeta(table string) *tableMeta {
+	t := &tableMeta{}
+	if columns := c.tableColumnNames(table); columns != nil {
+		t.columns = append([]string{}, columns...)
+	}
+	c.metaMu.RLock()
+	defer c.metaMu.RUnlock()
+	if indexs := c.tableUniqueIndexs[table]; len(indexs) > 0 {
+		t.uniqueIndexs = make(map[string][]string, len(indexs))
+		for name, cols := range indexs {
+			t.uniqueIndexs[name] = cols
+		}
+	}
+	if cols := c.incrementColumns[table]; len(cols) > 0 {
+		t.increments = make(map[string]int, len(cols))
+		for col, pos := range cols {
+			t.increments[col] = pos
+		}
+	}
+	if cols := c.onUpdateColumns[table]; len(cols) > 0 {
+		t.onUpdate = make(map[string]onUpdateColumn, len(cols))
+		for key, col := range cols {
+			t.onUpdate[key] = col
+		}
+	}
+	if cols := c.enumColumns[table]; len(cols) > 0 {
+		t.enums = make(map[string]EnumColumn, len(cols))
+		for key, enum := range cols {
+			t.enums[key] = enum
+		}
+	}
+	return t
+}
+
+// putTableColumns 记录表的列，columns为nil时删除，调用方持有metaMu
+func (c *OracleConverter) putTableColumns(table string, columns []string) {
+	if c.tableColumns == nil {
+		c.tableColumns = make(map[string][]string)
+	}
+	for name := range c.tableColumns {
+		if strings.EqualFold(name, table) {
+			delete(c.tableColumns, name)
+		}
+	}
+	if columns != nil {
+		c.tableColumns[table] = columns
+	}
+}
+
+// uniqueIndexs 返回表的主键和唯一索引，返回的map不能修改
+func (c *OracleConverter) uniqueIndexs(table string) map[string][]string {
+	c.metaMu.RLock()
+	defer c.metaMu.RUnlock()
+	return c.tableUniqueIndexs[table]
+}
+
+// LookupKeyColumn reports whether a column is part of the primary key of a
+// table, and whether it has a unique index of its own, like PRI_KEY_FLAG and
+// UNIQUE_KEY_FLAG of MySQL.
+func (c *OracleConverter) LookupKeyColumn(table, column string) (primary, unique bool) {
+	for name, columns := range c.uniqueIndexs(table) {
+		for _, col := range columns {
+			if !strings.EqualFold(col, column) {
+				continue
+			}
+			if name == PrimaryIndexName {
+				primary = true
+			} else if len(columns) == 1 {
+				unique = true
+			}
+		}
+	}
+	return primary, unique
+}
+
+// tableIncrementColumns 返回表的自增列，返回的map不能修改
+func (c *OracleConverter) tableIncrementColumns(table string) map[string]int {
+	c.metaMu.RLock()
+	defer c.metaMu.RUnlock()
+	return c.incrementColumns[table]
+}
+
+// setUniqueIndex 记录主键或唯一索引，列的slice不能再修改
+func (t *tableMeta) setUniqueIndex(name string, columns []string) {
+	if t.uniqueIndexs == nil {
+		t.uniqueIndexs = make(map[string][]string)
+	}
+	t.uniqueIndexs[name] = columns
+}
+
+// setKeyIndex 记录主键和唯一索引，普通索引不记录
+func (t *tableMeta) setKeyIndex(idx *IndexDefinition) {
+	if !idx.Info.Primary && !idx.Info.Unique {
+		return
+	}
+	columns := make([]string, 0, len(idx.Columns))
+	for _, col := range idx.Columns {
+		columns = append(columns, col.Column.String())
+	}
+	name := idx.Info.Name.String()
+	if idx.Info.Primary {
+		name = PrimaryIndexName
+	}
+	t.setUniqueIndex(name, columns)
+}
+
+func (t *tableMeta) setIncrementColumn(column ColIdent, pos int) {
+	if t.increments == nil {
+		t.increments = make(map[string]int)
+	}
+	t.increments[column.String()] = pos
+}
+
+func (t *tableMeta) dropIncrementColumn(column ColIdent) {
+	for name := range t.increments {
+		if column.EqualString(name) {
+			delete(t.increments, name)
+		}
+	}
+}
+
+// dropUniqueIndex 删除主键或唯一索引，索引名不区分大小写
+func (t *tableMeta) dropUniqueIndex(name string) {
+	for key := range t.uniqueIndexs {
+		if strings.EqualFold(key, name) {
+			delete(t.uniqueIndexs, key)
+		}
+	}
+}
+
+func (t *tableMeta) renameUniqueIndex(from, to string) {
+	for key, columns := range t.uniqueIndexs {
+		if strings.EqualFold(key, from) {
+			delete(t.uniqueIndexs, key)
+			t.uniqueIndexs[to] = columns
+		}
+	}
+}
+
+// dropKeyColumn 删除列时删除包含该列的索引，列的slice与converter共用，不在原处修改
+func (t *tableMeta) dropKeyColumn(column ColIdent) {
+	t.dropIncrementColumn(column)
+	for name, columns := range t.uniqueIndexs {
+		for _, col := range columns {
+			if column.EqualString(col) {
+				delete(t.uniqueIndexs, name)
+				break
+			}
+		}
+	}
+}
+
+// renameKeyColumn 重命名索引和自增列中的列
+func (t *tableMeta) renameKeyColumn(from, to ColIdent) {
+	for name, pos := range t.increments {
+		if from.EqualString(name) {
+			delete(t.increments, name)
+			t.increments[to.String()] = pos
+		}
+	}
+	for name, columns := range t.uniqueIndexs {
+		renamed := make([]string, 0, len(columns))
+		for _, col := range columns {
+			if from.EqualString(col) {
+				col = to.String()
+			}
+			renamed = append(renamed, col)
+		}
+		t.uniqueIndexs[name] = renamed
+	}
+}
@@ -1,6 +1,7 @@
 package sqlparser
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"testing"
@@ -123,7 +124,7 @@ func TestConvertToOracle(t *testing.T) {
 	)
 	for i, tcase := range testCases {
 		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
-			_, oSql, _, err := converter.Convert(tcase.in)
+			oSql, _, err := converter.Convert(tcase.in)
 			assert.Nil(t, err)
 			assert.Equal(t, tcase.out, oSql[0])
 			log.Println(oSql[0])
@@ -151,7 +152,7 @@ func TestConvertArgs(t *testing.T) {
 			},
 		},
 	)
-	_, newSQL, newArgs, err := converter.Convert(sql, args...)
+	newSQL, newArgs, err := converter.Convert(sql, args...)
 	assert.Nil(t, err)
 	assert.NotEqual(t, args, newArgs)
 	t.Logf("newSQL: %s, newArgs: %v", newSQL, newArgs)
@@ -161,3 +162,1271 @@ func TestConvertArgs(t *testing.T) {
 	t.Logf("formatSQL: %s", formatSQL)
 
 }
+
+func TestConvertLimit(t *testing.T) {
+	testCases := []struct {
+		pagination string
+		in, out    string
+		args       []interface{}
+		outArgs    []interface{}
+	}{
+		{
+			pagination: PAGINATION_OFFSET,
+			in:         "select id, name from t where a = 1 order by id limit 10",
+			out:        `select "id", "name" from "t" where "a" = 1 order by "id" asc fetch first 10 rows only`,
+		},
+		{
+			pagination: PAGINATION_OFFSET,
+			in:         "select id, name from t where a = ? order by id limit ?, ?",
+			out:        `select "id", "name" from "t" where "a" = :v1 order by "id" asc offset :v2 rows fetch next :v3 rows only`,
+			args:       []interface{}{1, 20, 10},
+			outArgs:    []interface{}{1, 20, 10},
+		},
+		{
+			pagination: PAGINATION_OFFSET,
+			in:         "select a.id from (select id from t limit 3) a where a.id in (select id from u limit 2)",
+			out:        `select "a"."id" from (select "id" from "t" fetch first 3 rows only) as "a" where "a"."id" in (select "id" from "u" fetch first 2 rows only)`,
+		},
+		{
+			pagination: PAGINATION_OFFSET,
+			in:         "(select id from t limit 1) union (select id from u limit 2) limit 2",
+			out:        `(select "id" from "t" fetch first 1 rows only) union (select "id" from "u" fetch first 2 rows only) fetch first 2 rows only`,
+		},
+		{
+			pagination: PAGINATION_OFFSET,
+			in:         "insert into t2 (id) select id from t limit 2, 3",
+			out:        `insert into "t2"("id") select "id" from "t" offset 2 rows fetch next 3 rows only`,
+		},
+		{
+			pagination: PAGINATION_ROWNUM,
+			in:         "select id, name from t where a = 1 order by id limit 0, 10",
+			out:        `select * from (select "id", "name" from "t" where "a" = 1 order by "id" asc) where rownum <= 10`,
+		},
+		{
+			pagination: PAGINATION_ROWNUM,
+			in:         "select id, name as n from t where a = ? order by id limit ?, ?",
+			out:        `select "id", "n" from (select t__.*, rownum rn__ from (select "id", "name" as "n" from "t" where "a" = :v1 order by "id" asc) t__ where rownum <= :v2 + :v3) where rn__ > :v4`,
+			args:       []interface{}{1, 20, 10},
+			outArgs:    []interface{}{1, 20, 10, 20},
+		},
+		{
+			pagination: PAGINATION_ROWNUM,
+			in:         "select * from t limit 5, 10",
+			out:        `select * from (select t__.*, rownum rn__ from (select * from "t") t__ where rownum <= 15) where rn__ > 5`,
+		},
+		{
+			pagination: PAGINATION_ROWNUM,
+			in:         "(select id from t limit 1) union (select id from u limit 2) limit 2",
+			out:        `select * from ((select * from (select "id" from "t") where rownum <= 1) union (select * from (select "id" from "u") where rownum <= 2)) where rownum <= 2`,
+		},
+		{
+			pagination: PAGINATION_OFFSET,
+			in:         "update t set a = ? where b = ? or c = 1 limit ?",
+			out:        `update "t" set "a" = :v1 where ("b" = :v2 or "c" = 1) and rownum <= :v3`,
+			args:       []interface{}{1, 2, 3},
+			outArgs:    []interface{}{1, 2, 3},
+		},
+		{
+			pagination: PAGINATION_ROWNUM,
+			in:         "update t set a = 1 where b = 2 order by id desc limit 10",
+			out:        `update "t" set "a" = 1 where rowid in (select * from (select rowid from "t" where "b" = 2 order by "id" desc) where rownum <= 10)`,
+		},
+		{
+			pagination: PAGINATION_OFFSET,
+			in:         "delete from t where b = ? order by id limit ?",
+			out:        `delete from "t" where rowid in (select * from (select rowid from "t" where "b" = :v1 order by "id" asc) where rownum <= :v2)`,
+			args:       []interface{}{2, 10},
+			outArgs:    []interface{}{2, 10},
+		},
+	}
+
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			converter := GetSQLConverter(MYSQL_TO_ORACLE, tcase.pagination, nil, nil, nil)
+			oSql, args, err := converter.Convert(tcase.in, tcase.args...)
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, oSql[0])
+			assert.Equal(t, tcase.outArgs, args)
+		})
+	}
+}
+
+func TestConvertDateFuncs(t *testing.T) {
+	testCases := []struct {
+		in, out string
+		args    []interface{}
+		outArgs []interface{}
+	}{
+		// date_format, str_to_date
+		{
+			in:  "select date_format(created, '%Y-%m-%d %H:%i:%s') from t",
+			out: `select to_char("created", 'YYYY-MM-DD HH24:MI:SS') from "t"`,
+		},
+		{
+			in:  "select date_format('2024-01-02', '%Y年%c月%e日 %T.%f') from t",
+			out: `select to_char(to_date('2024-01-02', 'YYYY-MM-DD'), 'YYYY"年"FMMMFM"月"FMDDFM"日 "HH24:MI:SS.FF6') from "t"`,
+		},
+		{
+			in:  "select date_format(created, '%U') from t",
+			out: `select date_format("created", '%U') from "t"`,
+		},
+		{
+			in:   "select str_to_date(?, '%d/%m/%Y') from t",
+			out:  `select to_date(:v1, 'DD/MM/YYYY') from "t"`,
+			args: []interface{}{"02/01/2024"}, outArgs: []interface{}{"02/01/2024"},
+		},
+		{
+			in:  "select str_to_date(s, '%Y-%m-%d %H:%i:%s.%f') from t",
+			out: `select to_timestamp("s", 'YYYY-MM-DD HH24:MI:SS.FF6') from "t"`,
+		},
+		// now, curdate
+		{
+			in:  "select now(), current_timestamp, sysdate(), now(3), curdate(), current_date, curtime(), utc_timestamp() from t",
+			out: `select sysdate, sysdate, sysdate, localtimestamp(3), trunc(sysdate), trunc(sysdate), to_char(sysdate, 'HH24:MI:SS'), cast(sys_extract_utc(systimestamp) as date) from "t"`,
+		},
+		// unix_timestamp, from_unixtime
+		{
+			in:  "select unix_timestamp(), unix_timestamp(created) from t",
+			out: `select round((cast(sys_extract_utc(systimestamp) as date) - to_date('1970-01-01', 'YYYY-MM-DD')) * 86400), round((cast(sys_extract_utc(from_tz(cast("created" as timestamp), sessiontimezone)) as date) - to_date('1970-01-01', 'YYYY-MM-DD')) * 86400) from "t"`,
+		},
+		{
+			in:  "select from_unixtime(ts, '%Y-%m-%d') from t",
+			out: `select to_char(cast(from_tz(cast(to_date('1970-01-01', 'YYYY-MM-DD') + numtodsinterval("ts", 'SECOND') as timestamp), 'UTC') at time zone sessiontimezone as date), 'YYYY-MM-DD') from "t"`,
+		},
+		// date_add, date_sub, interval
+		{
+			in:   "select date_add(created, interval 1 day), date_sub(created, interval ? hour), adddate(created, 3) from t",
+			out:  `select "created" + numtodsinterval(1, 'DAY'), "created" - numtodsinterval(:v1, 'HOUR'), "created" + numtodsinterval(3, 'DAY') from "t"`,
+			args: []interface{}{2}, outArgs: []interface{}{2},
+		},
+		{
+			in:  "select date_add(created, interval 2 week), date_sub(created, interval 1 quarter), date_add('2024-01-31', interval n month) from t",
+			out: `select "created" + numtodsinterval(14, 'DAY'), add_months("created", -3), add_months(to_date('2024-01-31', 'YYYY-MM-DD'), "n") from "t"`,
+		},
+		{
+			in:  "select id from t where created > now() - interval 7 day and updated < interval 1 year + created",
+			out: `select "id" from "t" where "created" > sysdate - numtodsinterval(7, 'DAY') and "updated" < add_months("created", 12)`,
+		},
+		{
+			in:  "select date_add(created, interval '1:30' hour_minute) from t",
+			out: `select date_add("created", interval '1:30' hour_minute) from "t"`,
+		},
+		// timestampdiff, datediff
+		{
+			in:  "select timestampdiff(second, created, updated), timestampdiff(day, created, '2024-01-01'), timestampdiff(year, birthday, curdate()) from t",
+			out: `select trunc((cast("updated" as date) - cast("created" as date)) * 86400), trunc(to_date('2024-01-01', 'YYYY-MM-DD') - cast("created" as date)), trunc(months_between(trunc(sysdate), cast("birthday" as date)) / 12) from "t"`,
+		},
+		{
+			in:   "select datediff(?, created) from t",
+			out:  `select trunc(cast(:v1 as date)) - trunc(cast("created" as date)) from "t"`,
+			args: []interface{}{"2024-01-01"}, outArgs: []interface{}{"2024-01-01"},
+		},
+		// dml
+		{
+			in:   "update t set updated = now() where created < date_sub(curdate(), interval ? day)",
+			out:  `update "t" set "updated" = sysdate where "created" < trunc(sysdate) - numtodsinterval(:v1, 'DAY')`,
+			args: []interface{}{30}, outArgs: []interface{}{30},
+		},
+	}
+
+	converter := NewOracleConverter(nil, nil, nil)
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			oSql, args, err := converter.Convert(tcase.in, tcase.args...)
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, oSql[0])
+			assert.Equal(t, tcase.outArgs, args)
+		})
+	}
+}
+
+func TestConvertGroupConcat(t *testing.T) {
+	testCases := []struct {
+		in, out string
+	}{
+		{
+			in:  "select a, group_concat(b) from t group by a",
+			out: `select "a", wm_concat("b") from "t" group by "a"`,
+		},
+		{
+			in:  "select a, group_concat(b separator ',') from t group by a",
+			out: `select "a", wm_concat("b") from "t" group by "a"`,
+		},
+		{
+			in:  "select a, group_concat(b separator '; ') from t group by a",
+			out: `select "a", listagg("b", '; ') within group (order by null) from "t" group by "a"`,
+		},
+		{
+			in:  "select a, group_concat(b order by b desc, c) from t group by a",
+			out: `select "a", listagg("b", ',') within group (order by "b" desc, "c" asc) from "t" group by "a"`,
+		},
+		{
+			in:  "select a, group_concat(b, '-', c separator '') from t group by a",
+			out: `select "a", listagg("b" || '-' || "c", '') within group (order by null) from "t" group by "a"`,
+		},
+		// distinct改写为子查询
+		{
+			in:  "select t.a, group_concat(distinct t.b order by t.b separator ';') as bs from t join u on t.id = u.id where u.x = 1 group by t.a order by bs",
+			out: `select "c1" as "a", listagg("c2", ';') within group (order by "c2" asc) as "bs" from (select distinct "t"."a" as "c1", "t"."b" as "c2" from "t" join "u" on "t"."id" = "u"."id" where "u"."x" = 1) group by "c1" order by "bs" asc`,
+		},
+		{
+			in:  "select group_concat(distinct name) from t where id in (1, 2)",
+			out: `select wm_concat("c1") from (select distinct "name" as "c1" from "t" where "id" in (1, 2))`,
+		},
+		// 同一个b有不同的d时只保留一个b，只用于排序的列不参与去重，取每个值排在最前的一行
+		{
+			in:  "select a, group_concat(distinct b order by d desc, b) from t group by a",
+			out: `select "c1" as "a", listagg("c2", ',') within group (order by "c3" desc, "c2" asc) from (select "a" as "c1", "b" as "c2", max("d") as "c3" from "t" group by "a", "b") group by "c1"`,
+		},
+		{
+			in:  "select group_concat(distinct b order by d) from t",
+			out: `select listagg("c1", ',') within group (order by "c2" asc) from (select "b" as "c1", min("d") as "c2" from "t" group by "b")`,
+		},
+		// 有其它聚合函数时保留distinct
+		{
+			in:  "select a, count(*), group_concat(distinct b) from t group by a",
+			out: `select "a", count(*), wm_concat(distinct "b") from "t" group by "a"`,
+		},
+	}
+
+	converter := NewOracleConverter(nil, nil, nil)
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			oSql, _, err := converter.Convert(tcase.in)
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, oSql[0])
+		})
+	}
+}
+
+func TestConvertControlFuncs(t *testing.T) {
+	testCases := []struct {
+		in, out string
+		args    []interface{}
+		outArgs []interface{}
+	}{
+		{
+			in:  "select if(a > 1, 'x', 'y'), if(b, 1, 0) from t",
+			out: `select case when "a" > 1 then 'x' else 'y' end, case when "b" != 0 then 1 else 0 end from "t"`,
+		},
+		{
+			in:  "select ifnull(a, 0), isnull(b), nullif(a, b), nullif(null, b) from t",
+			out: `select nvl("a", 0), nvl2("b", 0, 1), nullif("a", "b"), null from "t"`,
+		},
+		{
+			in:  "select concat(a, '-', b) from t",
+			out: `select case when "a" is null or "b" is null then null else "a" || '-' || "b" end from "t"`,
+		},
+		{
+			in:  "select concat('a', 'b'), concat('a', null) from t",
+			out: `select 'a' || 'b', null from "t"`,
+		},
+		{
+			in:  "select concat_ws(', ', a, 'x', b) from t",
+			out: `select substr(nvl2("a", ', ' || "a", null) || ', ' || 'x' || nvl2("b", ', ' || "b", null), 3) from "t"`,
+		},
+		// 重复使用的参数按位置复制
+		{
+			in:      "select id from t where name = concat(?, ?) and id = ?",
+			out:     `select "id" from "t" where "name" = case when :v1 is null or :v2 is null then null else :v3 || :v4 end and "id" = :v5`,
+			args:    []interface{}{"a", "b", 1},
+			outArgs: []interface{}{"a", "b", "a", "b", 1},
+		},
+		{
+			in:  "select ifnull(concat(a, b), '') from t",
+			out: `select nvl(case when "a" is null or "b" is null then null else "a" || "b" end, '') from "t"`,
+		},
+	}
+
+	converter := NewOracleConverter(nil, nil, nil)
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			oSql, args, err := converter.Convert(tcase.in, tcase.args...)
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, oSql[0])
+			assert.Equal(t, tcase.outArgs, args)
+		})
+	}
+}
+
+func TestRegisterOracleFunc(t *testing.T) {
+	RegisterOracleFunc("MY_UPPER", func(node *FuncExpr) Expr {
+		return newFunc("upper", funcArgs(node)...)
+	})
+	defer func() {
+		oracleFuncsMutex.Lock()
+		delete(oracleFuncs, "my_upper")
+		oracleFuncsMutex.Unlock()
+	}()
+
+	converter := NewOracleConverter(nil, nil, nil)
+	oSql, _, err := converter.Convert("select my_upper(ifnull(a, 'x')) from t")
+	assert.Nil(t, err)
+	assert.Equal(t, `select upper(nvl("a", 'x')) from "t"`, oSql[0])
+}
+
+// oracleLiterals decodes the string literals of an oracle statement.
+func oracleLiterals(sql string) []string {
+	var literals []string
+	for i := 0; i < len(sql); i++ {
+		if sql[i] != '\'' {
+			continue
+		}
+		var val []byte
+		for i++; i < len(sql); i++ {
+			if sql[i] == '\'' {
+				if i+1 < len(sql) && sql[i+1] == '\'' {
+					i++
+				} else {
+					break
+				}
+			}
+			val = append(val, sql[i])
+		}
+		literals = append(literals, string(val))
+	}
+	return literals
+}
+
+func TestConvertQuoting(t *testing.T) {
+	testCases := []struct {
+		in, out string
+	}{
+		{
+			in:  `select * from t where a = 'it\'s' and b = "say ""hi"""`,
+			out: `select * from "t" where "a" = 'it''s' and "b" = 'say "hi"'`,
+		},
+		{
+			in:  `select * from t where path = 'C:\\data\\' and note = 'line1\nline2'`,
+			out: "select * from \"t\" where \"path\" = 'C:\\data\\' and \"note\" = 'line1\nline2'",
+		},
+		{
+			in:  "select `a``b`, `c\"d` from `t` where e = 'use `e` here'",
+			out: "select \"a`b\", \"c\"\"d\" from \"t\" where \"e\" = 'use `e` here'",
+		},
+		{
+			in:  `insert into t(j) values ('{"k":"0000-00-00 00:00:00","s":"a\\"b","q":"\\\'"}')`,
+			out: `insert into "t"("j") values ('{"k":"0000-00-00 00:00:00","s":"a\"b","q":"\''"}')`,
+		},
+		// 只替换值为零值的时间常量
+		{
+			in:  "update t set d = '0000-00-00 00:00:00', e = '0000-00-00', f = '0000-00-00 00:00:00 UTC' where g = '0000-00-00 00:00:00.000'",
+			out: `update "t" set "d" = '0001-01-01 00:00:00', "e" = '0001-01-01', "f" = '0000-00-00 00:00:00 UTC' where "g" = '0001-01-01 00:00:00.000'`,
+		},
+		// 不按语法树转换的语句只替换标识符和字符串常量
+		{
+			in:  "create view `v` as select 'it\\'s `c`' /* `c` */",
+			out: `create view "v" as select 'it''s ` + "`c`' /* `c` */",
+		},
+	}
+
+	converter := NewOracleConverter(nil, nil, nil)
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			oSql, _, err := converter.Convert(tcase.in)
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, oSql[0])
+
+			// 字符串常量的值不变
+			stmt, err := Parse(tcase.in)
+			assert.Nil(t, err)
+			var literals []string
+			_ = Walk(func(node SQLNode) (kcontinue bool, err error) {
+				if v, ok := node.(*SQLVal); ok && v.Type == StrVal {
+					val := string(v.Val)
+					if zeroDate.MatchString(val) {
+						val = "0001-01-01" + val[len("0000-00-00"):]
+					}
+					literals = append(literals, val)
+				}
+				return true, nil
+			}, stmt)
+			if _, ok := stmt.(*DDL); !ok {
+				assert.Equal(t, literals, oracleLiterals(oSql[0]))
+			}
+		})
+	}
+}
+
+func TestConvertMultiTableUpdateDelete(t *testing.T) {
+	testCases := []struct {
+		in, out string
+		args    []interface{}
+		outArgs []interface{}
+		err     error
+	}{
+		{
+			in:  "update orders o join users u on o.user_id = u.id set o.user_name = u.name, o.updated = now() where u.status = 1",
+			out: `merge into "orders" as "o" using (select "o".rowid as "rid__", max("u"."name") as "v1__" from "orders" as "o" join "users" as "u" on "o"."user_id" = "u"."id" where "u"."status" = 1 group by "o".rowid) as "s__" on ("o".rowid = "s__"."rid__") when matched then update set "o"."user_name" = "s__"."v1__", "o"."updated" = sysdate`,
+		},
+		// left join没有匹配的行set为null，一行匹配多行时按rowid分组只修改一次
+		{
+			in:  "update a left join b on a.id = b.aid set a.x = b.y, a.z = b.y + a.z, a.n = a.n + 1",
+			out: `merge into "a" using (select "a".rowid as "rid__", max("b"."y") as "v1__", max("b"."y" + "a"."z") as "v2__" from "a" left join "b" on "a"."id" = "b"."aid" group by "a".rowid) as "s__" on ("a".rowid = "s__"."rid__") when matched then update set "a"."x" = "s__"."v1__", "a"."z" = "s__"."v2__", "a"."n" = "a"."n" + 1`,
+		},
+		// set的值只引用目标表时按rowid去重
+		{
+			in:  "update a, b set a.flag = 0 where a.id = b.aid and b.deleted = 1",
+			out: `merge into "a" using (select distinct "a".rowid as "rid__" from "a", "b" where "a"."id" = "b"."aid" and "b"."deleted" = 1) as "s__" on ("a".rowid = "s__"."rid__") when matched then update set "a"."flag" = 0`,
+		},
+		{
+			in:      "update t1 x join t2 y on x.id = y.id and y.k = ? set y.v = ?, y.w = x.w where x.k = ?",
+			out:     `merge into "t2" as "y" using (select "y".rowid as "rid__", max("x"."w") as "v1__" from "t1" as "x" join "t2" as "y" on "x"."id" = "y"."id" and "y"."k" = :v1 where "x"."k" = :v2 group by "y".rowid) as "s__" on ("y".rowid = "s__"."rid__") when matched then update set "y"."v" = :v3, "y"."w" = "s__"."v1__"`,
+			args:    []interface{}{1, "v", 2},
+			outArgs: []interface{}{1, 2, "v"},
+		},
+		// 修改多个表的update目标库不支持，返回错误
+		{
+			in:  "update a join b on a.id = b.aid set a.x = 1, b.y = 2",
+			err: ErrMultiTargetUpdate,
+		},
+		// 与MySQL一样多表update不能有limit
+		{
+			in:  "update t a join b on a.id = b.aid set a.x = 1 limit 1",
+			err: ErrUpdateLimit,
+		},
+		{
+			in:  "delete o from orders o join users u on o.user_id = u.id where u.status = 0",
+			out: `delete from "orders" as "d__" where exists (select 1 from "orders" as "o" join "users" as "u" on "o"."user_id" = "u"."id" where "u"."status" = 0 and "o".rowid = "d__".rowid)`,
+		},
+		{
+			in:  "delete a from a left join b on a.id = b.aid where b.aid is null or a.x = 1",
+			out: `delete from "a" as "d__" where exists (select 1 from "a" left join "b" on "a"."id" = "b"."aid" where ("b"."aid" is null or "a"."x" = 1) and "a".rowid = "d__".rowid)`,
+		},
+		{
+			in:  "delete t from t where t.id = 1",
+			out: `delete from "t" where "t"."id" = 1`,
+		},
+		// 删除多个表的delete目标库不支持，返回错误
+		{
+			in:  "delete a, b from a join b on a.id = b.aid where b.x = 1",
+			err: ErrMultiTargetDelete,
+		},
+	}
+
+	converter := NewOracleConverter(nil, nil, nil)
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			oSql, args, err := converter.Convert(tcase.in, tcase.args...)
+			if tcase.err != nil {
+				assert.True(t, errors.Is(err, tcase.err))
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, oSql[0])
+			assert.Equal(t, tcase.outArgs, args)
+		})
+	}
+}
+
+func TestConvertReplaceIgnore(t *testing.T) {
+	testCases := []struct {
+		in      string
+		out     []string
+		args    []interface{}
+		outArgs []interface{}
+		err     error
+	}{
+		// replace先删除与任意一个唯一索引冲突的行再插入
+		{
+			in: "replace into t (id, code, name) values (1, 'a', 'x'), (?, ?, ?)",
+			out: []string{
+				`delete from "t" as "t" where exists (select 1 from (select 1, 'a', 'x' from dual union all select :v1, :v2, :v3 from dual) "s" ("id", "code", "name") where "t"."id" = "s"."id" or "t"."code" = "s"."code")`,
+				`insert into "t"("id", "code", "name") values (1, 'a', 'x'), (:v1, :v2, :v3)`,
+			},
+			args:    []interface{}{2, "b", "y"},
+			outArgs: []interface{}{2, "b", "y"},
+		},
+		// 没有指定列时按表的列补充
+		{
+			in: "replace into t values (1, 'a', now())",
+			out: []string{
+				`delete from "t" as "t" where exists (select 1 from (select 1, 'a', sysdate from dual) "s" ("id", "code", "name") where "t"."id" = "s"."id" or "t"."code" = "s"."code")`,
+				`insert into "t"("id", "code", "name") values (1, 'a', sysdate)`,
+			},
+		},
+		{
+			in: "insert ignore into t (id, name) values (?, ?)",
+			out: []string{
+				`merge into "t" as "t" using (select :v1, :v2 from dual) "s" ("id", "name") on "t"."id" = "s"."id" when not matched then insert ("id", "name") values ("s"."id", "s"."name")`,
+			},
+			args:    []interface{}{1, "x"},
+			outArgs: []interface{}{1, "x"},
+		},
+		// insert ... select的查询作为using的虚拟表
+		{
+			in: "replace into t (id, code, name) select id, code, name from b where id > ? limit 10",
+			out: []string{
+				`delete from "t" as "t" where exists (select 1 from (select "id", "code", "name" from "b" where "id" > :v1 fetch first 10 rows only) "s" ("id", "code", "name") where "t"."id" = "s"."id" or "t"."code" = "s"."code")`,
+				`insert into "t"("id", "code", "name") select "id", "code", "name" from "b" where "id" > :v1 fetch first 10 rows only`,
+			},
+			args:    []interface{}{5},
+			outArgs: []interface{}{5},
+		},
+		{
+			in: "insert ignore into t (id, name) select id, name from b",
+			out: []string{
+				`merge into "t" as "t" using (select "id", "name" from "b") "s" ("id", "name") on "t"."id" = "s"."id" when not matched then insert ("id", "name") values ("s"."id", "s"."name")`,
+			},
+		},
+		{
+			in:  "insert ignore into t (name) values ('x')",
+			err: ErrNoUniqueKey,
+		},
+		// 与任意一个唯一索引的值相同的行都不能在一条语句中替换或忽略，NULL不冲突
+		{
+			in:  "replace into t (id, code, name) values (1, 'a', 'x'), (2, 'a', 'y')",
+			err: ErrDuplicateKeyRows,
+		},
+		{
+			in:   "insert ignore into t (id, name) values (?, ?), (?, ?)",
+			args: []interface{}{1, "x", 1, "y"},
+			err:  ErrDuplicateKeyRows,
+		},
+		{
+			in: "insert ignore into t (id, code) values (1, null), (2, null)",
+			out: []string{
+				`merge into "t" as "t" using (select 1, null from dual union all select 2, null from dual) "s" ("id", "code") on "t"."id" = "s"."id" or "t"."code" = "s"."code" when not matched then insert ("id", "code") values ("s"."id", "s"."code")`,
+			},
+		},
+		{
+			in:  "replace into u (id) values (1)",
+			err: ErrNoUniqueKey,
+		},
+		{
+			in:  "insert into u (id) values (1) on duplicate key update id = 2",
+			err: ErrNoUniqueKey,
+		},
+	}
+
+	converter := NewOracleConverter(
+		map[string]map[string][]string{
+			"t": {"PRIMARY": {"id"}, "uk_code": {"code"}},
+		},
+		map[string][]string{
+			"t": {"id", "code", "name"},
+		},
+		nil,
+	)
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			oSql, args, err := converter.Convert(tcase.in, tcase.args...)
+			if tcase.err != nil {
+				assert.True(t, errors.Is(err, tcase.err), "%v", err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, oSql)
+			assert.Equal(t, tcase.outArgs, args)
+		})
+	}
+}
+
+func TestConvertOnDuplicateKeyUpdate(t *testing.T) {
+	testCases := []struct {
+		in      string
+		out     []string
+		args    []interface{}
+		outArgs []interface{}
+		err     error
+	}{
+		// 多行插入，values(col)引用每一行插入的值，先查询值改变的行数再merge
+		{
+			in: "insert into stat (day, uid, cnt, note) values ('2024-01-01', 1, 2, 'a'), ('2024-01-01', 2, 3, 'b') on duplicate key update cnt = cnt + values(cnt), note = values(note)",
+			out: []string{
+				`select count(*) as "affected_rows__" from "stat" as "t", (select '2024-01-01', 1, 2, 'a' from dual union all select '2024-01-01', 2, 3, 'b' from dual) "s" ("day", "uid", "cnt", "note") where "t"."day" = "s"."day" and "t"."uid" = "s"."uid" and (decode("t"."cnt", "t"."cnt" + "s"."cnt", 0, 1) = 1 or decode("t"."note", "s"."note", 0, 1) = 1)`,
+				`merge into "stat" as "t" using (select '2024-01-01', 1, 2, 'a' from dual union all select '2024-01-01', 2, 3, 'b' from dual) "s" ("day", "uid", "cnt", "note") on "t"."day" = "s"."day" and "t"."uid" = "s"."uid" when matched then update set "t"."cnt" = "t"."cnt" + "s"."cnt", "t"."note" = "s"."note" when not matched then insert ("day", "uid", "cnt", "note") values ("s"."day", "s"."uid", "s"."cnt", "s"."note")`,
+			},
+		},
+		{
+			in: "insert into stat (day, uid, cnt) values (?, ?, ?), (?, ?, ?) on duplicate key update cnt = cnt + values(cnt), note = null, updated = ?",
+			out: []string{
+				`select count(*) as "affected_rows__" from "stat" as "t", (select :v1, :v2, :v3 from dual union all select :v4, :v5, :v6 from dual) "s" ("day", "uid", "cnt") where "t"."day" = "s"."day" and "t"."uid" = "s"."uid" and (decode("t"."cnt", "t"."cnt" + "s"."cnt", 0, 1) = 1 or decode("t"."note", null, 0, 1) = 1 or decode("t"."updated", :v7, 0, 1) = 1)`,
+				`merge into "stat" as "t" using (select :v1, :v2, :v3 from dual union all select :v4, :v5, :v6 from dual) "s" ("day", "uid", "cnt") on "t"."day" = "s"."day" and "t"."uid" = "s"."uid" when matched then update set "t"."cnt" = "t"."cnt" + "s"."cnt", "t"."note" = null, "t"."updated" = :v7 when not matched then insert ("day", "uid", "cnt") values ("s"."day", "s"."uid", "s"."cnt")`,
+			},
+			args:    []interface{}{"d", 1, 2, "d", 2, 3, "now"},
+			outArgs: []interface{}{"d", 1, 2, "d", 2, 3, "now"},
+		},
+		// 唯一索引的列赋值为values(col)时值不变，merge不能修改on条件中的列
+		{
+			in: "insert into stat (day, uid, cnt) values ('2024-01-01', 1, 2) on duplicate key update day = values(day), uid = values(uid), cnt = values(cnt)",
+			out: []string{
+				`select count(*) as "affected_rows__" from "stat" as "t", (select '2024-01-01', 1, 2 from dual) "s" ("day", "uid", "cnt") where "t"."day" = "s"."day" and "t"."uid" = "s"."uid" and decode("t"."cnt", "s"."cnt", 0, 1) = 1`,
+				`merge into "stat" as "t" using (select '2024-01-01', 1, 2 from dual) "s" ("day", "uid", "cnt") on "t"."day" = "s"."day" and "t"."uid" = "s"."uid" when matched then update set "t"."cnt" = "s"."cnt" when not matched then insert ("day", "uid", "cnt") values ("s"."day", "s"."uid", "s"."cnt")`,
+			},
+		},
+		// insert ... select的查询作为using的虚拟表
+		{
+			in: "insert into stat (day, uid, cnt) select day, uid, cnt from daily where day = ? on duplicate key update cnt = cnt + values(cnt)",
+			out: []string{
+				`select count(*) as "affected_rows__" from "stat" as "t", (select "day", "uid", "cnt" from "daily" where "day" = :v1) "s" ("day", "uid", "cnt") where "t"."day" = "s"."day" and "t"."uid" = "s"."uid" and decode("t"."cnt", "t"."cnt" + "s"."cnt", 0, 1) = 1`,
+				`merge into "stat" as "t" using (select "day", "uid", "cnt" from "daily" where "day" = :v1) "s" ("day", "uid", "cnt") on "t"."day" = "s"."day" and "t"."uid" = "s"."uid" when matched then update set "t"."cnt" = "t"."cnt" + "s"."cnt" when not matched then insert ("day", "uid", "cnt") values ("s"."day", "s"."uid", "s"."cnt")`,
+			},
+			args:    []interface{}{"d"},
+			outArgs: []interface{}{"d"},
+		},
+		{
+			in:  "insert into stat (day, uid) values ('2024-01-01', 1) on duplicate key update uid = values(uid)",
+			out: []string{`merge into "stat" as "t" using (select '2024-01-01', 1 from dual) "s" ("day", "uid") on "t"."day" = "s"."day" and "t"."uid" = "s"."uid" when not matched then insert ("day", "uid") values ("s"."day", "s"."uid")`},
+		},
+		// 查询值改变的行数时同样转换函数
+		{
+			in: "insert into stat (day, uid, cnt) values ('2024-01-01', 1, 2) on duplicate key update note = concat(note, 'x'), updated = now()",
+			out: []string{
+				`select count(*) as "affected_rows__" from "stat" as "t", (select '2024-01-01', 1, 2 from dual) "s" ("day", "uid", "cnt") where "t"."day" = "s"."day" and "t"."uid" = "s"."uid" and (decode("t"."note", case when "t"."note" is null then null else "t"."note" || 'x' end, 0, 1) = 1 or decode("t"."updated", sysdate, 0, 1) = 1)`,
+				`merge into "stat" as "t" using (select '2024-01-01', 1, 2 from dual) "s" ("day", "uid", "cnt") on "t"."day" = "s"."day" and "t"."uid" = "s"."uid" when matched then update set "t"."note" = case when "t"."note" is null then null else "t"."note" || 'x' end, "t"."updated" = sysdate when not matched then insert ("day", "uid", "cnt") values ("s"."day", "s"."uid", "s"."cnt")`,
+			},
+		},
+		// 没有插入的列的values(col)是列的默认值
+		{
+			in:  "insert into stat (day, uid, cnt) values ('2024-01-01', 1, 2) on duplicate key update cnt = cnt + values(cnt), note = values(note)",
+			err: ErrValuesNotInserted,
+		},
+		// MySQL逐行插入，后面的行更新前面插入的行，merge不能匹配using中唯一索引的值相同的多行
+		{
+			in:  "insert into stat (day, uid, cnt) values ('2024-01-01', 1, 2), ('2024-01-01', 1, 3) on duplicate key update cnt = cnt + values(cnt)",
+			err: ErrDuplicateKeyRows,
+		},
+		{
+			in:   "insert into stat (day, uid, cnt) values (?, ?, ?), (?, ?, ?) on duplicate key update cnt = cnt + values(cnt)",
+			args: []interface{}{"d", 1, 2, "d", 1, 3},
+			err:  ErrDuplicateKeyRows,
+		},
+	}
+
+	converter := NewOracleConverter(
+		map[string]map[string][]string{
+			"stat": {"uk_day_uid": {"day", "uid"}},
+		},
+		nil,
+		nil,
+	)
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			oSql, args, err := converter.Convert(tcase.in, tcase.args...)
+			if tcase.err != nil {
+				assert.True(t, errors.Is(err, tcase.err), "%v", err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, oSql)
+			assert.Equal(t, tcase.outArgs, args)
+		})
+	}
+}
+
+func TestConvertAlterTable(t *testing.T) {
+	testCases := []struct {
+		in  string
+		out []string
+	}{
+		{
+			in:  "alter table t modify column a int not null",
+			out: []string{`alter table "t" modify "a" int not null`},
+		},
+		// change拆分为重命名列和修改列，列注释单独设置
+		{
+			in: "ALTER TABLE `db`.`t` CHANGE COLUMN `a` `b` varchar(20) NOT NULL DEFAULT '' COMMENT 'name' AFTER `c`",
+			out: []string{
+				`alter table "db"."t" rename column "a" to "b"`,
+				`alter table "db"."t" modify "b" varchar(20 CHAR) not null default ''`,
+				`comment on column "db"."t"."b" is 'name'`,
+			},
+		},
+		{
+			in: "alter table t add column a int, add index idx (a(10), b), add unique key (c), add constraint uk unique (d, e)",
+			out: []string{
+				`alter table "t" add column "a" int`,
+				`create index "idx" on "t" ("a", "b")`,
+				`create unique index "t_c" on "t" ("c")`,
+				`create unique index "uk" on "t" ("d", "e")`,
+			},
+		},
+		{
+			in: "alter table t add column (a int auto_increment, b text comment 'x'), add primary key (a)",
+			out: []string{
+				`alter table "t" add column "a" int IDENTITY(1,1)`,
+				`alter table "t" add column "b" text`,
+				`comment on column "t"."b" is 'x'`,
+				`alter table "t" add primary key ("a")`,
+			},
+		},
+		{
+			in: "alter table t drop index idx, drop primary key, drop foreign key fk_a, drop column c, drop d",
+			out: []string{
+				`drop index "idx"`,
+				`alter table "t" drop primary key`,
+				`alter table "t" drop constraint "fk_a"`,
+				`alter table "t" drop column "c"`,
+				`alter table "t" drop column "d"`,
+			},
+		},
+		{
+			in: "alter table t rename column a to b, rename index i1 to i2, rename to t2",
+			out: []string{
+				`alter table "t" rename column "a" to "b"`,
+				`alter index "i1" rename to "i2"`,
+				`alter table "t" rename to "t2"`,
+			},
+		},
+		{
+			in:  "rename table a to b",
+			out: []string{`alter table "a" rename to "b"`},
+		},
+		{
+			in: "alter table t alter column a set default 1, alter b drop default, alter column c set default current_timestamp",
+			out: []string{
+				`alter table "t" modify "a" default 1`,
+				`alter table "t" modify "b" default null`,
+				`alter table "t" modify "c" default sysdate`,
+			},
+		},
+		// 只保留表注释，其他表选项去掉
+		{
+			in:  "alter table t engine=innodb comment='it''s'",
+			out: []string{`comment on table "t" is 'it''s'`},
+		},
+		{
+			in:  "alter table t add fulltext index ft (`a`)",
+			out: []string{`alter table "t" add fulltext index ft ("a")`},
+		},
+	}
+
+	converter := NewOracleConverter(nil, nil, nil)
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			oSql, _, err := converter.Convert(tcase.in)
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, oSql)
+		})
+	}
+
+	_, _, err := converter.Convert("alter table t modify")
+	assert.NotNil(t, err)
+}
+
+func TestConvertAlterTableKeys(t *testing.T) {
+	converter := NewOracleConverter(
+		map[string]map[string][]string{
+			"t": {"uk_code": {"code"}},
+		},
+		map[string][]string{
+			"t": {"code", "name"},
+		},
+		nil,
+	)
+	testCases := []struct {
+		in         string
+		out        []string
+		indexs     map[string][]string
+		increments map[string]int
+	}{
+		{
+			in: "alter table t add column id int auto_increment, add primary key (id), add unique key uk_name (name), add email varchar(20) unique",
+			out: []string{
+				`alter table "t" add column "id" int IDENTITY(1,1)`,
+				`alter table "t" add primary key ("id")`,
+				`create unique index "uk_name" on "t" ("name")`,
+				`alter table "t" add column "email" varchar(20 CHAR)`,
+				`create unique index "t_email" on "t" ("email")`,
+			},
+			indexs:     map[string][]string{"PRIMARY": {"id"}, "uk_code": {"code"}, "uk_name": {"name"}, "t_email": {"email"}},
+			increments: map[string]int{"id": 2},
+		},
+		{
+			in: "alter table t drop index uk_code, rename index uk_name to uk_n, change id no int auto_increment, drop email",
+			out: []string{
+				`drop index "uk_code"`,
+				`alter index "uk_name" rename to "uk_n"`,
+				`alter table "t" rename column "id" to "no"`,
+				`alter table "t" modify "no" int IDENTITY(1,1)`,
+				`alter table "t" drop column "email"`,
+			},
+			indexs:     map[string][]string{"PRIMARY": {"no"}, "uk_n": {"name"}},
+			increments: map[string]int{"no": 2},
+		},
+		{
+			in:         "alter table t drop primary key, drop column no",
+			out:        []string{`alter table "t" drop primary key`, `alter table "t" drop column "no"`},
+			indexs:     map[string][]string{"uk_n": {"name"}},
+			increments: nil,
+		},
+	}
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			oSql, _, err := converter.Convert(tcase.in)
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, oSql)
+			assert.Equal(t, tcase.indexs, converter.uniqueIndexs("t"))
+			assert.Equal(t, tcase.increments, converter.tableIncrementColumns("t"))
+		})
+	}
+}
+
+func TestConvertCreateTable(t *testing.T) {
+	testCases := []struct {
+		in  string
+		out []string
+	}{
+		{
+			in: "CREATE TABLE `network` (\n  `id` bigint(20) NOT NULL AUTO_INCREMENT COMMENT 'it''s id',\n  `network_id` varchar(191) NOT NULL,\n  `user_phone` char(16) NOT NULL,\n  PRIMARY KEY (`id`),\n  UNIQUE KEY `uk_network_id` (`network_id`),\n  KEY (`user_phone`(8)),\n  FULLTEXT KEY ft (network_id),\n  CONSTRAINT `fk_user` FOREIGN KEY (`user_phone`) REFERENCES `db`.`user` (`phone`) ON DELETE CASCADE\n) COMMENT '网络表' ENGINE=InnoDB AUTO_INCREMENT=7 DEFAULT CHARSET=utf8mb4;",
+			out: []string{
+				"create table \"network\" (\n\t\"id\" bigint not null IDENTITY(7,1),\n\t\"network_id\" varchar(191 CHAR) not null,\n\t\"user_phone\" char(16) not null,\n\tprimary key (\"id\")\n)",
+				`create unique index "uk_network_id" on "network" ("network_id")`,
+				`create index "network_user_phone" on "network" ("user_phone")`,
+				`comment on table "network" is '网络表'`,
+				`comment on column "network"."id" is 'it''s id'`,
+				`alter table "network" add constraint "fk_user" foreign key ("user_phone") references "db"."user" ("phone") on delete cascade`,
+			},
+		},
+		// 主键约束和没有名字的唯一索引
+		{
+			in: "create table t (id int, name varchar(10), constraint pk primary key (id), unique (name), index idx using btree (id, name))",
+			out: []string{
+				"create table \"t\" (\n\t\"id\" int,\n\t\"name\" varchar(10 CHAR),\n\tprimary key (\"id\")\n)",
+				`create unique index "t_name" on "t" ("name")`,
+				`create index "idx" on "t" ("id", "name")`,
+			},
+		},
+		{
+			in:  "create table t (id int primary key)",
+			out: []string{"create table \"t\" (\n\t\"id\" int PRIMARY KEY\n)"},
+		},
+		{
+			in:  "alter table `t` add CONSTRAINT `fk_user` FOREIGN KEY (`phone`) REFERENCES `user` (`phone`) on update no action",
+			out: []string{`alter table "t" add constraint "fk_user" foreign key ("phone") references "user" ("phone") on update no action`},
+		},
+	}
+
+	converter := NewOracleConverter(nil, nil, nil)
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			oSql, _, err := converter.Convert(tcase.in)
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, oSql)
+		})
+	}
+}
+
+func TestConvertCreateTableKeys(t *testing.T) {
+	converter := NewOracleConverter(nil, nil, nil)
+	unit, meta, err := converter.ConvertUnit("create table t9 (id int auto_increment primary key, name varchar(10), code int unique, unique key uk(name))", true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"create table \"t9\" (\n\t\"id\" int PRIMARY KEY IDENTITY(1,1),\n\t\"name\" varchar(10 CHAR),\n\t\"code\" int\n)",
+		`create unique index "t9_code" on "t9" ("code")`,
+		`create unique index "uk" on "t9" ("name")`,
+	}, []string{unit[0].SQL, unit[1].SQL, unit[2].SQL})
+
+	// 建表语句执行成功之前没有唯一索引
+	_, _, err = converter.Convert("insert ignore into t9 (name) values ('a')")
+	assert.True(t, errors.Is(err, ErrNoUniqueKey))
+	meta.Apply()
+
+	testCases := []struct {
+		in  string
+		out []string
+	}{
+		{
+			in: "insert ignore into t9 (name) values ('a')",
+			out: []string{
+				`merge into "t9" as "t" using (select 'a' from dual) "s" ("name") on "t"."name" = "s"."name" when not matched then insert ("name") values ("s"."name")`,
+				`select scope_identity() as "insert_id__" from dual`,
+			},
+		},
+		{
+			in: "replace into t9 (id, name) values (1, 'a')",
+			out: []string{
+				`set identity_insert "t9" on`,
+				`delete from "t9" as "t" where exists (select 1 from (select 1, 'a' from dual) "s" ("id", "name") where "t"."id" = "s"."id" or "t"."name" = "s"."name")`,
+				`insert into "t9"("id", "name") values (1, 'a')`,
+				`set identity_insert "t9" off`,
+			},
+		},
+		{
+			in: "insert into t9 (id, name) values (5, 'a')",
+			out: []string{
+				`set identity_insert "t9" on`,
+				`insert into "t9"("id", "name") values (5, 'a')`,
+				`set identity_insert "t9" off`,
+			},
+		},
+	}
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			oSql, _, err := converter.Convert(tcase.in)
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, oSql)
+		})
+	}
+}
+
+func TestConvertOnUpdateCurrentTimestamp(t *testing.T) {
+	testCases := []struct {
+		in  string
+		out []string
+	}{
+		{
+			in: "create table `db`.`t` (id int primary key, updated_at datetime not null default current_timestamp on update current_timestamp)",
+			out: []string{
+				"create table \"db\".\"t\" (\n\t\"id\" int PRIMARY KEY,\n\t\"updated_at\" timestamp not null default CURRENT_TIMESTAMP\n)",
+				`create or replace trigger "db"."t_updated_at_on_update" before update on "db"."t" for each row begin if not updating('updated_at') and (decode(:new."id", :old."id", 0, 1) = 1) then :new."updated_at" := systimestamp; end if; end;`,
+			},
+		},
+		// 有触发器的表不需要设置
+		{
+			in:  "update t set a = 1",
+			out: []string{`update "t" set "a" = 1`},
+		},
+		// 配置的没有触发器的列只在值改变时设置，已经set的列不变
+		{
+			in:  "update u set a = 1, mtime = now()",
+			out: []string{`update "u" set "a" = 1, "mtime" = sysdate, "Updated_At" = case when (decode("a", 1, 0, 1) = 1 or decode("mtime", sysdate, 0, 1) = 1) then systimestamp else "Updated_At" end`},
+		},
+		{
+			in:  "update u join v on u.id = v.id set u.a = v.a",
+			out: []string{`merge into "u" using (select "u".rowid as "rid__", max("v"."a") as "v1__", max(case when decode("u"."a", "v"."a", 0, 1) = 1 then systimestamp else "u"."mtime" end) as "v2__", max(case when decode("u"."a", "v"."a", 0, 1) = 1 then systimestamp else "u"."Updated_At" end) as "v3__" from "u" join "v" on "u"."id" = "v"."id" group by "u".rowid) as "s__" on ("u".rowid = "s__"."rid__") when matched then update set "u"."a" = "s__"."v1__", "u"."mtime" = "s__"."v2__", "u"."Updated_At" = "s__"."v3__"`},
+		},
+		// 重命名列和修改列时重建触发器
+		{
+			in: "alter table t change updated_at mtime timestamp, add column m2 timestamp on update current_timestamp",
+			out: []string{
+				`drop trigger if exists "t_updated_at_on_update"`,
+				`alter table "t" rename column "updated_at" to "mtime"`,
+				`alter table "t" modify "mtime" timestamp`,
+				`drop trigger if exists "t_mtime_on_update"`,
+				`alter table "t" add column "m2" timestamp`,
+				`create or replace trigger "t_m2_on_update" before update on "t" for each row begin if not updating('m2') and (decode(:new."id", :old."id", 0, 1) = 1 or decode(:new."mtime", :old."mtime", 0, 1) = 1) then :new."m2" := systimestamp; end if; end;`,
+			},
+		},
+		{
+			in: "alter table t rename column m2 to m3, drop column m3",
+			out: []string{
+				`drop trigger if exists "t_m2_on_update"`,
+				`alter table "t" rename column "m2" to "m3"`,
+				`drop trigger if exists "t_m3_on_update"`,
+				`alter table "t" drop column "m3"`,
+			},
+		},
+		// 增加列时重建其它列的触发器
+		{
+			in: "alter table t add column m4 timestamp on update current_timestamp",
+			out: []string{
+				`alter table "t" add column "m4" timestamp`,
+				`create or replace trigger "t_m4_on_update" before update on "t" for each row begin if not updating('m4') and (decode(:new."id", :old."id", 0, 1) = 1 or decode(:new."mtime", :old."mtime", 0, 1) = 1) then :new."m4" := systimestamp; end if; end;`,
+			},
+		},
+		{
+			in: "alter table t add column b int",
+			out: []string{
+				`alter table "t" add column "b" int`,
+				`create or replace trigger "t_m4_on_update" before update on "t" for each row begin if not updating('m4') and (decode(:new."id", :old."id", 0, 1) = 1 or decode(:new."mtime", :old."mtime", 0, 1) = 1 or decode(:new."b", :old."b", 0, 1) = 1) then :new."m4" := systimestamp; end if; end;`,
+			},
+		},
+		// 列未知的表只判断是否set了该列
+		{
+			in: "alter table w add column m timestamp on update current_timestamp",
+			out: []string{
+				`alter table "w" add column "m" timestamp`,
+				`create or replace trigger "w_m_on_update" before update on "w" for each row begin if not updating('m') then :new."m" := systimestamp; end if; end;`,
+			},
+		},
+	}
+
+	converter := NewOracleConverter(nil, nil, nil)
+	converter.SetOnUpdateColumns("u", []string{"Updated_At", "mtime"})
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			oSql, _, err := converter.Convert(tcase.in)
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, oSql)
+		})
+	}
+
+	// 生成的触发器执行成功之前update仍然设置该列
+	unit, meta, err := converter.ConvertUnit("alter table u modify mtime timestamp on update current_timestamp", true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(unit))
+	oSql, _, err := converter.Convert("update u set a = 1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`update "u" set "a" = 1, "mtime" = case when decode("a", 1, 0, 1) = 1 then systimestamp else "mtime" end, "Updated_At" = case when decode("a", 1, 0, 1) = 1 then systimestamp else "Updated_At" end`}, oSql)
+	meta.Apply()
+	oSql, _, err = converter.Convert("update u set a = 1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`update "u" set "a" = 1, "Updated_At" = case when decode("a", 1, 0, 1) = 1 then systimestamp else "Updated_At" end`}, oSql)
+}
+
+func TestConvertEnumSet(t *testing.T) {
+	testCases := []struct {
+		in  string
+		out []string
+	}{
+		{
+			in: "create table t (id int primary key, state enum('new','it''s','完成') not null default 'new', tags set('a','b.c'))",
+			out: []string{
+				"create table \"t\" (\n\t\"id\" int PRIMARY KEY,\n" +
+					"\t\"state\" varchar(4 CHAR) not null default 'new' constraint \"t_state_enum\" check (\"state\" in ('new', 'it''s', '完成')),\n" +
+					"\t\"tags\" varchar(5 CHAR) constraint \"t_tags_set\" check (\"tags\" = '' or regexp_like(\"tags\", '^(a|b\\.c)(,(a|b\\.c))*$'))\n)",
+			},
+		},
+		// 修改列时先删除原来的约束
+		{
+			in: "alter table t modify state enum('new','done') default 'done', change tags labels set('x') after id",
+			out: []string{
+				`alter table "t" drop constraint "t_state_enum"`,
+				`alter table "t" modify "state" varchar(4 CHAR) default 'done'`,
+				`alter table "t" add constraint "t_state_enum" check ("state" in ('new', 'done'))`,
+				`alter table "t" rename column "tags" to "labels"`,
+				`alter table "t" drop constraint "t_tags_set"`,
+				`alter table "t" modify "labels" varchar(1 CHAR)`,
+				`alter table "t" add constraint "t_labels_set" check ("labels" = '' or regexp_like("labels", '^(x)(,(x))*$'))`,
+			},
+		},
+		{
+			in: "alter table t modify state varchar(10), drop column labels",
+			out: []string{
+				`alter table "t" drop constraint "t_state_enum"`,
+				`alter table "t" modify "state" varchar(10 CHAR)`,
+				`alter table "t" drop constraint "t_labels_set"`,
+				`alter table "t" drop column "labels"`,
+			},
+		},
+	}
+
+	converter := NewOracleConverter(nil, nil, nil)
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			oSql, _, err := converter.Convert(tcase.in)
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, oSql)
+			if i == 0 {
+				enum, ok := converter.LookupEnumColumn("t", "STATE")
+				assert.True(t, ok)
+				assert.Equal(t, EnumColumn{Type: "enum", Check: "t_state_enum"}, enum)
+			}
+		})
+	}
+	_, ok := converter.LookupEnumColumn("t", "state")
+	assert.False(t, ok)
+
+	// 约束添加成功之前不记录
+	_, meta, err := converter.ConvertUnit("alter table t modify state enum('a')", true)
+	assert.Nil(t, err)
+	_, ok = converter.LookupEnumColumn("t", "state")
+	assert.False(t, ok)
+	meta.Apply()
+	_, ok = converter.LookupEnumColumn("t", "state")
+	assert.True(t, ok)
+}
+
+func TestConvertIdentityInsert(t *testing.T) {
+	testCases := []struct {
+		in      string
+		out     []string
+		args    []interface{}
+		outArgs []interface{}
+	}{
+		// NULL和0由数据库生成，去掉自增列
+		{
+			in: "insert into t (id, name) values (null, 'a'), (0, ?), (?, ?)",
+			out: []string{
+				`insert into "t"("name") values ('a'), (:v1), (:v2)`,
+				`select scope_identity() - 2 as "insert_id__" from dual`,
+			},
+			args:    []interface{}{"b", nil, "c"},
+			outArgs: []interface{}{"b", "c"},
+		},
+		// 指定了值时保留自增列
+		{
+			in: "insert into t values (?, ?)",
+			out: []string{
+				`set identity_insert "t" on`,
+				`insert into "t"("id", "name") values (:v1, :v2)`,
+				`set identity_insert "t" off`,
+			},
+			args:    []interface{}{int64(10), "a"},
+			outArgs: []interface{}{int64(10), "a"},
+		},
+		{
+			in: "insert into db.t (id, name) values (3, 'a'), (default, 'b'), ('0', 'c')",
+			out: []string{
+				`set identity_insert "db"."t" on`,
+				`insert into "db"."t"("id", "name") values (3, 'a')`,
+				`set identity_insert "db"."t" off`,
+				`insert into "db"."t"("name") values ('b'), ('c')`,
+				`select scope_identity() - 1 as "insert_id__" from dual`,
+			},
+		},
+		{
+			in: "insert into t (id, name) values (3, 'a') on duplicate key update name = values(name)",
+			out: []string{
+				`set identity_insert "t" on`,
+				`select count(*) as "affected_rows__" from "t" as "t", (select 3, 'a' from dual) "s" ("id", "name") where "t"."id" = "s"."id" and decode("t"."name", "s"."name", 0, 1) = 1`,
+				`merge into "t" as "t" using (select 3, 'a' from dual) "s" ("id", "name") on "t"."id" = "s"."id" when matched then update set "t"."name" = "s"."name" when not matched then insert ("id", "name") values ("s"."id", "s"."name")`,
+				`set identity_insert "t" off`,
+			},
+		},
+		// insert ... select插入自增列时按指定值处理
+		{
+			in: "insert into t (id, name) select id, name from b where id > ?",
+			out: []string{
+				`set identity_insert "t" on`,
+				`insert into "t"("id", "name") select "id", "name" from "b" where "id" > :v1`,
+				`set identity_insert "t" off`,
+			},
+			args:    []interface{}{int64(5)},
+			outArgs: []interface{}{int64(5)},
+		},
+		{
+			in: "insert into t select * from b",
+			out: []string{
+				`set identity_insert "t" on`,
+				`insert into "t"("id", "name") select * from "b"`,
+				`set identity_insert "t" off`,
+			},
+		},
+		{
+			in: "insert into t (name) select name from b",
+			out: []string{
+				`insert into "t"("name") select "name" from "b"`,
+				`select scope_identity() as "insert_id__" from dual`,
+			},
+		},
+	}
+
+	converter := NewOracleConverter(
+		map[string]map[string][]string{
+			"t": {"PRIMARY": {"id"}},
+		},
+		map[string][]string{
+			"t": {"id", "name"},
+		},
+		map[string]map[string]int{
+			"t": {"id": 1},
+		},
+	)
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			oSql, args, err := converter.Convert(tcase.in, tcase.args...)
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, oSql)
+			assert.Equal(t, tcase.outArgs, args)
+		})
+	}
+
+	// 两条insert各自引用自己的行中的参数
+	unit, _, err := converter.ConvertUnit("insert into t (id, name) values (?, ?), (?, ?), (?, 'c')", true, int64(5), "a", 0, "b", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []ConvertedStmt{
+		{SQL: `set identity_insert "t" on`, Args: []interface{}{}},
+		{SQL: `insert into "t"("id", "name") values (:v1, :v2)`, Args: []interface{}{int64(5), "a"}, RowsFactor: 1},
+		{SQL: `set identity_insert "t" off`, Args: []interface{}{}},
+		{SQL: `insert into "t"("name") values (:v1), ('c')`, Args: []interface{}{"b"}, RowsFactor: 1},
+		{SQL: `select scope_identity() - 1 as "insert_id__" from dual`, Args: []interface{}{}},
+	}, unit)
+}
+
+func TestConvertAffectedRows(t *testing.T) {
+	testCases := []struct {
+		in        string
+		foundRows bool
+		args      []interface{}
+		out       []ConvertedStmt
+	}{
+		// 查询生成的自增ID，不计入影响行数
+		{
+			in:        "insert into t (name) values (?)",
+			foundRows: true,
+			args:      []interface{}{"a"},
+			out: []ConvertedStmt{
+				{SQL: `insert into "t"("name") values (:v1)`, Args: []interface{}{"a"}, RowsFactor: 1},
+				{SQL: `select scope_identity() as "insert_id__" from dual`, Args: []interface{}{}},
+			},
+		},
+		// 值改变的行由查询再计一次，有CLIENT_FOUND_ROWS时值不变的行也由merge计入
+		{
+			in:        "insert into t (id, name) values (?, ?) on duplicate key update name = ?",
+			foundRows: true,
+			args:      []interface{}{int64(1), "a", "b"},
+			out: []ConvertedStmt{
+				{SQL: `set identity_insert "t" on`, Args: []interface{}{}},
+				{SQL: `select count(*) as "affected_rows__" from "t" as "t", (select :v1, :v2 from dual) "s" ("id", "name") where "t"."id" = "s"."id" and decode("t"."name", :v3, 0, 1) = 1`, Args: []interface{}{int64(1), "a", "b"}, RowsFactor: 1},
+				{SQL: `merge into "t" as "t" using (select :v1, :v2 from dual) "s" ("id", "name") on "t"."id" = "s"."id" when matched then update set "t"."name" = :v3 when not matched then insert ("id", "name") values ("s"."id", "s"."name")`, Args: []interface{}{int64(1), "a", "b"}, RowsFactor: 1},
+				{SQL: `set identity_insert "t" off`, Args: []interface{}{}},
+			},
+		},
+		// 没有CLIENT_FOUND_ROWS时不更新值不变的行
+		{
+			in:   "insert into t (id, name) values (?, ?) on duplicate key update name = ?",
+			args: []interface{}{int64(1), "a", "b"},
+			out: []ConvertedStmt{
+				{SQL: `set identity_insert "t" on`, Args: []interface{}{}},
+				{SQL: `select count(*) as "affected_rows__" from "t" as "t", (select :v1, :v2 from dual) "s" ("id", "name") where "t"."id" = "s"."id" and decode("t"."name", :v3, 0, 1) = 1`, Args: []interface{}{int64(1), "a", "b"}, RowsFactor: 1},
+				{SQL: `merge into "t" as "t" using (select :v1, :v2 from dual) "s" ("id", "name") on "t"."id" = "s"."id" when matched then update set "t"."name" = :v3 where decode("t"."name", :v4, 0, 1) = 1 when not matched then insert ("id", "name") values ("s"."id", "s"."name")`, Args: []interface{}{int64(1), "a", "b", "b"}, RowsFactor: 1},
+				{SQL: `set identity_insert "t" off`, Args: []interface{}{}},
+			},
+		},
+		// 没有CLIENT_FOUND_ROWS时update只更新值改变的行
+		{
+			in:   "update t set name = ? where id = ?",
+			args: []interface{}{"a", int64(1)},
+			out: []ConvertedStmt{
+				{SQL: `update "t" set "name" = :v1 where "id" = :v2 and decode("name", :v3, 0, 1) = 1`, Args: []interface{}{"a", int64(1), "a"}, RowsFactor: 1},
+			},
+		},
+		{
+			in:        "update t set name = ? where id = ?",
+			foundRows: true,
+			args:      []interface{}{"a", int64(1)},
+			out: []ConvertedStmt{
+				{SQL: `update "t" set "name" = :v1 where "id" = :v2`, Args: []interface{}{"a", int64(1)}, RowsFactor: 1},
+			},
+		},
+		// MySQL的limit按匹配的行计数，先取前count行的rowid再判断值是否改变
+		{
+			in:   "update t set name = ? where id > ? limit 2",
+			args: []interface{}{"a", int64(1)},
+			out: []ConvertedStmt{
+				{SQL: `update "t" set "name" = :v1 where rowid in (select * from (select rowid from "t" where "id" > :v2) where rownum <= 2) and decode("name", :v3, 0, 1) = 1`, Args: []interface{}{"a", int64(1), "a"}, RowsFactor: 1},
+			},
+		},
+		{
+			in: "update t set name = 'a' order by id desc limit 1",
+			out: []ConvertedStmt{
+				{SQL: `update "t" set "name" = 'a' where rowid in (select * from (select rowid from "t" order by "id" desc) where rownum <= 1) and decode("name", 'a', 0, 1) = 1`, RowsFactor: 1},
+			},
+		},
+		{
+			in:        "update t set name = 'a' where id > 1 limit 2",
+			foundRows: true,
+			out: []ConvertedStmt{
+				{SQL: `update "t" set "name" = 'a' where "id" > 1 and rownum <= 2`, RowsFactor: 1},
+			},
+		},
+		{
+			in: "update t set name = null, note = note + 1",
+			out: []ConvertedStmt{
+				{SQL: `update "t" set "name" = null, "note" = "note" + 1 where (decode("name", null, 0, 1) = 1 or decode("note", "note" + 1, 0, 1) = 1)`, RowsFactor: 1},
+			},
+		},
+	}
+
+	converter := NewOracleConverter(
+		map[string]map[string][]string{
+			"t": {"PRIMARY": {"id"}},
+		},
+		map[string][]string{
+			"t": {"id", "name"},
+		},
+		map[string]map[string]int{
+			"t": {"id": 1},
+		},
+	)
+	for i, tcase := range testCases {
+		t.Run(fmt.Sprintf("testcase-%d", i+1), func(t *testing.T) {
+			unit, _, err := converter.ConvertUnit(tcase.in, tcase.foundRows, tcase.args...)
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.out, unit)
+		})
+	}
+}
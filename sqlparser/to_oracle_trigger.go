@@ -0,0 +1,154 @@
+package sqlparser
+
+import (
+	"sort"
+	"strings"
+)
+
+// 达梦没有on update current_timestamp，建表和修改列时为这样的列生成before update触发器，
+// 没有触发器的表在update时设置这些列。和MySQL一样只在其它列的值改变时设置为当前时间，
+// 使用systimestamp保留列的小数秒
+
+// onUpdateColumn is a column with ON UPDATE CURRENT_TIMESTAMP.
+type onUpdateColumn struct {
+	name    string
+	trigger bool // 目标库中已经有该列的触发器
+}
+
+// SetOnUpdateColumns records the columns with ON UPDATE CURRENT_TIMESTAMP of
+// a table which has no trigger for them in DM, for example a table migrated
+// without the triggers. The UPDATE statements of the table set the columns
+// to the current time.
+func (c *OracleConverter) SetOnUpdateColumns(table string, columns []string) {
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+	for _, col := range columns {
+		key := strings.ToLower(col)
+		if old, ok := c.onUpdateColumns[table][key]; ok && old.trigger {
+			continue
+		}
+		c.putOnUpdateColumn(table, onUpdateColumn{name: col})
+	}
+}
+
+func (c *OracleConverter) putOnUpdateColumn(table string, col onUpdateColumn) {
+	if c.onUpdateColumns == nil {
+		c.onUpdateColumns = make(map[string]map[string]onUpdateColumn)
+	}
+	if c.onUpdateColumns[table] == nil {
+		c.onUpdateColumns[table] = make(map[string]onUpdateColumn)
+	}
+	c.onUpdateColumns[table][strings.ToLower(col.name)] = col
+}
+
+// onUpdateTrigger 返回列的触发器并记录，之后的update不再设置该列
+func (t *tableMeta) onUpdateTrigger(table TableName, column ColIdent) *DmTrigger {
+	t.setOnUpdateTrigger(column)
+	return t.buildOnUpdateTrigger(table, column)
+}
+
+// setOnUpdateTrigger 记录列有触发器，修改表时在最后生成，参见recreateTriggers
+func (t *tableMeta) setOnUpdateTrigger(column ColIdent) {
+	if t.onUpdate == nil {
+		t.onUpdate = make(map[string]onUpdateColumn)
+	}
+	t.onUpdate[column.Lowered()] = onUpdateColumn{name: column.String(), trigger: true}
+}
+
+// buildOnUpdateTrigger 触发器比较表中其它列的值，表的列未知时只判断是否set了该列
+func (t *tableMeta) buildOnUpdateTrigger(table TableName, column ColIdent) *DmTrigger {
+	trigger := &DmTrigger{Action: CreateStr, Table: table, Column: column}
+	for _, name := range t.columns {
+		if !strings.EqualFold(name, column.String()) {
+			trigger.Columns = append(trigger.Columns, NewColIdent(name))
+		}
+	}
+	return trigger
+}
+
+// triggerColumns 返回表中有转换时生成的触发器的列，按列名排序
+func (t *tableMeta) triggerColumns() []ColIdent {
+	keys := make([]string, 0, len(t.onUpdate))
+	for key, col := range t.onUpdate {
+		if col.trigger {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	columns := make([]ColIdent, 0, len(keys))
+	for _, key := range keys {
+		columns = append(columns, NewColIdent(t.onUpdate[key].name))
+	}
+	return columns
+}
+
+// tableColumnNames 返回表的列名，先按表名查找，再忽略大小写查找，未知的表返回nil，
+// 返回的slice不能修改
+func (c *OracleConverter) tableColumnNames(table string) []string {
+	c.metaMu.RLock()
+	defer c.metaMu.RUnlock()
+	if cols, ok := c.tableColumns[table]; ok {
+		return cols
+	}
+	for name, cols := range c.tableColumns {
+		if strings.EqualFold(name, table) {
+			return cols
+		}
+	}
+	return nil
+}
+
+// dropOnUpdateColumn 列不再是on update列，返回是否有转换时生成的触发器
+func (t *tableMeta) dropOnUpdateColumn(column ColIdent) bool {
+	key := column.Lowered()
+	col, ok := t.onUpdate[key]
+	delete(t.onUpdate, key)
+	return ok && col.trigger
+}
+
+// convertUpdateOnUpdate 在set中加上表中没有触发器的on update列，已经set的列不变
+func (c *OracleConverter) convertUpdateOnUpdate(stmt *Update) {
+	target := updateTarget(stmt)
+	if target == nil {
+		return
+	}
+	c.metaMu.RLock()
+	defer c.metaMu.RUnlock()
+	cols := c.onUpdateColumns[target.Expr.(TableName).Name.String()]
+	if len(cols) == 0 {
+		return
+	}
+	var qualifier TableName
+	if isMultiTable(stmt.TableExprs) {
+		qualifier.Name = tableQualifier(target)
+	}
+	changed := changedExpr(stmt.Exprs)
+	keys := make([]string, 0, len(cols))
+	for key := range cols {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		col := cols[key]
+		if col.trigger || updateSets(stmt, key) {
+			continue
+		}
+		name := &ColName{Name: NewColIdent(col.name), Qualifier: qualifier}
+		stmt.Exprs = append(stmt.Exprs, &UpdateExpr{
+			Name: name,
+			Expr: &CaseExpr{
+				Whens: []*When{{Cond: changed, Val: Pseudocolumn(SystimestampStr)}},
+				Else:  CloneExpr(name),
+			},
+		})
+	}
+}
+
+func updateSets(stmt *Update, column string) bool {
+	for _, expr := range stmt.Exprs {
+		if expr.Name.Name.Lowered() == column {
+			return true
+		}
+	}
+	return false
+}
@@ -36,8 +36,23 @@ type TrackedBuffer struct {
 	*bytes.Buffer
 	bindLocations []bindLocation
 	nodeFormatter NodeFormatter
+	dialect       Dialect
 }
 
+// Dialect decides how TrackedBuffer quotes identifiers and writes string
+// literals.
+type Dialect int
+
+const (
+	// MySQLDialect quotes identifiers with backticks and escapes strings
+	// with backslashes.
+	MySQLDialect Dialect = iota
+	// OracleDialect quotes identifiers with double quotes, doubles the
+	// single quotes in strings without backslash escapes, and replaces the
+	// MySQL zero dates which DM/Oracle reject.
+	OracleDialect
+)
+
 // NewTrackedBuffer creates a new TrackedBuffer.
 func NewTrackedBuffer(nodeFormatter NodeFormatter) *TrackedBuffer {
 	return &TrackedBuffer{
@@ -46,6 +61,18 @@ func NewTrackedBuffer(nodeFormatter NodeFormatter) *TrackedBuffer {
 	}
 }
 
+// WithDialect sets the dialect of the buffer.
+func (buf *TrackedBuffer) WithDialect(dialect Dialect) *TrackedBuffer {
+	buf.dialect = dialect
+	return buf
+}
+
+// nodeString formats node in a new buffer of the same dialect, for the
+// nodes joined with other options as strings.
+func (buf *TrackedBuffer) nodeString(node SQLNode) string {
+	return NewTrackedBuffer(buf.nodeFormatter).WithDialect(buf.dialect).WriteNode(node).String()
+}
+
 // WriteNode function, initiates the writing of a single SQLNode tree by passing
 // through to Myprintf with a default format string
 func (buf *TrackedBuffer) WriteNode(node SQLNode) *TrackedBuffer {
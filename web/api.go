@@ -364,6 +364,22 @@ func (s *ApiServer) GetSlowLogTime(c echo.Context) error {
 	return c.JSON(http.StatusOK, time)
 }
 
+func (s *ApiServer) GetRewriteRules(c echo.Context) error {
+	rules := s.proxy.GetRewriteRules()
+	return c.JSON(http.StatusOK, rules)
+}
+
+func (s *ApiServer) ReloadRewriteRules(c echo.Context) error {
+	err := s.proxy.ReloadRewriteRules()
+	if err != nil {
+		if err == ksError.ErrNoRulesFile {
+			return c.JSON(http.StatusNotFound, err.Error())
+		}
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, "ok")
+}
+
 func (s *ApiServer) SaveProxyConfig(c echo.Context) error {
 	err := s.proxy.SaveProxyConfig()
 	if err != nil {
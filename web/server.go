@@ -106,6 +106,9 @@ func (s *ApiServer) RegisterURL() {
 	s.web.PUT("/api/v1/proxy/slow_sql/status", s.SwitchSlowSQL)
 	s.web.PUT("/api/v1/proxy/slow_sql/time", s.SetSlowLogTime)
 
+	s.web.GET("/api/v1/proxy/rewrite_rules", s.GetRewriteRules)
+	s.web.PUT("/api/v1/proxy/rewrite_rules/reload", s.ReloadRewriteRules)
+
 	s.web.PUT("/api/v1/proxy/config/save", s.SaveProxyConfig)
 }
 